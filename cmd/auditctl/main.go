@@ -0,0 +1,132 @@
+// Command auditctl inspects the gateway audit trail offline.
+//
+//	auditctl [-data ./data] verify [-head HASH]
+//	auditctl [-data ./data] export [-action A] [-provider ID] [-request ID]
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/wah4pc/gateway/internal/fhirmap"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+	"github.com/wah4pc/gateway/internal/service"
+	"github.com/wah4pc/gateway/pkg/envelope"
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+func main() {
+	dataDir := flag.String("data", "./data", "gateway data directory")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: auditctl [-data dir] verify|export [flags]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Patient identifiers are sealed with the server's keys.
+	keyring, err := envelope.LoadKeyring(os.Getenv("ENCRYPTION_KEY_FILE"), os.Getenv("ENCRYPTION_KEYS"))
+	if err != nil {
+		log.Fatalf("failed to load encryption keys: %v", err)
+	}
+
+	store, err := repository.NewJSONStore(*dataDir, keyring)
+	if err != nil {
+		log.Fatalf("failed to open data directory: %v", err)
+	}
+	repo := repository.NewAuditRepository(store)
+
+	switch flag.Arg(0) {
+	case "verify":
+		// The chain is keyed with the server's audit key.
+		key := os.Getenv("AUDIT_HMAC_KEY")
+		if key == "" {
+			log.Fatalf("AUDIT_HMAC_KEY must be set")
+		}
+		os.Exit(verify(repo, []byte(key), flag.Args()[1:]))
+	case "export":
+		export(repo, flag.Args()[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// verify prints the verification result and returns the exit code:
+// 0 for an intact chain, 1 if tampering was detected. Missing encryption
+// keys are a configuration error, not tampering.
+func verify(repo *repository.AuditRepository, key []byte, args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	head := fs.String("head", "", "head reported by an earlier verify, which must still be in the chain")
+	fs.Parse(args)
+
+	var result *service.AuditVerification
+	entries, err := repo.GetAll()
+	if errors.Is(err, repository.ErrNoKeyring) || errors.Is(err, envelope.ErrUnknownKey) {
+		log.Fatalf("cannot read audit trail: %v", err)
+	}
+	if err != nil {
+		result = &service.AuditVerification{Valid: false, Reason: err.Error()}
+	} else {
+		result = service.VerifyAuditChain(key, entries)
+		service.CheckAuditHead(result, entries, *head)
+	}
+
+	if result.Valid {
+		fmt.Printf("OK: %d entries, chain intact, head %s\n", result.Entries, result.Head)
+		return 0
+	}
+	if result.BrokenAt > 0 {
+		fmt.Printf("TAMPERED: entry %d: %s\n", result.BrokenAt, result.Reason)
+	} else {
+		fmt.Printf("TAMPERED: %s\n", result.Reason)
+	}
+	return 1
+}
+
+// export writes the (filtered) trail to stdout as a Bundle of AuditEvents.
+func export(repo *repository.AuditRepository, args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	action := fs.String("action", "", "only entries with this action")
+	providerID := fs.String("provider", "", "only entries for this provider ID")
+	requestID := fs.String("request", "", "only entries for this request ID")
+	fs.Parse(args)
+
+	entries, err := repo.GetAll()
+	if err != nil {
+		log.Fatalf("failed to read audit trail: %v", err)
+	}
+
+	events := []interface{}{}
+	for _, e := range entries {
+		if (*action != "" && e.Action != model.AuditAction(*action)) ||
+			(*providerID != "" && e.ProviderID != *providerID) ||
+			(*requestID != "" && !contains(e.RequestIDs, *requestID)) {
+			continue
+		}
+		events = append(events, fhirmap.AuditEventFromEntry(e))
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(fhir.NewSearchBundle(events)); err != nil {
+		log.Fatalf("failed to write bundle: %v", err)
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+// Command keyctl manages the keys that encrypt patient data at rest.
+//
+//	keyctl generate <keyID>     print a new key entry for the key file
+//	keyctl [-data ./data] rekey re-encrypt all data with the active key
+//
+// Keys are read like the server reads them, from ENCRYPTION_KEY_FILE and
+// ENCRYPTION_KEYS. To rotate, append a generated key to the key file, stop
+// the server, run rekey, remove the old key and start the server again.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/wah4pc/gateway/internal/repository"
+	"github.com/wah4pc/gateway/pkg/envelope"
+)
+
+func main() {
+	dataDir := flag.String("data", "./data", "gateway data directory")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: keyctl generate <keyID> | keyctl [-data dir] rekey")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "generate":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatalf("failed to generate key: %v", err)
+		}
+		fmt.Printf("%s:%s\n", flag.Arg(1), base64.StdEncoding.EncodeToString(key))
+	case "rekey":
+		keyring, err := envelope.LoadKeyring(os.Getenv("ENCRYPTION_KEY_FILE"), os.Getenv("ENCRYPTION_KEYS"))
+		if err != nil {
+			log.Fatalf("failed to load encryption keys: %v", err)
+		}
+		store, err := repository.NewJSONStore(*dataDir, keyring)
+		if err != nil {
+			log.Fatalf("failed to open data directory: %v", err)
+		}
+		n, err := store.Rekey()
+		if err != nil {
+			log.Fatalf("rekey failed after %d values: %v", n, err)
+		}
+		fmt.Printf("re-encrypted %d values with key %s\n", n, keyring.ActiveKeyID())
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
@@ -1,18 +1,40 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/wah4pc/gateway/internal/handler"
+	"github.com/wah4pc/gateway/internal/matching"
 	"github.com/wah4pc/gateway/internal/repository"
 	"github.com/wah4pc/gateway/internal/service"
+	"github.com/wah4pc/gateway/pkg/envelope"
+	"github.com/wah4pc/gateway/pkg/fhir"
+	"github.com/wah4pc/gateway/pkg/httpclient"
 )
 
 func main() {
-	store, err := repository.NewJSONStore("./data")
+	allowed, err := httpclient.ParseNetworks(os.Getenv("CALLBACK_ALLOWED_NETWORKS"))
+	if err != nil {
+		log.Fatalf("CALLBACK_ALLOWED_NETWORKS: %v", err)
+	}
+	httpclient.SetAllowedNetworks(allowed)
+
+	keyring, err := envelope.LoadKeyring(os.Getenv("ENCRYPTION_KEY_FILE"), os.Getenv("ENCRYPTION_KEYS"))
+	if err != nil {
+		log.Fatalf("failed to load encryption keys: %v", err)
+	}
+	if keyring == nil {
+		log.Println("ENCRYPTION_KEY_FILE and ENCRYPTION_KEYS not set, patient data is stored unencrypted")
+	}
+
+	store, err := repository.NewJSONStore("./data", keyring)
 	if err != nil {
 		log.Fatalf("failed to initialize store: %v", err)
 	}
@@ -20,22 +42,167 @@ func main() {
 	providerRepo := repository.NewProviderRepository(store)
 	requestRepo := repository.NewRequestRepository(store)
 	responseRepo := repository.NewResponseRepository(store)
+	consentRepo := repository.NewConsentRepository(store)
+	breakGlassRepo := repository.NewBreakGlassRepository(store)
+	auditRepo := repository.NewAuditRepository(store)
+	mpiRepo := repository.NewMPIRepository(store)
+	approvalRepo := repository.NewApprovalRepository(store)
+	identifierSystemRepo := repository.NewIdentifierSystemRepository(store)
+	deliveryRepo := repository.NewDeliveryRepository(store)
+	accessPolicyRepo := repository.NewAccessPolicyRepository(store)
+
+	deidentifier, err := newDeidentifier()
+	if err != nil {
+		log.Fatalf("failed to initialize de-identification: %v", err)
+	}
+
+	// The audit chain is keyed so that it cannot be rewritten from the data
+	// directory alone.
+	auditKey := os.Getenv("AUDIT_HMAC_KEY")
+	if auditKey == "" {
+		log.Fatalf("AUDIT_HMAC_KEY must be set")
+	}
+	auditSvc, err := service.NewAuditService(auditRepo, []byte(auditKey))
+	if err != nil {
+		log.Fatalf("failed to initialize audit trail: %v", err)
+	}
+
+	identifierSvc, err := service.NewIdentifierSystemService(identifierSystemRepo)
+	if err != nil {
+		log.Fatalf("failed to initialize identifier system registry: %v", err)
+	}
+
+	consentSvc := service.NewConsentService(consentRepo, identifierSvc, service.ConsentMode(os.Getenv("CONSENT_MODE")))
+	breakGlassSvc := service.NewBreakGlassService(breakGlassRepo)
+	mpiSvc := service.NewMPIService(mpiRepo, consentSvc, auditSvc)
+	matchSvc := service.NewMatchService(mpiRepo, matching.NewMatcher(envDays("MATCH_BIRTHDATE_TOLERANCE_DAYS", 3)), auditSvc)
+	approvalSvc := service.NewApprovalService(approvalRepo)
+	retentionSvc := service.NewRetentionService(requestRepo, responseRepo, approvalRepo, breakGlassRepo, retentionPolicy())
+	circuit := circuitPolicy()
+	deliverySvc := service.NewDeliveryService(deliveryRepo, circuit)
+	accessPolicySvc := service.NewAccessPolicyService(accessPolicyRepo, providerRepo, auditSvc)
+	patientSvc := service.NewPatientService(service.PatientServiceDeps{
+		ProviderRepo:  providerRepo,
+		RequestRepo:   requestRepo,
+		ResponseRepo:  responseRepo,
+		ConsentSvc:    consentSvc,
+		BreakGlassSvc: breakGlassSvc,
+		Deidentifier:  deidentifier,
+		AuditSvc:      auditSvc,
+		MPISvc:        mpiSvc,
+		MatchSvc:      matchSvc,
+		IdentifierSvc: identifierSvc,
+		ApprovalSvc:   approvalSvc,
+		DeliverySvc:   deliverySvc,
+		PolicySvc:     accessPolicySvc,
+	})
+	providerSvc := service.NewProviderService(providerRepo, auditSvc, patientSvc, deliverySvc, identifierSvc, service.OnboardingMode(os.Getenv("PROVIDER_ONBOARDING")))
 
-	providerSvc := service.NewProviderService(providerRepo)
-	patientSvc := service.NewPatientService(providerRepo, requestRepo, responseRepo)
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		log.Println("ADMIN_TOKEN not set, admin endpoints are disabled")
+	}
+	auth := handler.NewAuth(adminToken, providerSvc)
 
-	providerHandler := handler.NewProviderHandler(providerSvc)
+	providerHandler := handler.NewProviderHandler(providerSvc, auth)
 	patientHandler := handler.NewPatientHandler(patientSvc)
+	fhirHandler := handler.NewFHIRHandler(patientSvc)
+	directoryHandler := handler.NewDirectoryHandler(providerSvc)
+	consentHandler := handler.NewConsentHandler(consentSvc)
+	breakGlassHandler := handler.NewBreakGlassHandler(breakGlassSvc)
+	auditHandler := handler.NewAuditHandler(auditSvc)
+	retentionHandler := handler.NewRetentionHandler(retentionSvc)
+	mpiHandler := handler.NewMPIHandler(mpiSvc)
+	identifierSystemHandler := handler.NewIdentifierSystemHandler(identifierSvc)
+	matchHandler := handler.NewMatchHandler(matchSvc)
+	approvalHandler := handler.NewApprovalHandler(approvalSvc, patientSvc)
+	accessPolicyHandler := handler.NewAccessPolicyHandler(accessPolicySvc)
+
+	go providerSvc.VerifyPendingCallbacks()
+	go patientSvc.RunDeliveryProbes(circuit.OpenDuration / 2)
+
+	if retentionSvc.Enabled() {
+		go retentionSvc.Run(retentionInterval())
+	}
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
 	r.Route("/v1", func(r chi.Router) {
-		r.Get("/provider", providerHandler.GetProviders)
-		r.Post("/provider", providerHandler.CreateProvider)
+		r.Route("/provider", func(r chi.Router) {
+			r.Get("/", providerHandler.GetProviders)
+			r.Post("/", providerHandler.CreateProvider)
+			r.Get("/{id}", providerHandler.GetProvider)
+			r.With(auth.RequireOwnerOrAdmin).Put("/{id}", providerHandler.UpdateProvider)
+			r.With(auth.RequireOwnerOrAdmin).Patch("/{id}", providerHandler.PatchProvider)
+			r.With(auth.RequireOwnerOrAdmin).Delete("/{id}", providerHandler.DeleteProvider)
+			r.With(auth.RequireOwnerOrAdmin).Post("/{id}/verify", providerHandler.VerifyCallbacks)
+			r.With(auth.RequireAdmin).Post("/{id}/api-key", providerHandler.IssueAPIKey)
+			r.With(auth.RequireAdmin).Post("/{id}/approve", providerHandler.ApproveProvider)
+			r.With(auth.RequireAdmin).Post("/{id}/suspend", providerHandler.SuspendProvider)
+		})
+
+		r.Route("/consent", func(r chi.Router) {
+			r.With(auth.RequireAdmin).Get("/", consentHandler.GetConsents)
+			r.With(auth.RequireProviderOrAdmin).Post("/", consentHandler.CreateConsent)
+			r.With(auth.RequireProviderOrAdmin).Get("/{id}", consentHandler.GetConsent)
+			r.With(auth.RequireProviderOrAdmin).Delete("/{id}", consentHandler.RevokeConsent)
+		})
+
+		r.Route("/break-glass", func(r chi.Router) {
+			r.Use(auth.RequireAdmin)
+			r.Get("/", breakGlassHandler.GetReviews)
+			r.Get("/{id}", breakGlassHandler.GetReview)
+			r.Post("/{id}/review", breakGlassHandler.CompleteReview)
+		})
+
+		r.Route("/approval", func(r chi.Router) {
+			r.Use(auth.RequireProvider)
+			r.Get("/", approvalHandler.GetApprovals)
+			r.Get("/{id}", approvalHandler.GetApproval)
+			r.Post("/{id}/decision", approvalHandler.Decide)
+		})
+
+		r.Route("/policy", func(r chi.Router) {
+			r.Use(auth.RequireAdmin)
+			r.Get("/", accessPolicyHandler.GetPolicies)
+			r.Post("/", accessPolicyHandler.CreatePolicy)
+			r.Get("/{id}", accessPolicyHandler.GetPolicy)
+			r.Put("/{id}", accessPolicyHandler.UpdatePolicy)
+			r.Delete("/{id}", accessPolicyHandler.DeletePolicy)
+		})
+
+		r.Route("/policy-decision", func(r chi.Router) {
+			r.Get("/", accessPolicyHandler.GetDecisions)
+			r.Get("/{id}", accessPolicyHandler.GetDecision)
+		})
+
+		r.Route("/audit", func(r chi.Router) {
+			r.Use(auth.RequireAdmin)
+			r.Get("/", auditHandler.GetAuditEvents)
+			r.Get("/verify", auditHandler.VerifyAuditTrail)
+		})
+
+		r.Get("/retention/report", retentionHandler.GetReport)
+
+		r.Route("/identifier-system", func(r chi.Router) {
+			r.Get("/", identifierSystemHandler.GetSystems)
+			r.With(auth.RequireAdmin).Post("/", identifierSystemHandler.CreateSystem)
+			r.With(auth.RequireAdmin).Put("/", identifierSystemHandler.UpdateSystem)
+		})
+
+		r.Route("/mpi", func(r chi.Router) {
+			r.Use(auth.RequireProvider)
+			r.Get("/", mpiHandler.FindPersons)
+			r.Get("/resolve", mpiHandler.Resolve)
+			r.Get("/{id}", mpiHandler.GetPerson)
+		})
+
+		r.With(auth.RequireProvider).Post("/match", matchHandler.Match)
 
 		r.Route("/fhir/patient", func(r chi.Router) {
+			r.Use(auth.RequireProvider)
 			r.Post("/request", patientHandler.CreateRequest)
 			r.Get("/request", patientHandler.GetPendingRequests)
 			r.Post("/respond", patientHandler.ReceiveResponse)
@@ -43,8 +210,120 @@ func main() {
 		})
 	})
 
+	r.Route("/fhir", func(r chi.Router) {
+		r.Get("/metadata", fhirHandler.Metadata)
+		r.With(auth.RequireProvider).Post("/Patient/$request", fhirHandler.RequestPatient)
+		r.Route("/Task", func(r chi.Router) {
+			r.Use(auth.RequireProvider)
+			r.Get("/", fhirHandler.SearchTasks)
+			r.Post("/", fhirHandler.CreateTask)
+			r.Get("/{id}", fhirHandler.ReadTask)
+			r.Put("/{id}", fhirHandler.UpdateTask)
+		})
+		r.Get("/Organization", directoryHandler.SearchOrganizations)
+		r.Get("/Organization/{id}", directoryHandler.ReadOrganization)
+		r.Get("/Endpoint", directoryHandler.SearchEndpoints)
+		r.Get("/Endpoint/{id}", directoryHandler.ReadEndpoint)
+	})
+
 	log.Println("WAH4PC API Gateway starting on :3050")
 	if err := http.ListenAndServe(":3050", r); err != nil {
 		log.Fatalf("server error: %v", err)
 	}
 }
+
+// newDeidentifier configures the research de-identification pipeline from
+// DEID_STEPS (comma separated, defaults to all steps) and DEID_PSEUDONYM_KEY.
+func newDeidentifier() (*fhir.Deidentifier, error) {
+	steps := fhir.DefaultDeidSteps
+	if v := os.Getenv("DEID_STEPS"); v != "" {
+		steps = fhir.ParseDeidSteps(v)
+	}
+
+	// There is no generated fallback: a key that changes on restart would
+	// silently break the linkage of research datasets.
+	key := []byte(os.Getenv("DEID_PSEUDONYM_KEY"))
+	if len(key) == 0 && containsStep(steps, fhir.DeidPseudonymizeIdentifiers) {
+		return nil, fmt.Errorf("DEID_PSEUDONYM_KEY must be set for step %q", fhir.DeidPseudonymizeIdentifiers)
+	}
+
+	return fhir.NewDeidentifier(steps, key)
+}
+
+func containsStep(steps []fhir.DeidStep, step fhir.DeidStep) bool {
+	for _, s := range steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// retentionPolicy reads the retention rules, in days, from
+// RETENTION_PAYLOAD_DAYS (after delivery), RETENTION_UNDELIVERED_DAYS and
+// RETENTION_METADATA_DAYS. All rules are off unless configured.
+func retentionPolicy() service.RetentionPolicy {
+	return service.RetentionPolicy{
+		PayloadAfterDeliveryDays: envDays("RETENTION_PAYLOAD_DAYS", 0),
+		PayloadUndeliveredDays:   envDays("RETENTION_UNDELIVERED_DAYS", 0),
+		MetadataDays:             envDays("RETENTION_METADATA_DAYS", 0),
+	}
+}
+
+func envDays(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 0 {
+		log.Fatalf("%s must be a number of days", name)
+	}
+	return days
+}
+
+// retentionInterval is how often the purger runs, from RETENTION_INTERVAL
+// (a Go duration, default 1h).
+func retentionInterval() time.Duration {
+	v := os.Getenv("RETENTION_INTERVAL")
+	if v == "" {
+		return time.Hour
+	}
+	interval, err := time.ParseDuration(v)
+	if err != nil || interval <= 0 {
+		log.Fatalf("RETENTION_INTERVAL must be a positive duration")
+	}
+	return interval
+}
+
+// circuitPolicy reads the delivery circuit breaker settings from
+// CIRCUIT_FAILURE_THRESHOLD (consecutive failures, default 5),
+// CIRCUIT_OPEN_DURATION (a Go duration, default 1m) and
+// DELIVERY_MAX_ATTEMPTS (failed attempts before a delivery is given up,
+// default 10).
+func circuitPolicy() service.CircuitPolicy {
+	policy := service.CircuitPolicy{FailureThreshold: 5, OpenDuration: time.Minute, MaxAttempts: 10}
+
+	if v := os.Getenv("CIRCUIT_FAILURE_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("CIRCUIT_FAILURE_THRESHOLD must be a positive number")
+		}
+		policy.FailureThreshold = n
+	}
+	if v := os.Getenv("CIRCUIT_OPEN_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < time.Second {
+			log.Fatalf("CIRCUIT_OPEN_DURATION must be a duration of at least 1s")
+		}
+		policy.OpenDuration = d
+	}
+	if v := os.Getenv("DELIVERY_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("DELIVERY_MAX_ATTEMPTS must be a positive number")
+		}
+		policy.MaxAttempts = n
+	}
+	return policy
+}
@@ -1,4 +1,10 @@
-# 1. Register providers (with required baseUrl and callback)
+# Run the gateway with PROVIDER_ONBOARDING=open and CONSENT_MODE=opt-out
+# (and DEID_PSEUDONYM_KEY and AUDIT_HMAC_KEY set) so new providers are
+# active and the request needs no recorded consent.
+
+# 1. Register providers (with required baseUrl and callback). Each response
+# carries the provider's apiKey; the patient exchange below authenticates
+# with it.
 curl -X POST http://localhost:3043/v1/provider -H "Content-Type: application/json" -d '{
   "providerId": "HOSPITAL_001",
   "name": "City Hospital",
@@ -17,18 +23,21 @@ curl -X POST http://localhost:3043/v1/provider -H "Content-Type: application/jso
   "callback": { "patientResponse": "https://clinic.example.com/wah4pc/patient/respond" }
 }'
 
+HOSPITAL_KEY="<apiKey from HOSPITAL_001's registration>"
+CLINIC_KEY="<apiKey from CLINIC_001's registration>"
+
 # 2. Hospital requests patient data from clinic
-curl -X POST http://localhost:3043/v1/fhir/patient/request -H "Content-Type: application/json" -d '{
+curl -X POST http://localhost:3043/v1/fhir/patient/request -H "Content-Type: application/json" -H "Authorization: Bearer $HOSPITAL_KEY" -d '{
   "requestorProviderId": "HOSPITAL_001",
   "targetProviderId": "CLINIC_001",
   "patientReference": {
-    "identifiers": [{ "system": "NATIONAL_ID", "value": "123456789" }]
+    "identifiers": [{ "system": "NATIONAL_ID", "value": "1234-5678-9012-3456" }]
   }
 }'
 
 # 3. Clinic sends response (use requestId from step 2)
 # WAH4PC will automatically push to hospital's callback URL
-curl -X POST http://localhost:3043/v1/fhir/patient/respond -H "Content-Type: application/json" -d '{
+curl -X POST http://localhost:3043/v1/fhir/patient/respond -H "Content-Type: application/json" -H "Authorization: Bearer $CLINIC_KEY" -d '{
   "requestId": "REQ-20251205-0001",
   "fromProviderId": "CLINIC_001",
   "fhirPatient": {
@@ -40,7 +49,7 @@ curl -X POST http://localhost:3043/v1/fhir/patient/respond -H "Content-Type: app
 }'
 
 # 4. Hospital can also pull result (optional, for status check or retry)
-curl "http://localhost:3043/v1/fhir/patient/responde?requestId=REQ-20251205-0001"
+curl -H "Authorization: Bearer $HOSPITAL_KEY" "http://localhost:3043/v1/fhir/patient/response?requestId=REQ-20251205-0001"
 
 # 5. List all providers
 curl http://localhost:3043/v1/provider
\ No newline at end of file
@@ -0,0 +1,92 @@
+package fhirmap
+
+import (
+	"strconv"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+// Extensions carrying the hash chain of an exported audit entry.
+const (
+	ExtAuditHash      = "urn:wah4pc:StructureDefinition/audit-hash"
+	ExtAuditPrevHash  = "urn:wah4pc:StructureDefinition/audit-prev-hash"
+	SystemAuditAction = "urn:wah4pc:audit-action"
+)
+
+const (
+	systemAuditEventType  = "http://terminology.hl7.org/CodeSystem/audit-event-type"
+	systemAuditEntityType = "http://terminology.hl7.org/CodeSystem/audit-entity-type"
+	systemObjectRole      = "http://terminology.hl7.org/CodeSystem/object-role"
+)
+
+// AuditEventFromEntry maps an audit trail entry onto a FHIR AuditEvent.
+func AuditEventFromEntry(entry model.AuditEntry) *fhir.AuditEvent {
+	event := &fhir.AuditEvent{
+		ResourceType: "AuditEvent",
+		ID:           "audit-" + strconv.FormatInt(entry.Sequence, 10),
+		Extension: []fhir.Extension{
+			{URL: ExtAuditHash, ValueString: entry.Hash},
+			{URL: ExtAuditPrevHash, ValueString: entry.PrevHash},
+		},
+		Type:        fhir.Coding{System: systemAuditEventType, Code: "rest", Display: "RESTful Operation"},
+		Subtype:     []fhir.Coding{{System: SystemAuditAction, Code: string(entry.Action)}},
+		Action:      auditEventAction(entry.Action),
+		Recorded:    entry.Recorded,
+		Outcome:     auditEventOutcome(entry.Outcome),
+		OutcomeDesc: entry.Details,
+		Source: fhir.AuditEventSource{
+			Observer: fhir.Reference{Display: "WAH4PC Gateway"},
+		},
+	}
+
+	if entry.ProviderID != "" {
+		event.Agent = append(event.Agent, fhir.AuditEventAgent{
+			Who:       ProviderReference(entry.ProviderID),
+			Requestor: true,
+		})
+	}
+
+	for _, requestID := range entry.RequestIDs {
+		event.Entity = append(event.Entity, fhir.AuditEventEntity{
+			What: &fhir.Reference{Reference: "Task/" + requestID},
+			Type: &fhir.Coding{System: systemAuditEntityType, Code: "2", Display: "System Object"},
+			Role: &fhir.Coding{System: systemObjectRole, Code: "4", Display: "Domain Resource"},
+		})
+	}
+	for _, id := range entry.PatientIdentifiers {
+		event.Entity = append(event.Entity, fhir.AuditEventEntity{
+			What: &fhir.Reference{Type: "Patient", Identifier: &fhir.Identifier{System: id.System, Value: id.Value}},
+			Type: &fhir.Coding{System: systemAuditEntityType, Code: "1", Display: "Person"},
+			Role: &fhir.Coding{System: systemObjectRole, Code: "1", Display: "Patient"},
+		})
+	}
+
+	return event
+}
+
+func auditEventAction(action model.AuditAction) string {
+	switch action {
+	case model.AuditActionProviderRegister, model.AuditActionRequestCreate, model.AuditActionResponseSubmit:
+		return "C"
+	case model.AuditActionRequestPoll, model.AuditActionResponseRead, model.AuditActionMPIRead:
+		return "R"
+	case model.AuditActionProviderUpdate:
+		return "U"
+	default:
+		return "E"
+	}
+}
+
+// auditEventOutcome maps onto the AuditEvent outcome codes: 0 success,
+// 4 minor failure (here a policy denial) and 8 serious failure.
+func auditEventOutcome(outcome model.AuditOutcome) string {
+	switch outcome {
+	case model.AuditOutcomeDenied:
+		return "4"
+	case model.AuditOutcomeFailure:
+		return "8"
+	default:
+		return "0"
+	}
+}
@@ -0,0 +1,73 @@
+package fhirmap
+
+import (
+	"time"
+
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+// CapabilityStatement describes the FHIR facade served under /fhir.
+func CapabilityStatement() *fhir.CapabilityStatement {
+	return &fhir.CapabilityStatement{
+		ResourceType: "CapabilityStatement",
+		Status:       "active",
+		Date:         time.Now().UTC().Format(time.RFC3339),
+		Kind:         "instance",
+		Software:     &fhir.CapabilitySoftware{Name: "WAH4PC Gateway"},
+		FHIRVersion:  fhir.Version,
+		Format:       []string{fhir.MediaTypeJSON},
+		Rest: []fhir.CapabilityStatementRest{{
+			Mode: "server",
+			Resource: []fhir.CapabilityResource{
+				{
+					Type: "Patient",
+					Operation: []fhir.CapabilityOperation{{
+						Name:          "request",
+						Definition:    "urn:wah4pc:OperationDefinition/Patient-request",
+						Documentation: "Request a patient record from another provider. Returns the Task tracking the exchange.",
+					}},
+				},
+				{
+					Type: "Task",
+					Interaction: []fhir.CapabilityCode{
+						{Code: "read"},
+						{Code: "update"},
+						{Code: "create"},
+						{Code: "search-type"},
+					},
+					SearchParam: []fhir.CapabilitySearch{
+						{Name: "owner", Type: "reference"},
+						{Name: "requester", Type: "reference"},
+						{Name: "status", Type: "token"},
+						{Name: "identifier", Type: "token"},
+					},
+				},
+				{
+					Type: "Organization",
+					Interaction: []fhir.CapabilityCode{
+						{Code: "read"},
+						{Code: "search-type"},
+					},
+					SearchParam: []fhir.CapabilitySearch{
+						{Name: "name", Type: "string"},
+						{Name: "type", Type: "token"},
+						{Name: "address", Type: "string"},
+						{Name: "address-state", Type: "string"},
+						{Name: "active", Type: "token"},
+					},
+				},
+				{
+					Type: "Endpoint",
+					Interaction: []fhir.CapabilityCode{
+						{Code: "read"},
+						{Code: "search-type"},
+					},
+					SearchParam: []fhir.CapabilitySearch{
+						{Name: "organization", Type: "reference"},
+						{Name: "status", Type: "token"},
+					},
+				},
+			},
+		}},
+	}
+}
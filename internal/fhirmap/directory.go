@@ -0,0 +1,121 @@
+package fhirmap
+
+import (
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+const (
+	// SystemProviderType codes Organization.type with the provider type.
+	SystemProviderType = "urn:wah4pc:provider-type"
+	// SystemConnectionType codes Endpoint.connectionType for the gateway's
+	// callback and pull protocols.
+	SystemConnectionType = "urn:wah4pc:connection-type"
+
+	ConnectionCallback = "wah4pc-callback"
+	ConnectionPull     = "wah4pc-pull"
+
+	// EndpointPull names the pull endpoint alongside the subscription IDs.
+	EndpointPull = model.CallbackPull
+)
+
+// OrganizationFromProvider maps a provider onto a directory Organization
+// referencing its Endpoints.
+func OrganizationFromProvider(p *model.Provider) *fhir.Organization {
+	org := &fhir.Organization{
+		ResourceType: "Organization",
+		ID:           p.ProviderID,
+		Meta:         &fhir.Meta{LastUpdated: p.UpdatedAt},
+		Identifier:   []fhir.Identifier{{System: SystemProviderID, Value: p.ProviderID}},
+		Active:       p.IsActive(),
+		Type: []fhir.CodeableConcept{{
+			Coding: []fhir.Coding{{System: SystemProviderType, Code: string(p.Type)}},
+			Text:   string(p.Type),
+		}},
+		Name: p.Name,
+	}
+	if p.Location != nil {
+		org.Address = []fhir.Address{{
+			City:     p.Location.City,
+			District: p.Location.Province,
+			State:    p.Location.Region,
+		}}
+	}
+	for _, e := range EndpointsFromProvider(p) {
+		org.Endpoint = append(org.Endpoint, fhir.Reference{Reference: "Endpoint/" + e.ID})
+	}
+	return org
+}
+
+// EndpointsFromProvider maps a provider's subscriptions and pull endpoint
+// onto Endpoints. A subscription is active once it is enabled and its URL
+// passed verification; the pull endpoint once its URL did.
+func EndpointsFromProvider(p *model.Provider) []*fhir.Endpoint {
+	var endpoints []*fhir.Endpoint
+	for _, sub := range p.Subscriptions() {
+		status := "off"
+		if sub.Enabled {
+			status = callbackStatus(p, sub.URL)
+		}
+		endpoints = append(endpoints, newEndpoint(p, sub.ID, ConnectionCallback, sub.URL, status))
+	}
+	if p.Endpoints.Pull {
+		url := p.Endpoints.PatientRequestURL(p.BaseURL)
+		endpoints = append(endpoints, newEndpoint(p, EndpointPull, ConnectionPull, url, callbackStatus(p, url)))
+	}
+	return endpoints
+}
+
+// EndpointID is the id of a provider's Endpoint for a subscription ID or
+// EndpointPull.
+func EndpointID(providerID, name string) string {
+	return providerID + "-" + name
+}
+
+func newEndpoint(p *model.Provider, name, connection, url, status string) *fhir.Endpoint {
+	endpoint := &fhir.Endpoint{
+		ResourceType:         "Endpoint",
+		ID:                   EndpointID(p.ProviderID, name),
+		Meta:                 &fhir.Meta{LastUpdated: p.UpdatedAt},
+		Status:               status,
+		ConnectionType:       fhir.Coding{System: SystemConnectionType, Code: connection},
+		Name:                 name,
+		ManagingOrganization: &fhir.Reference{Reference: "Organization/" + p.ProviderID, Display: p.Name},
+		PayloadMimeType:      []string{payloadMimeType(p.FHIRFormat)},
+		Address:              url,
+	}
+
+	resourceTypes := []string{"Patient"}
+	if p.Capabilities != nil && len(p.Capabilities.ResourceTypes) > 0 {
+		resourceTypes = p.Capabilities.ResourceTypes
+	}
+	for _, t := range resourceTypes {
+		endpoint.PayloadType = append(endpoint.PayloadType, fhir.CodeableConcept{Text: t})
+	}
+	return endpoint
+}
+
+func callbackStatus(p *model.Provider, url string) string {
+	if !p.IsActive() {
+		return "off"
+	}
+	for _, v := range p.CallbackVerification {
+		if v.URL != url {
+			continue
+		}
+		switch v.Status {
+		case model.CallbackVerificationVerified:
+			return "active"
+		case model.CallbackVerificationFailed:
+			return "error"
+		}
+	}
+	return "suspended"
+}
+
+func payloadMimeType(format model.FHIRFormat) string {
+	if format == model.FHIRFormatXML {
+		return "application/fhir+xml"
+	}
+	return fhir.MediaTypeJSON
+}
@@ -0,0 +1,29 @@
+package fhirmap
+
+import (
+	"strings"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+// DemographicsFromPatient maps a FHIR Patient onto matching demographics.
+// The middle name comes only from the mother's-family extension, since
+// double given names such as "Maria Cristina" are common. It returns nil
+// when the resource has no usable demographics.
+func DemographicsFromPatient(resource []byte) *model.Demographics {
+	details := fhir.ParsePatientDetails(resource)
+	d := model.Demographics{BirthDate: details.BirthDate, Gender: details.Gender}
+
+	if name := details.Name; name != nil {
+		d.FamilyName = name.Family
+		d.Suffix = strings.Join(name.Suffix, " ")
+		d.MiddleName = name.MothersFamily()
+		d.GivenName = strings.Join(name.Given, " ")
+	}
+
+	if d == (model.Demographics{}) {
+		return nil
+	}
+	return &d
+}
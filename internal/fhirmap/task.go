@@ -0,0 +1,336 @@
+// Package fhirmap maps gateway models onto FHIR resources.
+package fhirmap
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+const (
+	SystemRequestID      = "urn:wah4pc:request-id"
+	SystemCorrelationKey = "urn:wah4pc:correlation-key"
+	SystemProviderID     = "urn:wah4pc:provider-id"
+
+	// InputPatientIdentifier and friends name the Task.input entries.
+	InputPatientIdentifier = "patientIdentifier"
+	InputPatientID         = "patientId"
+	InputResourceType      = "resourceType"
+	InputFHIRVersion       = "fhirVersion"
+	InputElements          = "elements"
+	InputPurposeOfUse      = "purposeOfUse"
+	InputProfile           = "profile"
+
+	// OutputPatient names the Task.output entry referencing the returned resource.
+	OutputPatient = "patient"
+)
+
+// breakGlassNotePrefix starts the Task.note added for break-glass requests,
+// so the requestor's own note can be told apart from it.
+const breakGlassNotePrefix = "Break-glass emergency access: "
+
+// Task statuses used for the request lifecycle.
+const (
+	TaskStatusRequested = "requested"
+	TaskStatusOnHold    = "on-hold"
+	TaskStatusCompleted = "completed"
+	TaskStatusFailed    = "failed"
+	TaskStatusRejected  = "rejected"
+	TaskStatusCancelled = "cancelled"
+)
+
+var (
+	ErrInvalidTask        = errors.New("resource is not a Task")
+	ErrTaskMissingParties = errors.New("Task requester and owner must reference registered providers")
+	ErrTaskNotFinished    = errors.New("Task status must be completed or failed")
+	ErrTaskMissingOutput  = errors.New("completed Task must reference a contained resource in output")
+)
+
+// TaskStatus maps a request status onto the FHIR Task status value set.
+func TaskStatus(status model.RequestStatus) string {
+	switch status {
+	case model.RequestStatusCompleted:
+		return TaskStatusCompleted
+	case model.RequestStatusFailed:
+		return TaskStatusFailed
+	case model.RequestStatusConsentDenied:
+		return TaskStatusRejected
+	case model.RequestStatusAwaitingApproval:
+		return TaskStatusOnHold
+	case model.RequestStatusCancelled:
+		return TaskStatusCancelled
+	default:
+		return TaskStatusRequested
+	}
+}
+
+// RequestStatus maps a FHIR Task status back onto a request status. The
+// boolean result is false for Task statuses the gateway does not track.
+func RequestStatus(status string) (model.RequestStatus, bool) {
+	switch status {
+	case TaskStatusRequested:
+		return model.RequestStatusPending, true
+	case TaskStatusCompleted:
+		return model.RequestStatusCompleted, true
+	case TaskStatusFailed:
+		return model.RequestStatusFailed, true
+	case TaskStatusRejected:
+		return model.RequestStatusConsentDenied, true
+	case TaskStatusOnHold:
+		return model.RequestStatusAwaitingApproval, true
+	case TaskStatusCancelled:
+		return model.RequestStatusCancelled, true
+	default:
+		return "", false
+	}
+}
+
+// ProviderReference references a registered provider as an Organization.
+func ProviderReference(providerID string) *fhir.Reference {
+	return &fhir.Reference{
+		Reference:  "Organization/" + providerID,
+		Type:       "Organization",
+		Identifier: &fhir.Identifier{System: SystemProviderID, Value: providerID},
+	}
+}
+
+// ProviderIDFromReference extracts a provider ID from a reference produced
+// by ProviderReference, or from a bare "Organization/{id}" reference.
+func ProviderIDFromReference(ref *fhir.Reference) string {
+	if ref == nil {
+		return ""
+	}
+	if ref.Identifier != nil && ref.Identifier.System == SystemProviderID {
+		return ref.Identifier.Value
+	}
+	return strings.TrimPrefix(ref.Reference, "Organization/")
+}
+
+// TaskFromRequest represents a patient request, and its response when one
+// has been received, as a FHIR Task.
+func TaskFromRequest(request *model.PatientRequest, response *model.PatientResponse) *fhir.Task {
+	task := &fhir.Task{
+		ResourceType: "Task",
+		ID:           request.RequestID,
+		Meta:         &fhir.Meta{LastUpdated: request.UpdatedAt},
+		Identifier: []fhir.Identifier{
+			{System: SystemRequestID, Value: request.RequestID},
+		},
+		Status: TaskStatus(request.Status),
+		Intent: "order",
+		Code: &fhir.CodeableConcept{
+			Coding: []fhir.Coding{{
+				System:  "http://hl7.org/fhir/CodeSystem/task-code",
+				Code:    "fulfill",
+				Display: "Fulfill the focal request",
+			}},
+			Text: "Patient data request",
+		},
+		AuthoredOn:   request.CreatedAt,
+		LastModified: request.UpdatedAt,
+		Requester:    ProviderReference(request.RequestorProviderID),
+		Owner:        ProviderReference(request.TargetProviderID),
+	}
+
+	if request.CorrelationKey != "" {
+		task.Identifier = append(task.Identifier, fhir.Identifier{System: SystemCorrelationKey, Value: request.CorrelationKey})
+	}
+	if request.Metadata.Reason != "" {
+		task.ReasonCode = &fhir.CodeableConcept{Text: request.Metadata.Reason}
+	}
+	if request.BreakGlass != nil {
+		task.Priority = "stat"
+		task.Meta.Security = append(task.Meta.Security, fhir.Coding{
+			System:  "http://terminology.hl7.org/CodeSystem/v3-ActReason",
+			Code:    "BTG",
+			Display: "break the glass",
+		})
+		task.Note = append(task.Note, fhir.Annotation{Text: breakGlassNotePrefix + request.BreakGlass.Reason})
+	}
+	if request.Metadata.Notes != "" {
+		task.Note = append(task.Note, fhir.Annotation{Text: request.Metadata.Notes})
+	}
+
+	for _, id := range request.PatientReference.Identifiers {
+		task.Input = append(task.Input, fhir.TaskParameter{
+			Type:            fhir.CodeableConcept{Text: InputPatientIdentifier},
+			ValueIdentifier: &fhir.Identifier{System: id.System, Value: id.Value},
+		})
+	}
+	if request.PatientReference.ID != "" {
+		task.Input = append(task.Input, fhir.TaskParameter{
+			Type:        fhir.CodeableConcept{Text: InputPatientID},
+			ValueString: request.PatientReference.ID,
+		})
+	}
+	task.Input = append(task.Input,
+		fhir.TaskParameter{Type: fhir.CodeableConcept{Text: InputResourceType}, ValueCode: request.FHIRConstraints.ResourceType},
+		fhir.TaskParameter{Type: fhir.CodeableConcept{Text: InputFHIRVersion}, ValueString: request.FHIRConstraints.Version},
+	)
+	if len(request.FHIRConstraints.Elements) > 0 {
+		task.Input = append(task.Input, fhir.TaskParameter{
+			Type:        fhir.CodeableConcept{Text: InputElements},
+			ValueString: strings.Join(request.FHIRConstraints.Elements, ","),
+		})
+	}
+	if request.FHIRConstraints.PurposeOfUse != "" {
+		task.Input = append(task.Input, fhir.TaskParameter{
+			Type:      fhir.CodeableConcept{Text: InputPurposeOfUse},
+			ValueCode: string(request.FHIRConstraints.PurposeOfUse),
+		})
+	}
+	if request.FHIRConstraints.Profile != "" {
+		task.Input = append(task.Input, fhir.TaskParameter{
+			Type:        fhir.CodeableConcept{Text: InputProfile},
+			ValueString: request.FHIRConstraints.Profile,
+		})
+	}
+
+	if response != nil {
+		if response.Error != "" {
+			task.StatusReason = &fhir.CodeableConcept{Text: response.Error}
+		}
+		if len(response.FHIRPatient) > 0 {
+			task.Output = append(task.Output, fhir.TaskParameter{
+				Type:           fhir.CodeableConcept{Text: OutputPatient},
+				ValueReference: resourceReference(response.FHIRPatient, request.FHIRConstraints.ResourceType),
+			})
+		}
+	}
+
+	return task
+}
+
+// RequestFromTask reads a new patient request out of a Task. The returned
+// request has no ID, status or timestamps; those are assigned on creation.
+func RequestFromTask(task *fhir.Task) (*model.PatientRequest, error) {
+	if task.ResourceType != "Task" {
+		return nil, ErrInvalidTask
+	}
+
+	request := &model.PatientRequest{
+		RequestorProviderID: ProviderIDFromReference(task.Requester),
+		TargetProviderID:    ProviderIDFromReference(task.Owner),
+	}
+	if request.RequestorProviderID == "" || request.TargetProviderID == "" {
+		return nil, ErrTaskMissingParties
+	}
+
+	for _, id := range task.Identifier {
+		if id.System == SystemCorrelationKey {
+			request.CorrelationKey = id.Value
+		}
+	}
+	if task.ReasonCode != nil {
+		request.Metadata.Reason = task.ReasonCode.Text
+	}
+	for _, note := range task.Note {
+		if !strings.HasPrefix(note.Text, breakGlassNotePrefix) {
+			request.Metadata.Notes = note.Text
+			break
+		}
+	}
+
+	for _, in := range task.Input {
+		switch in.Type.Text {
+		case InputPatientIdentifier:
+			if in.ValueIdentifier != nil {
+				request.PatientReference.Identifiers = append(request.PatientReference.Identifiers, model.PatientIdentifier{
+					System: in.ValueIdentifier.System,
+					Value:  in.ValueIdentifier.Value,
+				})
+			}
+		case InputPatientID:
+			request.PatientReference.ID = in.ValueString
+		case InputResourceType:
+			request.FHIRConstraints.ResourceType = in.ValueCode
+		case InputFHIRVersion:
+			request.FHIRConstraints.Version = in.ValueString
+		case InputElements:
+			for _, e := range strings.Split(in.ValueString, ",") {
+				if e = strings.TrimSpace(e); e != "" {
+					request.FHIRConstraints.Elements = append(request.FHIRConstraints.Elements, e)
+				}
+			}
+		case InputPurposeOfUse:
+			request.FHIRConstraints.PurposeOfUse = model.PurposeOfUse(in.ValueCode)
+		case InputProfile:
+			request.FHIRConstraints.Profile = in.ValueString
+		}
+	}
+
+	return request, nil
+}
+
+// ResponseFromTask reads a target's answer out of a completed or failed
+// Task. The returned resource is taken from Task.contained, referenced by
+// the "patient" output.
+func ResponseFromTask(task *fhir.Task) (*model.PatientResponse, error) {
+	if task.ResourceType != "Task" {
+		return nil, ErrInvalidTask
+	}
+
+	status, ok := RequestStatus(task.Status)
+	if !ok || (status != model.RequestStatusCompleted && status != model.RequestStatusFailed) {
+		return nil, ErrTaskNotFinished
+	}
+
+	response := &model.PatientResponse{
+		RequestID:      task.ID,
+		FromProviderID: ProviderIDFromReference(task.Owner),
+		Status:         status,
+	}
+	if task.StatusReason != nil {
+		response.Error = task.StatusReason.Text
+	}
+
+	if status == model.RequestStatusCompleted {
+		for _, out := range task.Output {
+			if out.Type.Text != OutputPatient || out.ValueReference == nil {
+				continue
+			}
+			response.FHIRPatient = findContained(task.Contained, out.ValueReference.Reference)
+		}
+		if len(response.FHIRPatient) == 0 {
+			return nil, ErrTaskMissingOutput
+		}
+	}
+
+	return response, nil
+}
+
+// resourceReference builds a reference to a returned FHIR resource.
+func resourceReference(resource json.RawMessage, fallbackType string) *fhir.Reference {
+	var header struct {
+		ResourceType string `json:"resourceType"`
+		ID           string `json:"id"`
+	}
+	json.Unmarshal(resource, &header)
+	if header.ResourceType == "" {
+		header.ResourceType = fallbackType
+	}
+
+	ref := &fhir.Reference{Type: header.ResourceType}
+	if header.ID != "" {
+		ref.Reference = header.ResourceType + "/" + header.ID
+	} else {
+		ref.Display = header.ResourceType + " returned by target provider"
+	}
+	return ref
+}
+
+func findContained(contained []json.RawMessage, reference string) json.RawMessage {
+	id := strings.TrimPrefix(reference, "#")
+	for _, c := range contained {
+		var header struct {
+			ID string `json:"id"`
+		}
+		if json.Unmarshal(c, &header) == nil && header.ID == id {
+			return c
+		}
+	}
+	return nil
+}
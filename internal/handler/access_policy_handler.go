@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/service"
+)
+
+type AccessPolicyHandler struct {
+	svc *service.AccessPolicyService
+}
+
+func NewAccessPolicyHandler(svc *service.AccessPolicyService) *AccessPolicyHandler {
+	return &AccessPolicyHandler{svc: svc}
+}
+
+type AccessPolicyRequest struct {
+	TargetProviderID string                 `json:"targetProviderId"`
+	Description      string                 `json:"description,omitempty"`
+	Requestors       model.PolicyRequestors `json:"requestors"`
+	ResourceTypes    []string               `json:"resourceTypes,omitempty"`
+}
+
+// GetPolicies lists access policies, optionally of one target
+func (h *AccessPolicyHandler) GetPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := h.svc.ListPolicies(r.URL.Query().Get("targetProviderId"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"policies": policies,
+		"count":    len(policies),
+	})
+}
+
+func (h *AccessPolicyHandler) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := h.svc.GetPolicy(chi.URLParam(r, "id"))
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+// CreatePolicy adds a policy to a target. From then on the target only
+// accepts requests one of its policies permits.
+func (h *AccessPolicyHandler) CreatePolicy(w http.ResponseWriter, r *http.Request) {
+	var req AccessPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.TargetProviderID == "" {
+		writeError(w, http.StatusBadRequest, "targetProviderId is required")
+		return
+	}
+
+	policy, err := h.svc.CreatePolicy(policyInput(req))
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, policy)
+}
+
+// UpdatePolicy replaces a policy's rules
+func (h *AccessPolicyHandler) UpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	var req AccessPolicyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	policy, err := h.svc.GetPolicy(chi.URLParam(r, "id"))
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+	if req.TargetProviderID != "" && req.TargetProviderID != policy.TargetProviderID {
+		writeError(w, http.StatusBadRequest, "targetProviderId cannot be changed")
+		return
+	}
+
+	policy, err = h.svc.UpdatePolicy(policy.PolicyID, policyInput(req))
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, policy)
+}
+
+func (h *AccessPolicyHandler) DeletePolicy(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.DeletePolicy(chi.URLParam(r, "id")); err != nil {
+		writePolicyError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDecisions lists recorded policy decisions for audits
+func (h *AccessPolicyHandler) GetDecisions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	decisions, err := h.svc.ListDecisions(service.PolicyDecisionFilter{
+		TargetProviderID:    query.Get("targetProviderId"),
+		RequestorProviderID: query.Get("requestorProviderId"),
+		Decision:            model.PolicyEffect(query.Get("decision")),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"decisions": decisions,
+		"count":     len(decisions),
+	})
+}
+
+func (h *AccessPolicyHandler) GetDecision(w http.ResponseWriter, r *http.Request) {
+	decision, err := h.svc.GetDecision(chi.URLParam(r, "id"))
+	if err != nil {
+		writePolicyError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, decision)
+}
+
+func policyInput(req AccessPolicyRequest) service.AccessPolicyInput {
+	return service.AccessPolicyInput{
+		TargetProviderID: req.TargetProviderID,
+		Description:      req.Description,
+		Requestors:       req.Requestors,
+		ResourceTypes:    req.ResourceTypes,
+	}
+}
+
+func writePolicyError(w http.ResponseWriter, err error) {
+	switch err {
+	case service.ErrAccessPolicyNotFound:
+		writeError(w, http.StatusNotFound, "access policy not found")
+	case service.ErrPolicyDecisionNotFound:
+		writeError(w, http.StatusNotFound, "policy decision not found")
+	case service.ErrTargetNotFound:
+		writeError(w, http.StatusBadRequest, "target provider not found")
+	case service.ErrPolicyRequestorsRequired:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
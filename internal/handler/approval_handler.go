@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/service"
+)
+
+type ApprovalHandler struct {
+	svc        *service.ApprovalService
+	patientSvc *service.PatientService
+}
+
+func NewApprovalHandler(svc *service.ApprovalService, patientSvc *service.PatientService) *ApprovalHandler {
+	return &ApprovalHandler{svc: svc, patientSvc: patientSvc}
+}
+
+// approvalSummary is an Approval as the API returns it. The reviewers and
+// the patient reference are not disclosed.
+type approvalSummary struct {
+	ApprovalID          string                 `json:"approvalId"`
+	RequestID           string                 `json:"requestId"`
+	RequestorProviderID string                 `json:"requestorProviderId"`
+	TargetProviderID    string                 `json:"targetProviderId"`
+	PurposeOfUse        model.PurposeOfUse     `json:"purposeOfUse,omitempty"`
+	Status              model.ApprovalStatus   `json:"status"`
+	CreatedAt           string                 `json:"createdAt"`
+	Decision            model.ApprovalDecision `json:"decision,omitempty"`
+	DecidedBy           string                 `json:"decidedBy,omitempty"`
+	Reason              string                 `json:"reason,omitempty"`
+	DecidedAt           string                 `json:"decidedAt,omitempty"`
+}
+
+func summarizeApproval(a model.Approval) approvalSummary {
+	return approvalSummary{
+		ApprovalID:          a.ApprovalID,
+		RequestID:           a.RequestID,
+		RequestorProviderID: a.RequestorProviderID,
+		TargetProviderID:    a.TargetProviderID,
+		PurposeOfUse:        a.PurposeOfUse,
+		Status:              a.Status,
+		CreatedAt:           a.CreatedAt,
+		Decision:            a.Decision,
+		DecidedBy:           a.DecidedBy,
+		Reason:              a.Reason,
+		DecidedAt:           a.DecidedAt,
+	}
+}
+
+// GetApprovals lists the calling target's approvals, e.g. a reviewer's
+// pending work queue
+func (h *ApprovalHandler) GetApprovals(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	targetProviderID, ok := callerID(r, query.Get("targetProviderId"))
+	if !ok {
+		writeError(w, http.StatusForbidden, "targetProviderId must be the calling provider")
+		return
+	}
+	approvals, err := h.svc.ListApprovals(service.ApprovalFilter{
+		Status:              model.ApprovalStatus(query.Get("status")),
+		TargetProviderID:    targetProviderID,
+		RequestorProviderID: query.Get("requestorProviderId"),
+		RequestID:           query.Get("requestId"),
+		Reviewer:            query.Get("reviewer"),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	summaries := make([]approvalSummary, 0, len(approvals))
+	for _, a := range approvals {
+		summaries = append(summaries, summarizeApproval(a))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"approvals": summaries,
+		"count":     len(summaries),
+	})
+}
+
+// GetApproval returns one of the calling target's approvals
+func (h *ApprovalHandler) GetApproval(w http.ResponseWriter, r *http.Request) {
+	approval, err := h.svc.GetApproval(chi.URLParam(r, "id"))
+	if err != nil {
+		switch err {
+		case service.ErrApprovalNotFound:
+			writeError(w, http.StatusNotFound, "approval not found")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if approval.TargetProviderID != authenticatedProvider(r).ProviderID {
+		writeError(w, http.StatusForbidden, "only the target provider may read this approval")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, summarizeApproval(*approval))
+}
+
+type ApprovalDecisionRequest struct {
+	Decision model.ApprovalDecision `json:"decision"`
+	Reason   string                 `json:"reason,omitempty"`
+}
+
+// Decide approves or denies a held request on behalf of the calling target
+func (h *ApprovalHandler) Decide(w http.ResponseWriter, r *http.Request) {
+	var req ApprovalDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	approval, err := h.patientSvc.DecideApproval(chi.URLParam(r, "id"), service.ApprovalDecisionInput{
+		DecidedBy: authenticatedProvider(r).ProviderID,
+		Decision:  req.Decision,
+		Reason:    req.Reason,
+	})
+	if err != nil {
+		switch err {
+		case service.ErrApprovalNotFound:
+			writeError(w, http.StatusNotFound, "approval not found")
+		case service.ErrInvalidDecision, service.ErrDenialReasonRequired:
+			writeError(w, http.StatusBadRequest, err.Error())
+		case service.ErrNotApprovalTarget:
+			writeError(w, http.StatusForbidden, err.Error())
+		case service.ErrApprovalDecided:
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, summarizeApproval(*approval))
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/fhirmap"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/service"
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+type AuditHandler struct {
+	svc *service.AuditService
+}
+
+func NewAuditHandler(svc *service.AuditService) *AuditHandler {
+	return &AuditHandler{svc: svc}
+}
+
+// GetAuditEvents exports the audit trail as a Bundle of FHIR AuditEvents
+func (h *AuditHandler) GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := service.AuditFilter{
+		Action:     model.AuditAction(query.Get("action")),
+		ProviderID: query.Get("providerId"),
+		RequestID:  query.Get("requestId"),
+	}
+
+	var err error
+	if filter.From, err = parseAuditTime(query.Get("from"), false); err != nil {
+		writeError(w, http.StatusBadRequest, "from must be a date or RFC 3339 timestamp")
+		return
+	}
+	if filter.To, err = parseAuditTime(query.Get("to"), true); err != nil {
+		writeError(w, http.StatusBadRequest, "to must be a date or RFC 3339 timestamp")
+		return
+	}
+
+	entries, err := h.svc.ListEntries(filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	events := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		events = append(events, fhirmap.AuditEventFromEntry(entry))
+	}
+	writeFHIR(w, http.StatusOK, fhir.NewSearchBundle(events))
+}
+
+// VerifyAuditTrail recomputes the hash chain and reports the first broken
+// entry. The optional head parameter is a head reported by an earlier check.
+func (h *AuditHandler) VerifyAuditTrail(w http.ResponseWriter, r *http.Request) {
+	result, err := h.svc.Verify(r.URL.Query().Get("head"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// parseAuditTime accepts RFC 3339 timestamps and plain dates. A plain date
+// used as an upper bound covers the whole day.
+func parseAuditTime(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return t, nil
+}
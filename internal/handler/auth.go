@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/service"
+)
+
+// Auth guards gateway operator endpoints with a shared admin token and
+// provider endpoints with the provider's API key. Both are sent as
+// "Authorization: Bearer <token>". Without a configured admin token every
+// admin call is refused.
+type Auth struct {
+	adminToken string
+	providers  *service.ProviderService
+}
+
+func NewAuth(adminToken string, providers *service.ProviderService) *Auth {
+	return &Auth{adminToken: adminToken, providers: providers}
+}
+
+type providerContextKey struct{}
+
+// IsAdmin reports whether r carries the admin token.
+func (a *Auth) IsAdmin(r *http.Request) bool {
+	token := bearerToken(r)
+	return a.adminToken != "" && token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) == 1
+}
+
+// RequireAdmin rejects requests without the admin token.
+func (a *Auth) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.IsAdmin(r) {
+			writeAdminRequired(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireProvider rejects requests without the API key of an active
+// provider, and makes the provider available to the handler through
+// authenticatedProvider.
+func (a *Auth) RequireProvider(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider, err := a.providers.AuthenticateProvider(bearerToken(r))
+		switch {
+		case err == service.ErrInvalidAPIKey:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="wah4pc"`)
+			writeError(w, http.StatusUnauthorized, "provider API key required")
+			return
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		case !provider.IsActive():
+			writeError(w, http.StatusForbidden, "provider "+provider.ProviderID+" is not active")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), providerContextKey{}, provider)))
+	})
+}
+
+// RequireProviderOrAdmin admits the admin token as well as the API keys
+// RequireProvider admits. authenticatedProvider is nil for the admin.
+func (a *Auth) RequireProviderOrAdmin(next http.Handler) http.Handler {
+	provider := a.RequireProvider(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.IsAdmin(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		provider.ServeHTTP(w, r)
+	})
+}
+
+// RequireOwnerOrAdmin admits the admin token and the API key of the
+// provider named by the {id} URL parameter. Providers that are pending
+// approval or suspended may still manage their own registration;
+// deactivated ones may not.
+func (a *Auth) RequireOwnerOrAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.IsAdmin(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		provider, err := a.providers.AuthenticateProvider(bearerToken(r))
+		switch {
+		case err == service.ErrInvalidAPIKey:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="wah4pc"`)
+			writeError(w, http.StatusUnauthorized, "the provider's API key or the admin token is required")
+			return
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		case provider.ProviderID != chi.URLParam(r, "id"):
+			writeError(w, http.StatusForbidden, "providers may only manage their own registration")
+			return
+		case provider.Status == model.ProviderStatusDeactivated:
+			writeError(w, http.StatusForbidden, "provider "+provider.ProviderID+" is deactivated")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), providerContextKey{}, provider)))
+	})
+}
+
+// authenticatedProvider is the caller of a route behind RequireProvider or
+// RequireProviderOrAdmin, or the provider itself behind RequireOwnerOrAdmin.
+// It is nil for the admin.
+func authenticatedProvider(r *http.Request) *model.Provider {
+	provider, _ := r.Context().Value(providerContextKey{}).(*model.Provider)
+	return provider
+}
+
+// restrictedTo is the provider a request behind RequireProviderOrAdmin
+// acts for, or "" for the admin.
+func restrictedTo(r *http.Request) string {
+	if provider := authenticatedProvider(r); provider != nil {
+		return provider.ProviderID
+	}
+	return ""
+}
+
+// callerID checks a provider ID named in a request against the
+// authenticated provider. An empty ID stands for the caller.
+func callerID(r *http.Request, id string) (string, bool) {
+	caller := authenticatedProvider(r).ProviderID
+	if id == "" {
+		return caller, true
+	}
+	return id, id == caller
+}
+
+func writeAdminRequired(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="wah4pc-admin"`)
+	writeError(w, http.StatusUnauthorized, "admin token required")
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/service"
+)
+
+type BreakGlassHandler struct {
+	svc *service.BreakGlassService
+}
+
+func NewBreakGlassHandler(svc *service.BreakGlassService) *BreakGlassHandler {
+	return &BreakGlassHandler{svc: svc}
+}
+
+// GetReviews lists break-glass accesses for audit
+func (h *BreakGlassHandler) GetReviews(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	reviews, err := h.svc.ListReviews(service.BreakGlassFilter{
+		Status:              model.BreakGlassReviewStatus(query.Get("status")),
+		RequestorProviderID: query.Get("requestorProviderId"),
+		TargetProviderID:    query.Get("targetProviderId"),
+		Overdue:             query.Get("overdue") == "true",
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"reviews": reviews,
+		"count":   len(reviews),
+	})
+}
+
+func (h *BreakGlassHandler) GetReview(w http.ResponseWriter, r *http.Request) {
+	review, err := h.svc.GetReview(chi.URLParam(r, "id"))
+	if err != nil {
+		switch err {
+		case service.ErrBreakGlassReviewNotFound:
+			writeError(w, http.StatusNotFound, "break-glass review not found")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, review)
+}
+
+type CompleteReviewRequest struct {
+	Reviewer string                  `json:"reviewer"`
+	Outcome  model.BreakGlassOutcome `json:"outcome"`
+	Notes    string                  `json:"notes,omitempty"`
+}
+
+// CompleteReview records the post-hoc assessment of a break-glass access
+func (h *BreakGlassHandler) CompleteReview(w http.ResponseWriter, r *http.Request) {
+	var req CompleteReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if req.Reviewer == "" {
+		writeError(w, http.StatusBadRequest, "reviewer is required")
+		return
+	}
+
+	review, err := h.svc.CompleteReview(chi.URLParam(r, "id"), service.CompleteReviewInput{
+		Reviewer: req.Reviewer,
+		Outcome:  req.Outcome,
+		Notes:    req.Notes,
+	})
+	if err != nil {
+		switch err {
+		case service.ErrBreakGlassReviewNotFound:
+			writeError(w, http.StatusNotFound, "break-glass review not found")
+		case service.ErrInvalidBreakGlassOutcome:
+			writeError(w, http.StatusBadRequest, err.Error())
+		case service.ErrBreakGlassAlreadyReviewed:
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, review)
+}
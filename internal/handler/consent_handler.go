@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/service"
+)
+
+type ConsentHandler struct {
+	svc *service.ConsentService
+}
+
+func NewConsentHandler(svc *service.ConsentService) *ConsentHandler {
+	return &ConsentHandler{svc: svc}
+}
+
+// CreateConsent registers a FHIR Consent resource. Providers register the
+// consents they hold as custodian.
+func (h *ConsentHandler) CreateConsent(w http.ResponseWriter, r *http.Request) {
+	var resource json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&resource); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	consent, err := h.svc.RegisterConsent(resource, restrictedTo(r))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidIdentifier) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		switch err {
+		case service.ErrInvalidConsent:
+			writeError(w, http.StatusBadRequest, "body must be a FHIR Consent with patient.identifier and provision.type permit or deny")
+		case service.ErrNotConsentHolder:
+			writeError(w, http.StatusForbidden, "organization must reference the calling provider")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, consent)
+}
+
+// GetConsents lists consents, optionally filtered by patient identifier
+func (h *ConsentHandler) GetConsents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	consents, err := h.svc.ListConsents(model.PatientIdentifier{
+		System: query.Get("system"),
+		Value:  query.Get("value"),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, consents)
+}
+
+// GetConsent returns a consent to the admin or the provider holding it
+func (h *ConsentHandler) GetConsent(w http.ResponseWriter, r *http.Request) {
+	consent, err := h.svc.GetConsent(chi.URLParam(r, "id"))
+	if err != nil {
+		switch err {
+		case service.ErrConsentNotFound:
+			writeError(w, http.StatusNotFound, "consent not found")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if holder := restrictedTo(r); holder != "" && consent.TargetProviderID != holder {
+		writeError(w, http.StatusForbidden, service.ErrNotConsentHolder.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, consent)
+}
+
+// RevokeConsent deactivates a consent; the record is kept
+func (h *ConsentHandler) RevokeConsent(w http.ResponseWriter, r *http.Request) {
+	consent, err := h.svc.RevokeConsent(chi.URLParam(r, "id"), restrictedTo(r))
+	if err != nil {
+		switch err {
+		case service.ErrConsentNotFound:
+			writeError(w, http.StatusNotFound, "consent not found")
+		case service.ErrNotConsentHolder:
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, consent)
+}
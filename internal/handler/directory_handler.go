@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wah4pc/gateway/internal/fhirmap"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/service"
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+// DirectoryHandler exports the provider directory as FHIR Organization and
+// Endpoint resources, so provider systems can sync it.
+type DirectoryHandler struct {
+	svc *service.ProviderService
+}
+
+func NewDirectoryHandler(svc *service.ProviderService) *DirectoryHandler {
+	return &DirectoryHandler{svc: svc}
+}
+
+// SearchOrganizations supports the name, type, address, address-state and
+// active search parameters, _count/_offset paging and
+// _include=Organization:endpoint.
+func (h *DirectoryHandler) SearchOrganizations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := service.ProviderFilter{
+		Type:     model.ProviderType(query.Get("type")),
+		Name:     query.Get("name"),
+		Location: query.Get("address"),
+		Region:   query.Get("address-state"),
+	}
+	switch query.Get("active") {
+	case "":
+	case "true", "false":
+		active := query.Get("active") == "true"
+		filter.Active = &active
+	default:
+		writeOutcome(w, http.StatusBadRequest, "value", "active must be true or false")
+		return
+	}
+
+	var ok bool
+	if filter.Offset, filter.Limit, ok = pageParams(query); !ok {
+		writeOutcome(w, http.StatusBadRequest, "value", "_count and _offset must be non-negative numbers")
+		return
+	}
+
+	providers, total, err := h.svc.SearchProviders(filter)
+	if err != nil {
+		writeOutcome(w, http.StatusInternalServerError, "exception", err.Error())
+		return
+	}
+
+	organizations := make([]interface{}, 0, len(providers))
+	var endpoints []interface{}
+	for i := range providers {
+		organizations = append(organizations, fhirmap.OrganizationFromProvider(&providers[i].Provider))
+		if query.Get("_include") == "Organization:endpoint" {
+			for _, e := range fhirmap.EndpointsFromProvider(&providers[i].Provider) {
+				endpoints = append(endpoints, e)
+			}
+		}
+	}
+
+	bundle := searchPage(r, organizations, total, filter.Offset, filter.Limit)
+	bundle.Include(endpoints)
+	writeFHIR(w, http.StatusOK, bundle)
+}
+
+func (h *DirectoryHandler) ReadOrganization(w http.ResponseWriter, r *http.Request) {
+	provider, err := h.svc.GetProvider(chi.URLParam(r, "id"))
+	if err != nil {
+		writeDirectoryError(w, err, "Organization")
+		return
+	}
+
+	writeFHIR(w, http.StatusOK, fhirmap.OrganizationFromProvider(provider))
+}
+
+// SearchEndpoints supports the organization and status search parameters
+// and _count/_offset paging.
+func (h *DirectoryHandler) SearchEndpoints(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	offset, limit, ok := pageParams(query)
+	if !ok {
+		writeOutcome(w, http.StatusBadRequest, "value", "_count and _offset must be non-negative numbers")
+		return
+	}
+
+	providers, _, err := h.svc.SearchProviders(service.ProviderFilter{})
+	if err != nil {
+		writeOutcome(w, http.StatusInternalServerError, "exception", err.Error())
+		return
+	}
+
+	organization := referenceParam(query.Get("organization"))
+	status := query.Get("status")
+	var matches []interface{}
+	for i := range providers {
+		if organization != "" && providers[i].ProviderID != organization {
+			continue
+		}
+		for _, e := range fhirmap.EndpointsFromProvider(&providers[i].Provider) {
+			if status == "" || e.Status == status {
+				matches = append(matches, e)
+			}
+		}
+	}
+
+	total := len(matches)
+	if offset > total {
+		offset = total
+	}
+	page := matches[offset:]
+	if limit > 0 && limit < len(page) {
+		page = page[:limit]
+	}
+	writeFHIR(w, http.StatusOK, searchPage(r, page, total, offset, limit))
+}
+
+func (h *DirectoryHandler) ReadEndpoint(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	// Subscription IDs may contain "-", so the provider cannot be told
+	// from the Endpoint id alone.
+	providers, err := h.svc.GetAllProviders()
+	if err != nil {
+		writeOutcome(w, http.StatusInternalServerError, "exception", err.Error())
+		return
+	}
+	for i := range providers {
+		if !strings.HasPrefix(id, providers[i].ProviderID+"-") {
+			continue
+		}
+		for _, e := range fhirmap.EndpointsFromProvider(&providers[i]) {
+			if e.ID == id {
+				writeFHIR(w, http.StatusOK, e)
+				return
+			}
+		}
+	}
+	writeOutcome(w, http.StatusNotFound, "not-found", "Endpoint not found")
+}
+
+// pageParams reads _offset and _count; a _count of 0 means no limit.
+func pageParams(query url.Values) (offset, limit int, ok bool) {
+	if offset, ok = queryCount(query.Get("_offset")); !ok {
+		return 0, 0, false
+	}
+	limit, ok = queryCount(query.Get("_count"))
+	return offset, limit, ok
+}
+
+// searchPage wraps one page of matches in a searchset Bundle with the
+// total and self/next links.
+func searchPage(r *http.Request, resources []interface{}, total, offset, limit int) *fhir.Bundle {
+	bundle := fhir.NewSearchBundle(resources)
+	bundle.Total = total
+	bundle.Link = []fhir.BundleLink{{Relation: "self", URL: r.URL.RequestURI()}}
+	if limit > 0 && offset+limit < total {
+		next := *r.URL
+		query := next.Query()
+		query.Set("_offset", strconv.Itoa(offset+limit))
+		next.RawQuery = query.Encode()
+		bundle.Link = append(bundle.Link, fhir.BundleLink{Relation: "next", URL: next.RequestURI()})
+	}
+	return bundle
+}
+
+func writeDirectoryError(w http.ResponseWriter, err error, resourceType string) {
+	switch err {
+	case service.ErrProviderNotFound:
+		writeOutcome(w, http.StatusNotFound, "not-found", resourceType+" not found")
+	default:
+		writeOutcome(w, http.StatusInternalServerError, "exception", err.Error())
+	}
+}
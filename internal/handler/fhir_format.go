@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"mime"
+
+	"github.com/wah4pc/gateway/internal/model"
+)
+
+// isFHIRXML reports whether a Content-Type header denotes a FHIR XML body.
+func isFHIRXML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/fhir+xml" || mediaType == "application/xml" || mediaType == "text/xml"
+}
+
+// parseFHIRFormat interprets the FHIR _format parameter. An empty value
+// yields an empty format, meaning the provider's preference applies.
+func parseFHIRFormat(value string) (model.FHIRFormat, bool) {
+	switch value {
+	case "":
+		return "", true
+	case "json", "application/json", "application/fhir+json":
+		return model.FHIRFormatJSON, true
+	case "xml", "application/xml", "text/xml", "application/fhir+xml":
+		return model.FHIRFormatXML, true
+	default:
+		return "", false
+	}
+}
+
+// fhirVersionParam returns the fhirVersion parameter of a FHIR media type.
+func fhirVersionParam(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return params["fhirversion"]
+}
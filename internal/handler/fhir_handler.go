@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wah4pc/gateway/internal/fhirmap"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+	"github.com/wah4pc/gateway/internal/service"
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+// FHIRHandler serves a FHIR-conformant facade over PatientService so that
+// standard FHIR clients can create and track patient data exchanges.
+type FHIRHandler struct {
+	svc *service.PatientService
+}
+
+func NewFHIRHandler(svc *service.PatientService) *FHIRHandler {
+	return &FHIRHandler{svc: svc}
+}
+
+func (h *FHIRHandler) Metadata(w http.ResponseWriter, r *http.Request) {
+	writeFHIR(w, http.StatusOK, fhirmap.CapabilityStatement())
+}
+
+// RequestPatient implements the Patient/$request operation. The input is a
+// Parameters resource; the output is the Task tracking the exchange.
+func (h *FHIRHandler) RequestPatient(w http.ResponseWriter, r *http.Request) {
+	var params fhir.Parameters
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil || params.ResourceType != "Parameters" {
+		writeOutcome(w, http.StatusBadRequest, "structure", "body must be a Parameters resource")
+		return
+	}
+
+	input := service.CreateRequestInput{
+		RequestorProviderID: params.GetString("requestor"),
+		TargetProviderID:    params.GetString("target"),
+		CorrelationKey:      params.GetString("correlationKey"),
+		PatientReference: model.PatientReference{
+			ID: params.GetString("patient"),
+		},
+		FHIRConstraints: model.FHIRConstraints{
+			ResourceType: params.GetString("resourceType"),
+			Version:      params.GetString("version"),
+			Elements:     splitList(params.GetString("elements")),
+			PurposeOfUse: model.PurposeOfUse(params.GetString("purposeOfUse")),
+			Profile:      params.GetString("profile"),
+		},
+		Metadata: model.RequestMetadata{
+			Reason: params.GetString("reason"),
+			Notes:  params.GetString("notes"),
+		},
+	}
+	for _, p := range params.Get("identifier") {
+		if p.ValueIdentifier != nil {
+			input.PatientReference.Identifiers = append(input.PatientReference.Identifiers, model.PatientIdentifier{
+				System: p.ValueIdentifier.System,
+				Value:  p.ValueIdentifier.Value,
+			})
+		}
+	}
+
+	requestorID, ok := callerID(r, input.RequestorProviderID)
+	if !ok {
+		writeOutcome(w, http.StatusForbidden, "forbidden", "requestor must be the calling provider")
+		return
+	}
+	input.RequestorProviderID = requestorID
+	if input.TargetProviderID == "" {
+		writeOutcome(w, http.StatusBadRequest, "required", "target parameter is required")
+		return
+	}
+
+	request, err := h.svc.CreateRequest(input)
+	if err != nil {
+		writeCreateRequestOutcome(w, err, request)
+		return
+	}
+
+	w.Header().Set("Location", "Task/"+request.RequestID)
+	writeFHIR(w, http.StatusCreated, fhirmap.TaskFromRequest(request, nil))
+}
+
+func (h *FHIRHandler) ReadTask(w http.ResponseWriter, r *http.Request) {
+	request, response, err := h.svc.GetRequest(chi.URLParam(r, "id"))
+	if err != nil {
+		switch err {
+		case repository.ErrRequestNotFound:
+			writeOutcome(w, http.StatusNotFound, "not-found", "Task not found")
+		default:
+			writeOutcome(w, http.StatusInternalServerError, "exception", err.Error())
+		}
+		return
+	}
+	if !isParty(r, request) {
+		writeOutcome(w, http.StatusForbidden, "forbidden", "only the Task requester and owner may read it")
+		return
+	}
+
+	writeFHIR(w, http.StatusOK, fhirmap.TaskFromRequest(request, response))
+}
+
+// isParty reports whether the caller is the requestor or target of request.
+func isParty(r *http.Request, request *model.PatientRequest) bool {
+	caller := authenticatedProvider(r).ProviderID
+	return caller == request.RequestorProviderID || caller == request.TargetProviderID
+}
+
+// SearchTasks supports the owner, requester, status and identifier search
+// parameters. Only Tasks the caller is the requester or owner of are found.
+func (h *FHIRHandler) SearchTasks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := service.RequestFilter{
+		RequestorProviderID: referenceParam(query.Get("requester")),
+		TargetProviderID:    referenceParam(query.Get("owner")),
+		ProviderID:          authenticatedProvider(r).ProviderID,
+	}
+
+	if status := query.Get("status"); status != "" {
+		requestStatus, ok := fhirmap.RequestStatus(status)
+		if !ok {
+			writeOutcome(w, http.StatusBadRequest, "value", "unsupported Task status: "+status)
+			return
+		}
+		filter.Status = requestStatus
+	}
+
+	if identifier := query.Get("identifier"); identifier != "" {
+		system, value, found := strings.Cut(identifier, "|")
+		if !found {
+			system, value = fhirmap.SystemRequestID, identifier
+		}
+		switch system {
+		case fhirmap.SystemRequestID, "":
+			filter.RequestID = value
+		case fhirmap.SystemCorrelationKey:
+			filter.CorrelationKey = value
+		default:
+			writeOutcome(w, http.StatusBadRequest, "value", "unsupported identifier system: "+system)
+			return
+		}
+	}
+
+	records, err := h.svc.SearchRequests(filter)
+	if err != nil {
+		writeOutcome(w, http.StatusInternalServerError, "exception", err.Error())
+		return
+	}
+
+	resources := make([]interface{}, 0, len(records))
+	for i := range records {
+		resources = append(resources, fhirmap.TaskFromRequest(&records[i].Request, records[i].Response))
+	}
+	writeFHIR(w, http.StatusOK, fhir.NewSearchBundle(resources))
+}
+
+// CreateTask creates a patient request from a Task resource.
+func (h *FHIRHandler) CreateTask(w http.ResponseWriter, r *http.Request) {
+	var task fhir.Task
+	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+		writeOutcome(w, http.StatusBadRequest, "structure", "body must be a Task resource")
+		return
+	}
+
+	parsed, err := fhirmap.RequestFromTask(&task)
+	if err != nil {
+		writeOutcome(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	if _, ok := callerID(r, parsed.RequestorProviderID); !ok {
+		writeOutcome(w, http.StatusForbidden, "forbidden", "Task.requester must be the calling provider")
+		return
+	}
+
+	request, err := h.svc.CreateRequest(service.CreateRequestInput{
+		RequestorProviderID: parsed.RequestorProviderID,
+		TargetProviderID:    parsed.TargetProviderID,
+		CorrelationKey:      parsed.CorrelationKey,
+		PatientReference:    parsed.PatientReference,
+		FHIRConstraints:     parsed.FHIRConstraints,
+		Metadata:            parsed.Metadata,
+	})
+	if err != nil {
+		writeCreateRequestOutcome(w, err, request)
+		return
+	}
+
+	w.Header().Set("Location", "Task/"+request.RequestID)
+	writeFHIR(w, http.StatusCreated, fhirmap.TaskFromRequest(request, nil))
+}
+
+// UpdateTask lets the owner complete or fail a Task, which is equivalent
+// to submitting a response through /v1/fhir/patient/respond.
+func (h *FHIRHandler) UpdateTask(w http.ResponseWriter, r *http.Request) {
+	var task fhir.Task
+	if err := json.NewDecoder(r.Body).Decode(&task); err != nil {
+		writeOutcome(w, http.StatusBadRequest, "structure", "body must be a Task resource")
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	if task.ID != id {
+		writeOutcome(w, http.StatusBadRequest, "invalid", "Task.id must match the request URL")
+		return
+	}
+
+	parsed, err := fhirmap.ResponseFromTask(&task)
+	if err != nil {
+		writeOutcome(w, http.StatusBadRequest, "invalid", err.Error())
+		return
+	}
+	fromProviderID, ok := callerID(r, parsed.FromProviderID)
+	if !ok {
+		writeOutcome(w, http.StatusForbidden, "forbidden", "Task.owner must be the calling provider")
+		return
+	}
+
+	_, err = h.svc.ReceiveResponse(service.ReceiveResponseInput{
+		RequestID:      parsed.RequestID,
+		FromProviderID: fromProviderID,
+		FHIRPatient:    parsed.FHIRPatient,
+		FHIRVersion:    fhirVersionParam(r.Header.Get("Content-Type")),
+		Status:         parsed.Status,
+		Error:          parsed.Error,
+	})
+	if err != nil {
+		switch err {
+		case repository.ErrRequestNotFound:
+			writeOutcome(w, http.StatusNotFound, "not-found", "Task not found")
+		case service.ErrInvalidFromProvider:
+			writeOutcome(w, http.StatusForbidden, "forbidden", "only the Task owner may update it")
+		case service.ErrRequestClosed:
+			writeOutcome(w, http.StatusConflict, "conflict", err.Error())
+		case service.ErrTargetInactive:
+			writeOutcome(w, http.StatusForbidden, "forbidden", err.Error())
+		case service.ErrUnsupportedFHIRVersion, service.ErrFHIRVersionMismatch:
+			writeOutcome(w, http.StatusUnprocessableEntity, "not-supported", err.Error())
+		case service.ErrInvalidFHIRResource:
+			writeOutcome(w, http.StatusBadRequest, "structure", err.Error())
+		default:
+			writeOutcome(w, http.StatusInternalServerError, "exception", err.Error())
+		}
+		return
+	}
+
+	request, response, err := h.svc.GetRequest(id)
+	if err != nil {
+		writeOutcome(w, http.StatusInternalServerError, "exception", err.Error())
+		return
+	}
+	writeFHIR(w, http.StatusOK, fhirmap.TaskFromRequest(request, response))
+}
+
+// splitList splits a comma separated parameter value.
+func splitList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// referenceParam accepts "Organization/{id}" or a bare provider ID.
+func referenceParam(value string) string {
+	return strings.TrimPrefix(value, "Organization/")
+}
+
+// writeCreateRequestOutcome reports a failed CreateRequest as an
+// OperationOutcome.
+func writeCreateRequestOutcome(w http.ResponseWriter, err error, request *model.PatientRequest) {
+	status, code := createRequestStatus(err)
+	diagnostics := err.Error()
+	if err == service.ErrConsentDenied {
+		diagnostics += " (Task/" + request.RequestID + ")"
+	}
+	writeOutcome(w, status, code, diagnostics)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/service"
+)
+
+type IdentifierSystemHandler struct {
+	svc *service.IdentifierSystemService
+}
+
+func NewIdentifierSystemHandler(svc *service.IdentifierSystemService) *IdentifierSystemHandler {
+	return &IdentifierSystemHandler{svc: svc}
+}
+
+func (h *IdentifierSystemHandler) GetSystems(w http.ResponseWriter, r *http.Request) {
+	systems, err := h.svc.ListSystems()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, systems)
+}
+
+func (h *IdentifierSystemHandler) CreateSystem(w http.ResponseWriter, r *http.Request) {
+	var req model.IdentifierSystem
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	system, err := h.svc.RegisterSystem(req)
+	if err != nil {
+		writeIdentifierSystemError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, system)
+}
+
+// UpdateSystem replaces the registered system with the body's uri
+func (h *IdentifierSystemHandler) UpdateSystem(w http.ResponseWriter, r *http.Request) {
+	var req model.IdentifierSystem
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	system, err := h.svc.UpdateSystem(req)
+	if err != nil {
+		writeIdentifierSystemError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, system)
+}
+
+func writeIdentifierSystemError(w http.ResponseWriter, err error) {
+	switch err {
+	case service.ErrInvalidIdentifierSystem:
+		writeError(w, http.StatusBadRequest, err.Error())
+	case service.ErrIdentifierSystemNotFound:
+		writeError(w, http.StatusNotFound, err.Error())
+	case service.ErrIdentifierSystemAlreadyExists, service.ErrIdentifierAliasConflict:
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/wah4pc/gateway/internal/fhirmap"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/service"
+)
+
+type MatchHandler struct {
+	svc *service.MatchService
+}
+
+func NewMatchHandler(svc *service.MatchService) *MatchHandler {
+	return &MatchHandler{svc: svc}
+}
+
+type MatchRequest struct {
+	Demographics     *model.Demographics      `json:"demographics,omitempty"`
+	Patient          json.RawMessage          `json:"patient,omitempty"`
+	Candidates       []service.MatchCandidate `json:"candidates,omitempty"`
+	TargetProviderID string                   `json:"targetProviderId,omitempty"`
+	MinScore         float64                  `json:"minScore,omitempty"`
+	Limit            int                      `json:"limit,omitempty"`
+}
+
+// Match scores the supplied candidates, or the MPI persons known to the
+// target when none are given, against the query demographics
+func (h *MatchHandler) Match(w http.ResponseWriter, r *http.Request) {
+	var req MatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	demographics := req.Demographics
+	if demographics == nil && len(req.Patient) > 0 {
+		demographics = fhirmap.DemographicsFromPatient(req.Patient)
+	}
+	if demographics == nil {
+		writeError(w, http.StatusBadRequest, "demographics or a FHIR Patient is required")
+		return
+	}
+	if req.MinScore < 0 || req.MinScore > 1 || req.Limit < 0 {
+		writeError(w, http.StatusBadRequest, "minScore must be between 0 and 1 and limit must not be negative")
+		return
+	}
+
+	matches, err := h.svc.Match(service.MatchInput{
+		ProviderID:       authenticatedProvider(r).ProviderID,
+		Demographics:     *demographics,
+		Candidates:       req.Candidates,
+		TargetProviderID: req.TargetProviderID,
+		MinScore:         req.MinScore,
+		Limit:            req.Limit,
+	})
+	if err != nil {
+		switch err {
+		case service.ErrMatchQueryIncomplete, service.ErrInvalidMatchCandidate, service.ErrMatchScopeRequired:
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"matches": matches,
+		"count":   len(matches),
+	})
+}
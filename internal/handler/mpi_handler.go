@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/service"
+)
+
+type MPIHandler struct {
+	svc *service.MPIService
+}
+
+func NewMPIHandler(svc *service.MPIService) *MPIHandler {
+	return &MPIHandler{svc: svc}
+}
+
+// FindPersons looks up the MPI persons holding an identifier, limited to
+// the caller's own identifiers
+func (h *MPIHandler) FindPersons(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("system") == "" || query.Get("value") == "" {
+		writeError(w, http.StatusBadRequest, "system and value query parameters are required")
+		return
+	}
+
+	persons, err := h.svc.FindPersons(authenticatedProvider(r).ProviderID, model.PatientIdentifier{
+		System: query.Get("system"),
+		Value:  query.Get("value"),
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"persons": persons,
+		"count":   len(persons),
+	})
+}
+
+func (h *MPIHandler) GetPerson(w http.ResponseWriter, r *http.Request) {
+	person, err := h.svc.GetPerson(authenticatedProvider(r).ProviderID, chi.URLParam(r, "id"))
+	if err != nil {
+		switch err {
+		case service.ErrMPIPersonNotFound:
+			writeError(w, http.StatusNotFound, "MPI person not found")
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, person)
+}
+
+// Resolve translates an identifier into those the target provider uses,
+// if consent lets the caller request the patient from the target
+func (h *MPIHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	targetProviderID := query.Get("targetProviderId")
+	if query.Get("system") == "" || query.Get("value") == "" || targetProviderID == "" {
+		writeError(w, http.StatusBadRequest, "system, value and targetProviderId query parameters are required")
+		return
+	}
+	purpose := model.PurposeOfUse(query.Get("purposeOfUse"))
+	if purpose == "" {
+		purpose = model.PurposeOfUseTreatment
+	}
+	if !purpose.IsValid() {
+		writeError(w, http.StatusBadRequest, "purposeOfUse is not a supported PurposeOfUse code")
+		return
+	}
+
+	resolution, err := h.svc.ResolveFor(authenticatedProvider(r).ProviderID, model.PatientReference{
+		Identifiers: []model.PatientIdentifier{{System: query.Get("system"), Value: query.Get("value")}},
+	}, targetProviderID, purpose)
+	if err != nil {
+		switch err {
+		case service.ErrMPIAmbiguous:
+			writeError(w, http.StatusConflict, err.Error())
+		case service.ErrConsentDenied:
+			writeError(w, http.StatusForbidden, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	if resolution == nil {
+		writeError(w, http.StatusNotFound, "identifier is not known to the MPI")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resolution)
+}
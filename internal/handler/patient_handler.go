@@ -2,11 +2,14 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 
 	"github.com/wah4pc/gateway/internal/model"
 	"github.com/wah4pc/gateway/internal/repository"
 	"github.com/wah4pc/gateway/internal/service"
+	"github.com/wah4pc/gateway/pkg/fhir"
 )
 
 type PatientHandler struct {
@@ -24,6 +27,18 @@ type PatientRequestBody struct {
 	PatientReference    model.PatientReference `json:"patientReference"`
 	FHIRConstraints     model.FHIRConstraints  `json:"fhirConstraints,omitempty"`
 	Metadata            model.RequestMetadata  `json:"metadata,omitempty"`
+	ConsentOverride     *ConsentOverrideBody   `json:"consentOverride,omitempty"`
+	BreakGlass          *BreakGlassBody        `json:"breakGlass,omitempty"`
+}
+
+// BreakGlassBody requests emergency access
+type BreakGlassBody struct {
+	Reason string `json:"reason"`
+}
+
+// ConsentOverrideBody releases data without consent in emergencies
+type ConsentOverrideBody struct {
+	Justification string `json:"justification"`
 }
 
 func (h *PatientHandler) CreateRequest(w http.ResponseWriter, r *http.Request) {
@@ -33,59 +48,101 @@ func (h *PatientHandler) CreateRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.RequestorProviderID == "" || req.TargetProviderID == "" {
-		writeError(w, http.StatusBadRequest, "requestorProviderId and targetProviderId are required")
+	requestorID, ok := callerID(r, req.RequestorProviderID)
+	if !ok {
+		writeError(w, http.StatusForbidden, "requestorProviderId must be the calling provider")
+		return
+	}
+	if req.TargetProviderID == "" {
+		writeError(w, http.StatusBadRequest, "targetProviderId is required")
 		return
 	}
 
 	input := service.CreateRequestInput{
-		RequestorProviderID: req.RequestorProviderID,
+		RequestorProviderID: requestorID,
 		TargetProviderID:    req.TargetProviderID,
 		CorrelationKey:      req.CorrelationKey,
 		PatientReference:    req.PatientReference,
 		FHIRConstraints:     req.FHIRConstraints,
 		Metadata:            req.Metadata,
 	}
+	if req.ConsentOverride != nil {
+		if req.ConsentOverride.Justification == "" {
+			writeError(w, http.StatusBadRequest, "consentOverride.justification is required")
+			return
+		}
+		input.OverrideJustification = req.ConsentOverride.Justification
+	}
+	if req.BreakGlass != nil {
+		if req.BreakGlass.Reason == "" {
+			writeError(w, http.StatusBadRequest, "breakGlass.reason is required")
+			return
+		}
+		input.BreakGlassReason = req.BreakGlass.Reason
+	}
 
 	request, err := h.svc.CreateRequest(input)
 	if err != nil {
-		switch err {
-		case service.ErrRequestorNotFound:
-			writeError(w, http.StatusBadRequest, "requestor provider not found")
-		case service.ErrTargetNotFound:
-			writeError(w, http.StatusBadRequest, "target provider not found")
-		default:
-			writeError(w, http.StatusInternalServerError, err.Error())
-		}
+		writeCreateRequestError(w, err, request)
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]interface{}{
+	result := map[string]interface{}{
 		"requestId":           request.RequestID,
 		"status":              request.Status,
 		"requestorProviderId": request.RequestorProviderID,
 		"targetProviderId":    request.TargetProviderID,
 		"createdAt":           request.CreatedAt,
-	})
+	}
+	if request.BreakGlass != nil {
+		result["breakGlass"] = request.BreakGlass
+	}
+	writeJSON(w, http.StatusCreated, result)
 }
 
 type ReceiveRequestBody struct {
 	RequestID      string              `json:"requestId"`
 	FromProviderID string              `json:"fromProviderId"`
 	FHIRPatient    json.RawMessage     `json:"fhirPatient,omitempty"`
+	FHIRVersion    string              `json:"fhirVersion,omitempty"`
 	Status         model.RequestStatus `json:"status"`
 	Error          string              `json:"error,omitempty"`
 }
 
 func (h *PatientHandler) ReceiveResponse(w http.ResponseWriter, r *http.Request) {
 	var req ReceiveRequestBody
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if isFHIRXML(r.Header.Get("Content-Type")) {
+		// XML bodies carry only the FHIR resource; the envelope moves to the query string.
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		fhirPatient, err := fhir.XMLToJSON(body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		query := r.URL.Query()
+		req = ReceiveRequestBody{
+			RequestID:      query.Get("requestId"),
+			FromProviderID: query.Get("fromProviderId"),
+			FHIRPatient:    fhirPatient,
+			Status:         model.RequestStatus(query.Get("status")),
+			Error:          query.Get("error"),
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	if req.RequestID == "" || req.FromProviderID == "" {
-		writeError(w, http.StatusBadRequest, "requestId and fromProviderId are required")
+	if req.RequestID == "" {
+		writeError(w, http.StatusBadRequest, "requestId is required")
+		return
+	}
+	fromProviderID, ok := callerID(r, req.FromProviderID)
+	if !ok {
+		writeError(w, http.StatusForbidden, "fromProviderId must be the calling provider")
 		return
 	}
 
@@ -93,10 +150,16 @@ func (h *PatientHandler) ReceiveResponse(w http.ResponseWriter, r *http.Request)
 		req.Status = model.RequestStatusCompleted
 	}
 
+	// The FHIR mime-type parameter (application/fhir+json; fhirVersion=4.0) declares the version too.
+	if req.FHIRVersion == "" {
+		req.FHIRVersion = fhirVersionParam(r.Header.Get("Content-Type"))
+	}
+
 	input := service.ReceiveResponseInput{
 		RequestID:      req.RequestID,
-		FromProviderID: req.FromProviderID,
+		FromProviderID: fromProviderID,
 		FHIRPatient:    req.FHIRPatient,
+		FHIRVersion:    req.FHIRVersion,
 		Status:         req.Status,
 		Error:          req.Error,
 	}
@@ -104,10 +167,20 @@ func (h *PatientHandler) ReceiveResponse(w http.ResponseWriter, r *http.Request)
 	response, err := h.svc.ReceiveResponse(input)
 	if err != nil {
 		switch err {
+		case service.ErrUnsupportedFHIRVersion:
+			writeError(w, http.StatusBadRequest, "unsupported fhirVersion")
+		case service.ErrFHIRVersionMismatch:
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+		case service.ErrInvalidFHIRResource:
+			writeError(w, http.StatusBadRequest, err.Error())
 		case repository.ErrRequestNotFound:
 			writeError(w, http.StatusNotFound, "request not found")
 		case service.ErrInvalidFromProvider:
 			writeError(w, http.StatusBadRequest, "fromProviderId does not match target provider")
+		case service.ErrRequestClosed:
+			writeError(w, http.StatusConflict, err.Error())
+		case service.ErrTargetInactive:
+			writeError(w, http.StatusForbidden, err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, err.Error())
 		}
@@ -115,9 +188,10 @@ func (h *PatientHandler) ReceiveResponse(w http.ResponseWriter, r *http.Request)
 	}
 
 	writeJSON(w, http.StatusOK, map[string]interface{}{
-		"requestId":  response.RequestID,
-		"status":     response.Status,
-		"receivedAt": response.ReceivedAt,
+		"requestId":   response.RequestID,
+		"status":      response.Status,
+		"fhirVersion": response.FHIRVersion,
+		"receivedAt":  response.ReceivedAt,
 	})
 }
 
@@ -128,11 +202,19 @@ func (h *PatientHandler) GetResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.svc.GetResponse(requestID)
+	format, ok := parseFHIRFormat(r.URL.Query().Get("_format"))
+	if !ok {
+		writeError(w, http.StatusBadRequest, "_format must be json or xml")
+		return
+	}
+
+	result, err := h.svc.GetResponse(requestID, authenticatedProvider(r).ProviderID, format)
 	if err != nil {
 		switch err {
 		case repository.ErrRequestNotFound:
 			writeError(w, http.StatusNotFound, "request not found")
+		case service.ErrNotRequestor:
+			writeError(w, http.StatusForbidden, err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, err.Error())
 		}
@@ -142,11 +224,12 @@ func (h *PatientHandler) GetResponse(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, result)
 }
 
-// GetPendingRequests returns all pending requests for a target provider (polling endpoint)
+// GetPendingRequests returns all pending requests for the calling target
+// provider (polling endpoint)
 func (h *PatientHandler) GetPendingRequests(w http.ResponseWriter, r *http.Request) {
-	targetProviderID := r.URL.Query().Get("targetProviderId")
-	if targetProviderID == "" {
-		writeError(w, http.StatusBadRequest, "targetProviderId query parameter is required")
+	targetProviderID, ok := callerID(r, r.URL.Query().Get("targetProviderId"))
+	if !ok {
+		writeError(w, http.StatusForbidden, "targetProviderId must be the calling provider")
 		return
 	}
 
@@ -155,6 +238,8 @@ func (h *PatientHandler) GetPendingRequests(w http.ResponseWriter, r *http.Reque
 		switch err {
 		case service.ErrTargetNotFound:
 			writeError(w, http.StatusNotFound, "target provider not found")
+		case service.ErrTargetInactive:
+			writeError(w, http.StatusForbidden, err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, err.Error())
 		}
@@ -167,3 +252,52 @@ func (h *PatientHandler) GetPendingRequests(w http.ResponseWriter, r *http.Reque
 		"count":            len(requests),
 	})
 }
+
+// createRequestStatus maps a CreateRequest error to its HTTP status and the
+// issue code reported in FHIR OperationOutcomes.
+func createRequestStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidIdentifier):
+		return http.StatusBadRequest, "invalid"
+	case errors.Is(err, service.ErrTargetIncapable):
+		return http.StatusUnprocessableEntity, "not-supported"
+	case errors.Is(err, service.ErrPolicyDenied):
+		return http.StatusForbidden, "forbidden"
+	}
+	switch err {
+	case service.ErrRequestorNotFound, service.ErrTargetNotFound:
+		return http.StatusBadRequest, "not-found"
+	case service.ErrRequestorInactive, service.ErrTargetInactive, service.ErrConsentDenied:
+		return http.StatusForbidden, "forbidden"
+	case service.ErrUnsupportedFHIRVersion, service.ErrInvalidPurposeOfUse:
+		return http.StatusBadRequest, "not-supported"
+	case service.ErrOverrideNotAllowed, service.ErrBreakGlassPurpose, service.ErrInvalidMatchToken:
+		return http.StatusBadRequest, "invalid"
+	default:
+		return http.StatusInternalServerError, "exception"
+	}
+}
+
+// writeCreateRequestError reports a failed CreateRequest. A request denied
+// for lack of consent is still recorded, so its ID is returned.
+func writeCreateRequestError(w http.ResponseWriter, err error, request *model.PatientRequest) {
+	status, _ := createRequestStatus(err)
+	switch err {
+	case service.ErrConsentDenied:
+		writeJSON(w, status, map[string]interface{}{
+			"error":     "patient consent not granted",
+			"requestId": request.RequestID,
+			"status":    request.Status,
+		})
+	case service.ErrRequestorNotFound:
+		writeError(w, status, "requestor provider not found")
+	case service.ErrTargetNotFound:
+		writeError(w, status, "target provider not found")
+	case service.ErrUnsupportedFHIRVersion:
+		writeError(w, status, "unsupported fhirConstraints.version")
+	case service.ErrInvalidPurposeOfUse:
+		writeError(w, status, "fhirConstraints.purposeOfUse is not a supported PurposeOfUse code")
+	default:
+		writeError(w, status, err.Error())
+	}
+}
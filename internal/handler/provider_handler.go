@@ -2,37 +2,162 @@ package handler
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"regexp"
+	"strconv"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/wah4pc/gateway/internal/fhirmap"
 	"github.com/wah4pc/gateway/internal/model"
 	"github.com/wah4pc/gateway/internal/service"
+	"github.com/wah4pc/gateway/pkg/fhir"
+	"github.com/wah4pc/gateway/pkg/httpclient"
 )
 
 type ProviderHandler struct {
-	svc *service.ProviderService
+	svc  *service.ProviderService
+	auth *Auth
 }
 
-func NewProviderHandler(svc *service.ProviderService) *ProviderHandler {
-	return &ProviderHandler{svc: svc}
+func NewProviderHandler(svc *service.ProviderService, auth *Auth) *ProviderHandler {
+	return &ProviderHandler{svc: svc, auth: auth}
 }
 
+func (h *ProviderHandler) GetProvider(w http.ResponseWriter, r *http.Request) {
+	provider, err := h.svc.GetProviderWithHealth(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+	provider.Provider = withoutSecrets(provider.Provider)
+
+	writeJSON(w, http.StatusOK, provider)
+}
+
+// GetProviders searches the provider directory. The total number of
+// matches is returned in X-Total-Count, as the body holds one page.
 func (h *ProviderHandler) GetProviders(w http.ResponseWriter, r *http.Request) {
-	providers, err := h.svc.GetAllProviders()
+	query := r.URL.Query()
+	filter := service.ProviderFilter{
+		Type:             model.ProviderType(query.Get("type")),
+		Name:             query.Get("name"),
+		Location:         query.Get("location"),
+		Region:           query.Get("region"),
+		ResourceType:     query.Get("resourceType"),
+		IdentifierSystem: query.Get("identifierSystem"),
+		Profile:          query.Get("profile"),
+		Status:           model.ProviderStatus(query.Get("status")),
+	}
+
+	if v := query.Get("fhirVersion"); v != "" {
+		version, ok := fhir.NormalizeVersion(v)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "unsupported fhirVersion")
+			return
+		}
+		filter.FHIRVersion = version
+	}
+	if filter.Status != "" && !filter.Status.IsValid() {
+		writeError(w, http.StatusBadRequest, "status must be PENDING_APPROVAL, ACTIVE, SUSPENDED or DEACTIVATED")
+		return
+	}
+
+	var ok bool
+	if filter.Offset, ok = queryCount(query.Get("offset")); !ok {
+		writeError(w, http.StatusBadRequest, "offset must be a non-negative number")
+		return
+	}
+	if filter.Limit, ok = queryCount(query.Get("limit")); !ok {
+		writeError(w, http.StatusBadRequest, "limit must be a non-negative number")
+		return
+	}
+
+	providers, total, err := h.svc.SearchProviders(filter)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	for i := range providers {
+		providers[i].Provider = withoutSecrets(providers[i].Provider)
+	}
 	writeJSON(w, http.StatusOK, providers)
 }
 
+// queryCount parses an optional non-negative number, defaulting to 0.
+func queryCount(v string) (int, bool) {
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(v)
+	return n, err == nil && n >= 0
+}
+
 type CreateProviderRequest struct {
-	ProviderID string                  `json:"providerId"`
-	Name       string                  `json:"name"`
-	Type       model.ProviderType      `json:"type"`
-	BaseURL    string                  `json:"baseUrl"`
-	Endpoints  model.ProviderEndpoints `json:"endpoints"`
-	Callback   model.ProviderCallback  `json:"callback"`
+	ProviderID   string                      `json:"providerId"`
+	Name         string                      `json:"name"`
+	Type         model.ProviderType          `json:"type"`
+	BaseURL      string                      `json:"baseUrl"`
+	Endpoints    model.ProviderEndpoints     `json:"endpoints"`
+	Callback     model.ProviderCallback      `json:"callback"`
+	Webhooks     []WebhookRequest            `json:"webhooks,omitempty"`
+	FHIRFormat   model.FHIRFormat            `json:"fhirFormat,omitempty"`
+	Location     *model.ProviderLocation     `json:"location,omitempty"`
+	Groups       []string                    `json:"groups,omitempty"`
+	Capabilities *model.ProviderCapabilities `json:"capabilities,omitempty"`
+	Approval     *model.ApprovalSettings     `json:"approval,omitempty"`
+}
+
+// WebhookRequest is a webhook subscription as registered. The ID is
+// generated when empty, Enabled defaults to true and an empty Secret keeps
+// the subscription's current one.
+type WebhookRequest struct {
+	ID      string               `json:"id,omitempty"`
+	URL     string               `json:"url"`
+	Events  []model.WebhookEvent `json:"events,omitempty"`
+	Secret  string               `json:"secret,omitempty"`
+	Enabled *bool                `json:"enabled,omitempty"`
+}
+
+func webhookSubscriptions(reqs []WebhookRequest) []model.WebhookSubscription {
+	var subs []model.WebhookSubscription
+	for _, req := range reqs {
+		subs = append(subs, model.WebhookSubscription{
+			ID:      req.ID,
+			URL:     req.URL,
+			Events:  req.Events,
+			Secret:  req.Secret,
+			Enabled: req.Enabled == nil || *req.Enabled,
+		})
+	}
+	return subs
+}
+
+func webhookRequests(subs []model.WebhookSubscription) []WebhookRequest {
+	var reqs []WebhookRequest
+	for _, sub := range subs {
+		enabled := sub.Enabled
+		reqs = append(reqs, WebhookRequest{ID: sub.ID, URL: sub.URL, Events: sub.Events, Enabled: &enabled})
+	}
+	return reqs
+}
+
+// withoutSecrets copies a provider for a response: webhook secrets and the
+// API key hash are never returned.
+func withoutSecrets(p model.Provider) model.Provider {
+	p.APIKeyHash = ""
+	if len(p.Webhooks) == 0 {
+		return p
+	}
+	webhooks := make([]model.WebhookSubscription, len(p.Webhooks))
+	for i, sub := range p.Webhooks {
+		sub.Secret = ""
+		webhooks[i] = sub
+	}
+	p.Webhooks = webhooks
+	return p
 }
 
 func (h *ProviderHandler) CreateProvider(w http.ResponseWriter, r *http.Request) {
@@ -47,26 +172,27 @@ func (h *ProviderHandler) CreateProvider(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if req.BaseURL == "" {
-		writeError(w, http.StatusBadRequest, "baseUrl is required")
-		return
-	}
-
-	if req.Callback.PatientResponse == "" {
-		writeError(w, http.StatusBadRequest, "callback.patientResponse is required")
+	if msg := validateProvider(req); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
 		return
 	}
 
 	input := service.CreateProviderInput{
-		ProviderID: req.ProviderID,
-		Name:       req.Name,
-		Type:       req.Type,
-		BaseURL:    req.BaseURL,
-		Endpoints:  req.Endpoints,
-		Callback:   req.Callback,
+		ProviderID:   req.ProviderID,
+		Name:         req.Name,
+		Type:         req.Type,
+		BaseURL:      req.BaseURL,
+		Endpoints:    req.Endpoints,
+		Callback:     req.Callback,
+		Webhooks:     webhookSubscriptions(req.Webhooks),
+		FHIRFormat:   req.FHIRFormat,
+		Location:     req.Location,
+		Groups:       req.Groups,
+		Capabilities: req.Capabilities,
+		Approval:     req.Approval,
 	}
 
-	provider, err := h.svc.CreateProvider(input)
+	provider, apiKey, err := h.svc.CreateProvider(input)
 	if err != nil {
 		switch err {
 		case service.ErrProviderAlreadyExists:
@@ -77,5 +203,414 @@ func (h *ProviderHandler) CreateProvider(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, provider)
+	writeJSON(w, http.StatusCreated, RegisteredProvider{Provider: withoutSecrets(*provider), APIKey: apiKey})
+}
+
+// RegisteredProvider is the registration response. APIKey is shown only
+// here and when an administrator issues a new one.
+type RegisteredProvider struct {
+	model.Provider
+	APIKey string `json:"apiKey"`
+}
+
+// IssueAPIKey replaces a provider's API key
+func (h *ProviderHandler) IssueAPIKey(w http.ResponseWriter, r *http.Request) {
+	providerID := chi.URLParam(r, "id")
+	apiKey, err := h.svc.IssueAPIKey(providerID)
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"providerId": providerID,
+		"apiKey":     apiKey,
+	})
+}
+
+// UpdateProvider replaces a provider's registration details
+func (h *ProviderHandler) UpdateProvider(w http.ResponseWriter, r *http.Request) {
+	var req CreateProviderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	providerID := chi.URLParam(r, "id")
+	if req.ProviderID != "" && req.ProviderID != providerID {
+		writeError(w, http.StatusBadRequest, "providerId cannot be changed")
+		return
+	}
+
+	if msg := validateProvider(req); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	current, err := h.svc.GetProvider(providerID)
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+	// Access policies match on groups, so only the operator assigns them.
+	if !sameGroups(current.Groups, req.Groups) && !h.auth.IsAdmin(r) {
+		writeAdminRequired(w)
+		return
+	}
+
+	provider, err := h.svc.UpdateProvider(providerID, updateInput(req))
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, withoutSecrets(*provider))
+}
+
+// PatchProviderRequest holds the fields to change; absent fields are kept.
+// Objects such as callback are replaced as a whole, "approval": null turns
+// the approval stage off and "capabilities": null removes all restrictions.
+type PatchProviderRequest struct {
+	Name         *string                  `json:"name"`
+	Type         *model.ProviderType      `json:"type"`
+	BaseURL      *string                  `json:"baseUrl"`
+	Endpoints    *model.ProviderEndpoints `json:"endpoints"`
+	Callback     *model.ProviderCallback  `json:"callback"`
+	Webhooks     *[]WebhookRequest        `json:"webhooks"`
+	FHIRFormat   *model.FHIRFormat        `json:"fhirFormat"`
+	Location     json.RawMessage          `json:"location"`
+	Groups       *[]string                `json:"groups"`
+	Capabilities json.RawMessage          `json:"capabilities"`
+	Approval     json.RawMessage          `json:"approval"`
+	Status       *model.ProviderStatus    `json:"status"`
+}
+
+// PatchProvider changes some of a provider's details, or its status
+func (h *ProviderHandler) PatchProvider(w http.ResponseWriter, r *http.Request) {
+	var patch PatchProviderRequest
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	// Only the gateway operator changes a provider's status. Approval and
+	// suspension go through their own endpoints, which take a reason.
+	if patch.Status != nil && !h.auth.IsAdmin(r) {
+		writeAdminRequired(w)
+		return
+	}
+	if patch.Status != nil && *patch.Status != model.ProviderStatusActive && *patch.Status != model.ProviderStatusDeactivated {
+		writeError(w, http.StatusBadRequest, "status must be ACTIVE or DEACTIVATED")
+		return
+	}
+
+	provider, err := h.svc.GetProvider(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+
+	req := CreateProviderRequest{
+		Name:         provider.Name,
+		Type:         provider.Type,
+		BaseURL:      provider.BaseURL,
+		Endpoints:    provider.Endpoints,
+		Callback:     provider.Callback,
+		Webhooks:     webhookRequests(provider.Webhooks),
+		FHIRFormat:   provider.FHIRFormat,
+		Location:     provider.Location,
+		Groups:       provider.Groups,
+		Capabilities: provider.Capabilities,
+		Approval:     provider.Approval,
+	}
+	changed := false
+	if patch.Name != nil {
+		req.Name, changed = *patch.Name, true
+	}
+	if patch.Type != nil {
+		req.Type, changed = *patch.Type, true
+	}
+	if patch.BaseURL != nil {
+		req.BaseURL, changed = *patch.BaseURL, true
+	}
+	if patch.Endpoints != nil {
+		req.Endpoints, changed = *patch.Endpoints, true
+	}
+	if patch.Callback != nil {
+		req.Callback, changed = *patch.Callback, true
+	}
+	if patch.Webhooks != nil {
+		req.Webhooks, changed = *patch.Webhooks, true
+	}
+	if patch.FHIRFormat != nil {
+		req.FHIRFormat, changed = *patch.FHIRFormat, true
+	}
+	if patch.Groups != nil {
+		if !sameGroups(provider.Groups, *patch.Groups) && !h.auth.IsAdmin(r) {
+			writeAdminRequired(w)
+			return
+		}
+		req.Groups, changed = *patch.Groups, true
+	}
+	if len(patch.Location) > 0 {
+		req.Location = nil
+		if err := json.Unmarshal(patch.Location, &req.Location); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid location")
+			return
+		}
+		changed = true
+	}
+	if len(patch.Capabilities) > 0 {
+		req.Capabilities = nil
+		if err := json.Unmarshal(patch.Capabilities, &req.Capabilities); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid capabilities")
+			return
+		}
+		changed = true
+	}
+	if len(patch.Approval) > 0 {
+		req.Approval = nil
+		if err := json.Unmarshal(patch.Approval, &req.Approval); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid approval")
+			return
+		}
+		changed = true
+	}
+
+	if msg := validateProvider(req); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if changed {
+		if provider, err = h.svc.UpdateProvider(provider.ProviderID, updateInput(req)); err != nil {
+			writeProviderError(w, err)
+			return
+		}
+	}
+
+	if patch.Status != nil {
+		switch *patch.Status {
+		case model.ProviderStatusActive:
+			provider, err = h.svc.ReactivateProvider(provider.ProviderID)
+		case model.ProviderStatusDeactivated:
+			provider, _, err = h.svc.DeactivateProvider(provider.ProviderID, "")
+		}
+		if err != nil {
+			writeProviderError(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, withoutSecrets(*provider))
+}
+
+// DeleteProvider deactivates a provider and closes its open requests. The
+// provider is kept for the record.
+func (h *ProviderHandler) DeleteProvider(w http.ResponseWriter, r *http.Request) {
+	provider, closed, err := h.svc.DeactivateProvider(chi.URLParam(r, "id"), r.URL.Query().Get("reason"))
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"provider":       withoutSecrets(*provider),
+		"closedRequests": closed,
+	})
+}
+
+type ProviderStatusChangeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ApproveProvider lets a pending or suspended provider take part in
+// exchanges
+func (h *ProviderHandler) ApproveProvider(w http.ResponseWriter, r *http.Request) {
+	var req ProviderStatusChangeRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+
+	provider, err := h.svc.ApproveProvider(chi.URLParam(r, "id"), req.Reason)
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, withoutSecrets(*provider))
+}
+
+// SuspendProvider bars an active provider from exchanges and closes its
+// open requests
+func (h *ProviderHandler) SuspendProvider(w http.ResponseWriter, r *http.Request) {
+	var req ProviderStatusChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	provider, closed, err := h.svc.SuspendProvider(chi.URLParam(r, "id"), req.Reason)
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"provider":       withoutSecrets(*provider),
+		"closedRequests": closed,
+	})
+}
+
+// VerifyCallbacks re-sends the ownership challenge to the provider's
+// callback URLs and returns the outcome
+func (h *ProviderHandler) VerifyCallbacks(w http.ResponseWriter, r *http.Request) {
+	provider, err := h.svc.VerifyCallbacks(chi.URLParam(r, "id"))
+	if err != nil {
+		writeProviderError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, withoutSecrets(*provider))
+}
+
+// validateProvider checks the registration details shared by create and
+// update, returning an error message or "".
+func validateProvider(req CreateProviderRequest) string {
+	switch {
+	case req.Name == "":
+		return "name is required"
+	case req.BaseURL == "":
+		return "baseUrl is required"
+	case req.FHIRFormat != "" && !req.FHIRFormat.IsValid():
+		return "fhirFormat must be json or xml"
+	case req.Approval != nil && len(req.Approval.Reviewers) == 0:
+		return "approval.reviewers must name at least one reviewer"
+	case req.Endpoints.Pull && req.Endpoints.PatientRequest == "":
+		return "endpoints.pull requires endpoints.patientRequest"
+	}
+
+	if req.Capabilities != nil {
+		for _, v := range req.Capabilities.FHIRVersions {
+			if _, ok := fhir.NormalizeVersion(v); !ok {
+				return "capabilities.fhirVersions: unsupported version " + v
+			}
+		}
+	}
+
+	ids := map[string]bool{
+		model.CallbackPatientRequest:  true,
+		model.CallbackPatientResponse: true,
+		fhirmap.EndpointPull:          true,
+	}
+	for i, wh := range req.Webhooks {
+		field := fmt.Sprintf("webhooks[%d]", i)
+		if wh.URL == "" {
+			return field + ".url is required"
+		}
+		if wh.ID != "" {
+			if !webhookIDPattern.MatchString(wh.ID) {
+				return field + ".id may only contain letters, digits, '-', '_' and '.'"
+			}
+			if ids[wh.ID] {
+				return field + ".id " + wh.ID + " is already used"
+			}
+			ids[wh.ID] = true
+		}
+		for _, e := range wh.Events {
+			if !e.IsValid() {
+				return field + ".events: unknown event " + string(e)
+			}
+		}
+	}
+	if req.Callback.PatientResponse == "" && !receivesOutcomes(req.Webhooks) {
+		return "callback.patientResponse or a webhook receiving request.completed is required"
+	}
+
+	// The gateway calls these URLs, so they must not point inside its network.
+	urls := []struct{ field, url string }{
+		{"baseUrl", req.BaseURL},
+		{"endpoints.patientRequest", req.Endpoints.PatientRequestURL(req.BaseURL)},
+		{"callback.patientRequest", req.Callback.PatientRequest},
+		{"callback.patientResponse", req.Callback.PatientResponse},
+	}
+	for i, wh := range req.Webhooks {
+		urls = append(urls, struct{ field, url string }{fmt.Sprintf("webhooks[%d].url", i), wh.URL})
+	}
+	for _, u := range urls {
+		if u.url == "" {
+			continue
+		}
+		if err := httpclient.CheckURL(u.url); err != nil {
+			return u.field + ": " + err.Error()
+		}
+	}
+	return ""
+}
+
+var webhookIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// receivesOutcomes reports whether an enabled webhook receives completed
+// requests.
+func receivesOutcomes(webhooks []WebhookRequest) bool {
+	for _, sub := range webhookSubscriptions(webhooks) {
+		if sub.Receives(model.WebhookEventRequestCompleted) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameGroups reports whether two group lists name the same groups.
+func sameGroups(a, b []string) bool {
+	setA, setB := stringSet(a), stringSet(b)
+	if len(setA) != len(setB) {
+		return false
+	}
+	for g := range setA {
+		if !setB[g] {
+			return false
+		}
+	}
+	return true
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+func updateInput(req CreateProviderRequest) service.UpdateProviderInput {
+	return service.UpdateProviderInput{
+		Name:         req.Name,
+		Type:         req.Type,
+		BaseURL:      req.BaseURL,
+		Endpoints:    req.Endpoints,
+		Callback:     req.Callback,
+		Webhooks:     webhookSubscriptions(req.Webhooks),
+		FHIRFormat:   req.FHIRFormat,
+		Location:     req.Location,
+		Groups:       req.Groups,
+		Capabilities: req.Capabilities,
+		Approval:     req.Approval,
+	}
+}
+
+func writeProviderError(w http.ResponseWriter, err error) {
+	switch err {
+	case service.ErrProviderNotFound:
+		writeError(w, http.StatusNotFound, "provider not found")
+	case service.ErrSuspendReason:
+		writeError(w, http.StatusBadRequest, err.Error())
+	case service.ErrProviderDeactivated, service.ErrProviderNotActive:
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
 }
@@ -3,6 +3,8 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/wah4pc/gateway/pkg/fhir"
 )
 
 type ErrorResponse struct {
@@ -18,3 +20,13 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, ErrorResponse{Error: message})
 }
+
+func writeFHIR(w http.ResponseWriter, status int, resource interface{}) {
+	w.Header().Set("Content-Type", fhir.MediaTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resource)
+}
+
+func writeOutcome(w http.ResponseWriter, status int, code, diagnostics string) {
+	writeFHIR(w, status, fhir.NewOperationOutcome("error", code, diagnostics))
+}
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/service"
+)
+
+type RetentionHandler struct {
+	svc *service.RetentionService
+}
+
+func NewRetentionHandler(svc *service.RetentionService) *RetentionHandler {
+	return &RetentionHandler{svc: svc}
+}
+
+// GetReport is a dry run of the retention policy. The optional at parameter
+// (RFC 3339) shows what a purge at that time would do.
+func (h *RetentionHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	at := time.Now().UTC()
+	if v := r.URL.Query().Get("at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "at must be an RFC 3339 timestamp")
+			return
+		}
+		at = t
+	}
+
+	report, err := h.svc.Plan(at)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,243 @@
+// Package matching scores how likely two sets of patient demographics
+// describe the same person. It is tuned for Filipino names: middle names
+// are the mother's maiden surname, often abbreviated to an initial; married
+// women may carry their maiden surname as the middle name; compound
+// surnames such as "Dela Cruz" and "Sta. Maria" are written many ways.
+package matching
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+)
+
+// Grades follow the FHIR match-grade value set.
+const (
+	GradeCertain      = "certain"
+	GradeProbable     = "probable"
+	GradePossible     = "possible"
+	GradeCertainlyNot = "certainly-not"
+)
+
+// Field weights of the overall score.
+const (
+	weightFamily    = 0.30
+	weightGiven     = 0.25
+	weightMiddle    = 0.10
+	weightBirthDate = 0.30
+	weightGender    = 0.05
+)
+
+// Result is the outcome of comparing a query with a candidate.
+type Result struct {
+	Score   float64  `json:"score"`
+	Grade   string   `json:"grade"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// Matcher compares demographics. BirthDateToleranceDays is how far apart
+// two full birth dates may be and still count as a near match.
+type Matcher struct {
+	BirthDateToleranceDays int
+}
+
+func NewMatcher(birthDateToleranceDays int) *Matcher {
+	return &Matcher{BirthDateToleranceDays: birthDateToleranceDays}
+}
+
+// Comparable reports whether a query has enough to match on.
+func Comparable(q model.Demographics) bool {
+	return q.FamilyName != "" || q.GivenName != "" || q.BirthDate != ""
+}
+
+// Compare scores candidate against query. Fields missing from the query are
+// ignored; fields missing from the candidate count as half a match.
+func (m *Matcher) Compare(query, candidate model.Demographics) Result {
+	var total, weight float64
+	var reasons []string
+	add := func(w, score float64, reason string) {
+		total += w * score
+		weight += w
+		if reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	qFamily, cFamily := normalizeSurname(query.FamilyName), normalizeSurname(candidate.FamilyName)
+	qMiddle, cMiddle := normalizeSurname(query.MiddleName), normalizeSurname(candidate.MiddleName)
+
+	if qFamily != "" {
+		switch score, reason := compareNames(qFamily, cFamily); {
+		case cFamily == "":
+			add(weightFamily, 0.5, "")
+		// A married woman's middle name is her maiden surname.
+		case score < 0.8 && (compareScore(qMiddle, cFamily) >= 0.9 || compareScore(qFamily, cMiddle) >= 0.9):
+			add(weightFamily, 0.7, "maiden and married surnames swapped")
+		default:
+			add(weightFamily, score, prefix("family name", reason))
+		}
+	}
+
+	if query.GivenName != "" {
+		if candidate.GivenName == "" {
+			add(weightGiven, 0.5, "")
+		} else {
+			score, reason := compareGiven(query.GivenName, candidate.GivenName)
+			add(weightGiven, score, prefix("given name", reason))
+		}
+	}
+
+	if qMiddle != "" && cMiddle != "" {
+		score, reason := compareMiddle(qMiddle, cMiddle)
+		add(weightMiddle, score, prefix("middle name", reason))
+	}
+
+	if query.BirthDate != "" {
+		if candidate.BirthDate == "" {
+			add(weightBirthDate, 0.5, "")
+		} else {
+			score, reason := m.compareBirthDate(query.BirthDate, candidate.BirthDate)
+			add(weightBirthDate, score, reason)
+		}
+	}
+
+	genderMismatch := false
+	if known(query.Gender) && known(candidate.Gender) {
+		if strings.EqualFold(query.Gender, candidate.Gender) {
+			add(weightGender, 1, "")
+		} else {
+			genderMismatch = true
+			add(weightGender, 0, "gender differs")
+		}
+	}
+
+	if weight == 0 {
+		return Result{Grade: GradeCertainlyNot}
+	}
+	score := total / weight
+	if genderMismatch {
+		score /= 2
+	}
+	score = math.Round(score*100) / 100
+	return Result{Score: score, Grade: grade(score), Reasons: reasons}
+}
+
+func grade(score float64) string {
+	switch {
+	case score >= 0.9:
+		return GradeCertain
+	case score >= 0.75:
+		return GradeProbable
+	case score >= 0.5:
+		return GradePossible
+	default:
+		return GradeCertainlyNot
+	}
+}
+
+func known(gender string) bool {
+	return gender != "" && !strings.EqualFold(gender, "unknown")
+}
+
+func prefix(field, reason string) string {
+	if reason == "" {
+		return ""
+	}
+	return field + " " + reason
+}
+
+// compareNames compares two normalized names.
+func compareNames(a, b string) (float64, string) {
+	switch {
+	case a == "" || b == "":
+		return 0, ""
+	case a == b:
+		return 1, ""
+	case phonetic(a) == phonetic(b):
+		return 0.9, "sounds alike"
+	}
+	if jw := jaroWinkler(a, b); jw >= 0.85 {
+		return jw * 0.9, "spelled similarly"
+	}
+	return 0, "differs"
+}
+
+func compareScore(a, b string) float64 {
+	score, _ := compareNames(a, b)
+	return score
+}
+
+// compareGiven matches given names token by token, so "Ma. Cristina"
+// matches "Maria Cristina" and "Cristina".
+func compareGiven(a, b string) (float64, string) {
+	qa, qb := nameTokens(a), nameTokens(b)
+	if len(qa) == 0 || len(qb) == 0 {
+		return 0, ""
+	}
+	if strings.Join(qa, " ") == strings.Join(qb, " ") {
+		return 1, ""
+	}
+
+	best, reason := 0.0, ""
+	for _, x := range qa {
+		for _, y := range qb {
+			if s, r := compareNames(x, y); s > best {
+				best, reason = s, r
+			}
+		}
+	}
+	if best == 1 {
+		// One name is a subset of the other, e.g. a second given name left out.
+		return 0.9, "partly matches"
+	}
+	return best * 0.9, reason
+}
+
+// compareMiddle allows a middle initial to match the full middle name.
+func compareMiddle(a, b string) (float64, string) {
+	if len(a) == 1 || len(b) == 1 {
+		if a[0] == b[0] {
+			return 0.9, "initial matches"
+		}
+		return 0, "initial differs"
+	}
+	return compareNames(a, b)
+}
+
+// compareBirthDate accepts partial FHIR dates. Full dates also match with
+// day and month transposed, within the tolerance, or one year apart.
+func (m *Matcher) compareBirthDate(a, b string) (float64, string) {
+	if a == b {
+		return 1, ""
+	}
+	ta, errA := time.Parse("2006-01-02", a)
+	tb, errB := time.Parse("2006-01-02", b)
+	if errA != nil || errB != nil {
+		// A partial date matches a full date with the same prefix.
+		if strings.HasPrefix(a, b) || strings.HasPrefix(b, a) {
+			return 0.7, "birthDate matches partially"
+		}
+		return 0, "birthDate differs"
+	}
+
+	if ta.Year() == tb.Year() && int(ta.Month()) == tb.Day() && ta.Day() == int(tb.Month()) {
+		return 0.8, "birthDate day and month transposed"
+	}
+	days := math.Abs(ta.Sub(tb).Hours() / 24)
+	if days <= float64(m.BirthDateToleranceDays) {
+		return 0.7, "birthDate within tolerance"
+	}
+	if ta.Month() == tb.Month() && ta.Day() == tb.Day() && absInt(ta.Year()-tb.Year()) == 1 {
+		return 0.6, "birthDate year differs by one"
+	}
+	return 0, "birthDate differs"
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,184 @@
+package matching
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/wah4pc/gateway/internal/model"
+)
+
+func TestCompare(t *testing.T) {
+	query := model.Demographics{
+		GivenName:  "Maria Cristina",
+		MiddleName: "Santos",
+		FamilyName: "Dela Cruz",
+		BirthDate:  "1980-05-02",
+		Gender:     "female",
+	}
+
+	tests := []struct {
+		name      string
+		query     model.Demographics
+		candidate model.Demographics
+		score     float64
+		grade     string
+		reason    string
+	}{
+		{
+			name:      "identical",
+			query:     query,
+			candidate: query,
+			score:     1,
+			grade:     GradeCertain,
+		},
+		{
+			name:  "Ma. abbreviates Maria",
+			query: query,
+			candidate: model.Demographics{
+				GivenName: "Ma. Cristina", MiddleName: "Santos", FamilyName: "Dela Cruz", BirthDate: "1980-05-02", Gender: "female",
+			},
+			score: 1,
+			grade: GradeCertain,
+		},
+		{
+			name:  "second given name left out",
+			query: query,
+			candidate: model.Demographics{
+				GivenName: "Cristina", MiddleName: "Santos", FamilyName: "Dela Cruz", BirthDate: "1980-05-02", Gender: "female",
+			},
+			// 0.30 + 0.25*0.9 + 0.10 + 0.30 + 0.05
+			score:  0.975,
+			grade:  GradeCertain,
+			reason: "given name partly matches",
+		},
+		{
+			name:  "surname particles and case",
+			query: query,
+			candidate: model.Demographics{
+				GivenName: "MARIA CRISTINA", MiddleName: "santos", FamilyName: "De la Cruz", BirthDate: "1980-05-02", Gender: "female",
+			},
+			score: 1,
+			grade: GradeCertain,
+		},
+		{
+			name:  "middle initial",
+			query: query,
+			candidate: model.Demographics{
+				GivenName: "Maria Cristina", MiddleName: "S.", FamilyName: "Dela Cruz", BirthDate: "1980-05-02", Gender: "female",
+			},
+			// 0.30 + 0.25 + 0.10*0.9 + 0.30 + 0.05
+			score:  0.99,
+			grade:  GradeCertain,
+			reason: "middle name initial matches",
+		},
+		{
+			name: "maiden and married surnames swapped",
+			// Married record: her maiden surname Santos is the middle name.
+			query: model.Demographics{
+				GivenName: "Maria", MiddleName: "Santos", FamilyName: "Reyes", BirthDate: "1980-05-02", Gender: "female",
+			},
+			// Maiden record: Santos is the family name, Lopez her mother's.
+			candidate: model.Demographics{
+				GivenName: "Maria", MiddleName: "Lopez", FamilyName: "Santos", BirthDate: "1980-05-02", Gender: "female",
+			},
+			// 0.30*0.7 + 0.25 + 0.10*0 + 0.30 + 0.05
+			score:  0.81,
+			grade:  GradeProbable,
+			reason: "maiden and married surnames swapped",
+		},
+		{
+			name:  "day and month transposed",
+			query: query,
+			candidate: model.Demographics{
+				GivenName: "Maria Cristina", MiddleName: "Santos", FamilyName: "Dela Cruz", BirthDate: "1980-02-05", Gender: "female",
+			},
+			// 0.30 + 0.25 + 0.10 + 0.30*0.8 + 0.05
+			score:  0.94,
+			grade:  GradeCertain,
+			reason: "birthDate day and month transposed",
+		},
+		{
+			name:  "birth date within tolerance",
+			query: query,
+			candidate: model.Demographics{
+				GivenName: "Maria Cristina", MiddleName: "Santos", FamilyName: "Dela Cruz", BirthDate: "1980-05-04", Gender: "female",
+			},
+			// 0.30 + 0.25 + 0.10 + 0.30*0.7 + 0.05
+			score:  0.91,
+			grade:  GradeCertain,
+			reason: "birthDate within tolerance",
+		},
+		{
+			name:  "gender mismatch halves the score",
+			query: query,
+			candidate: model.Demographics{
+				GivenName: "Maria Cristina", MiddleName: "Santos", FamilyName: "Dela Cruz", BirthDate: "1980-05-02", Gender: "male",
+			},
+			// (0.30 + 0.25 + 0.10 + 0.30 + 0.05*0) / 2
+			score:  0.475,
+			grade:  GradeCertainlyNot,
+			reason: "gender differs",
+		},
+		{
+			name:  "unknown gender is ignored",
+			query: query,
+			candidate: model.Demographics{
+				GivenName: "Maria Cristina", MiddleName: "Santos", FamilyName: "Dela Cruz", BirthDate: "1980-05-02", Gender: "unknown",
+			},
+			score: 1,
+			grade: GradeCertain,
+		},
+		{
+			name:  "different person",
+			query: query,
+			candidate: model.Demographics{
+				GivenName: "Jose", FamilyName: "Rizal", BirthDate: "1861-06-19", Gender: "male",
+			},
+			score: 0,
+			grade: GradeCertainlyNot,
+		},
+	}
+
+	matcher := NewMatcher(3)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matcher.Compare(tt.query, tt.candidate)
+			// Scores are rounded to two decimals.
+			if math.Abs(got.Score-tt.score) > 0.006 {
+				t.Errorf("score = %v, want %v", got.Score, tt.score)
+			}
+			if got.Grade != tt.grade {
+				t.Errorf("grade = %q, want %q", got.Grade, tt.grade)
+			}
+			if tt.reason != "" && !containsReason(got.Reasons, tt.reason) {
+				t.Errorf("reasons = %q, want %q", got.Reasons, tt.reason)
+			}
+		})
+	}
+}
+
+func TestComparable(t *testing.T) {
+	tests := []struct {
+		query model.Demographics
+		want  bool
+	}{
+		{model.Demographics{FamilyName: "Dela Cruz"}, true},
+		{model.Demographics{BirthDate: "1980"}, true},
+		{model.Demographics{MiddleName: "Santos", Gender: "female"}, false},
+	}
+	for _, tt := range tests {
+		if got := Comparable(tt.query); got != tt.want {
+			t.Errorf("Comparable(%+v) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func containsReason(reasons []string, want string) bool {
+	for _, r := range reasons {
+		if strings.Contains(r, want) {
+			return true
+		}
+	}
+	return false
+}
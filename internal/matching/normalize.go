@@ -0,0 +1,128 @@
+package matching
+
+import "strings"
+
+var foldAccents = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ñ", "n",
+)
+
+// abbreviations common in Filipino names.
+var abbreviations = map[string]string{
+	"ma":  "maria",
+	"sta": "santa",
+	"sto": "santo",
+}
+
+var suffixes = map[string]bool{
+	"jr": true, "sr": true, "ii": true, "iii": true, "iv": true, "v": true,
+}
+
+// nameTokens lowercases a name, folds accents, expands abbreviations and
+// drops punctuation and generational suffixes.
+func nameTokens(name string) []string {
+	name = foldAccents.Replace(strings.ToLower(name))
+	fields := strings.FieldsFunc(name, func(r rune) bool {
+		return r == ' ' || r == '.' || r == ',' || r == '-' || r == '\''
+	})
+
+	var tokens []string
+	for _, f := range fields {
+		if suffixes[f] {
+			continue
+		}
+		if full, ok := abbreviations[f]; ok {
+			f = full
+		}
+		tokens = append(tokens, f)
+	}
+	return tokens
+}
+
+// normalizeSurname joins a surname's tokens so that "De la Cruz",
+// "Dela Cruz" and "Dela-Cruz" compare equal.
+func normalizeSurname(name string) string {
+	return strings.Join(nameTokens(name), "")
+}
+
+// phonetic returns a sound key tuned for Spanish and Tagalog spelling: the
+// first letter followed by the consonant skeleton, with letters that sound
+// alike merged (c/k/q, s/z/c, b/v, f/ph, silent h, i/y).
+func phonetic(name string) string {
+	s := strings.NewReplacer(
+		"ph", "f", "qu", "k", "ce", "se", "ci", "si", "ck", "k",
+		"c", "k", "z", "s", "v", "b", "x", "ks", "y", "i", "h", "",
+	).Replace(name)
+	if s == "" {
+		return ""
+	}
+
+	key := []byte{s[0]}
+	for i := 1; i < len(s); i++ {
+		ch := s[i]
+		if strings.IndexByte("aeiou", ch) >= 0 || ch == key[len(key)-1] {
+			continue
+		}
+		key = append(key, ch)
+	}
+	return string(key)
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of two strings.
+func jaroWinkler(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	la, lb := len(a), len(b)
+	if la == 0 || lb == 0 {
+		return 0
+	}
+
+	window := max(la, lb)/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matchedA := make([]bool, la)
+	matchedB := make([]bool, lb)
+	matches := 0
+	for i := 0; i < la; i++ {
+		lo, hi := max(0, i-window), min(lb, i+window+1)
+		for j := lo; j < hi; j++ {
+			if !matchedB[j] && a[i] == b[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions, j := 0, 0
+	for i := 0; i < la; i++ {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if a[i] != b[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(la) + m/float64(lb) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < 4 && prefix < la && prefix < lb && a[prefix] == b[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
@@ -0,0 +1,46 @@
+package model
+
+// PolicyRequestors selects requestors by provider ID, provider type or
+// group. A requestor matching any entry is selected.
+type PolicyRequestors struct {
+	ProviderIDs []string       `json:"providerIds,omitempty"`
+	Types       []ProviderType `json:"types,omitempty"`
+	Groups      []string       `json:"groups,omitempty"`
+}
+
+// AccessPolicy permits the selected requestors to request the listed
+// resource types from a target. Once a target has a policy, requests no
+// policy permits are denied.
+type AccessPolicy struct {
+	PolicyID         string           `json:"policyId"`
+	TargetProviderID string           `json:"targetProviderId"`
+	Description      string           `json:"description,omitempty"`
+	Requestors       PolicyRequestors `json:"requestors"`
+	// ResourceTypes is empty to permit every resource type.
+	ResourceTypes []string `json:"resourceTypes,omitempty"`
+	CreatedAt     string   `json:"createdAt"`
+	UpdatedAt     string   `json:"updatedAt"`
+}
+
+type PolicyEffect string
+
+const (
+	PolicyEffectPermit PolicyEffect = "PERMIT"
+	PolicyEffectDeny   PolicyEffect = "DENY"
+)
+
+// PolicyDecision records the evaluation of a target's access policies for
+// one request.
+type PolicyDecision struct {
+	DecisionID          string       `json:"decisionId"`
+	RequestorProviderID string       `json:"requestorProviderId"`
+	TargetProviderID    string       `json:"targetProviderId"`
+	ResourceType        string       `json:"resourceType"`
+	Decision            PolicyEffect `json:"decision"`
+	// PolicyID is the policy that permitted the request.
+	PolicyID string `json:"policyId,omitempty"`
+	// RequestID is set for permitted requests.
+	RequestID string `json:"requestId,omitempty"`
+	Reason    string `json:"reason"`
+	DecidedAt string `json:"decidedAt"`
+}
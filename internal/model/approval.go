@@ -0,0 +1,48 @@
+package model
+
+// ApprovalSettings route a target's incoming requests to human reviewers
+// before the target receives them.
+type ApprovalSettings struct {
+	Reviewers []string `json:"reviewers"`
+}
+
+type ApprovalStatus string
+
+const (
+	ApprovalStatusPending  ApprovalStatus = "PENDING"
+	ApprovalStatusApproved ApprovalStatus = "APPROVED"
+	ApprovalStatusDenied   ApprovalStatus = "DENIED"
+	// ApprovalStatusWithdrawn means the request was closed before a
+	// reviewer decided.
+	ApprovalStatusWithdrawn ApprovalStatus = "WITHDRAWN"
+)
+
+type ApprovalDecision string
+
+const (
+	ApprovalDecisionApprove ApprovalDecision = "APPROVE"
+	ApprovalDecisionDeny    ApprovalDecision = "DENY"
+)
+
+func (d ApprovalDecision) IsValid() bool {
+	return d == ApprovalDecisionApprove || d == ApprovalDecisionDeny
+}
+
+// Approval is a target-side manual review of an incoming request. The
+// reviewers work through the target's queue and the target provider
+// records their decision.
+type Approval struct {
+	ApprovalID          string           `json:"approvalId"`
+	RequestID           string           `json:"requestId"`
+	RequestorProviderID string           `json:"requestorProviderId"`
+	TargetProviderID    string           `json:"targetProviderId"`
+	PatientReference    PatientReference `json:"patientReference"`
+	PurposeOfUse        PurposeOfUse     `json:"purposeOfUse,omitempty"`
+	Reviewers           []string         `json:"reviewers"`
+	Status              ApprovalStatus   `json:"status"`
+	CreatedAt           string           `json:"createdAt"`
+	Decision            ApprovalDecision `json:"decision,omitempty"`
+	DecidedBy           string           `json:"decidedBy,omitempty"`
+	Reason              string           `json:"reason,omitempty"`
+	DecidedAt           string           `json:"decidedAt,omitempty"`
+}
@@ -0,0 +1,39 @@
+package model
+
+// AuditAction names an audited operation on provider or patient data.
+type AuditAction string
+
+const (
+	AuditActionProviderRegister AuditAction = "PROVIDER_REGISTER"
+	AuditActionProviderUpdate   AuditAction = "PROVIDER_UPDATE"
+	AuditActionRequestCreate    AuditAction = "REQUEST_CREATE"
+	AuditActionResponseSubmit   AuditAction = "RESPONSE_SUBMIT"
+	AuditActionRequestPoll      AuditAction = "REQUEST_POLL"
+	AuditActionResponseRead     AuditAction = "RESPONSE_READ"
+	AuditActionResponseDeliver  AuditAction = "RESPONSE_DELIVER"
+	AuditActionMPIRead          AuditAction = "MPI_READ"
+	AuditActionPatientMatch     AuditAction = "PATIENT_MATCH"
+)
+
+type AuditOutcome string
+
+const (
+	AuditOutcomeSuccess AuditOutcome = "SUCCESS"
+	AuditOutcomeDenied  AuditOutcome = "DENIED"
+	AuditOutcomeFailure AuditOutcome = "FAILURE"
+)
+
+// AuditEntry is one record of the append-only audit trail. Hash covers the
+// entry including PrevHash, chaining every entry to all entries before it.
+type AuditEntry struct {
+	Sequence           int64               `json:"sequence"`
+	Recorded           string              `json:"recorded"`
+	Action             AuditAction         `json:"action"`
+	Outcome            AuditOutcome        `json:"outcome"`
+	ProviderID         string              `json:"providerId,omitempty"`
+	RequestIDs         []string            `json:"requestIds,omitempty"`
+	PatientIdentifiers []PatientIdentifier `json:"patientIdentifiers,omitempty"`
+	Details            string              `json:"details,omitempty"`
+	PrevHash           string              `json:"prevHash"`
+	Hash               string              `json:"hash"`
+}
@@ -0,0 +1,44 @@
+package model
+
+// BreakGlass marks a request made under emergency access. It bypasses
+// consent gating and always produces a post-hoc review.
+type BreakGlass struct {
+	Reason    string `json:"reason"`
+	InvokedAt string `json:"invokedAt"`
+	ReviewID  string `json:"reviewId"`
+}
+
+type BreakGlassReviewStatus string
+
+const (
+	BreakGlassReviewPending  BreakGlassReviewStatus = "PENDING_REVIEW"
+	BreakGlassReviewReviewed BreakGlassReviewStatus = "REVIEWED"
+)
+
+type BreakGlassOutcome string
+
+const (
+	BreakGlassOutcomeJustified   BreakGlassOutcome = "JUSTIFIED"
+	BreakGlassOutcomeUnjustified BreakGlassOutcome = "UNJUSTIFIED"
+)
+
+func (o BreakGlassOutcome) IsValid() bool {
+	return o == BreakGlassOutcomeJustified || o == BreakGlassOutcomeUnjustified
+}
+
+// BreakGlassReview is the mandatory after-the-fact review of an emergency access.
+type BreakGlassReview struct {
+	ReviewID            string                 `json:"reviewId"`
+	RequestID           string                 `json:"requestId"`
+	RequestorProviderID string                 `json:"requestorProviderId"`
+	TargetProviderID    string                 `json:"targetProviderId"`
+	PatientReference    PatientReference       `json:"patientReference"`
+	Reason              string                 `json:"reason"`
+	InvokedAt           string                 `json:"invokedAt"`
+	DueAt               string                 `json:"dueAt"`
+	Status              BreakGlassReviewStatus `json:"status"`
+	Reviewer            string                 `json:"reviewer,omitempty"`
+	Outcome             BreakGlassOutcome      `json:"outcome,omitempty"`
+	Notes               string                 `json:"notes,omitempty"`
+	ReviewedAt          string                 `json:"reviewedAt,omitempty"`
+}
@@ -0,0 +1,40 @@
+package model
+
+import "encoding/json"
+
+type ConsentDecision string
+
+const (
+	ConsentDecisionPermit ConsentDecision = "permit"
+	ConsentDecisionDeny   ConsentDecision = "deny"
+)
+
+type ConsentStatus string
+
+const (
+	ConsentStatusActive   ConsentStatus = "active"
+	ConsentStatusInactive ConsentStatus = "inactive"
+)
+
+// Consent is a patient's sharing decision for one identifier, indexed by
+// the provider pair it applies to. An empty provider ID matches any provider.
+type Consent struct {
+	ConsentID           string            `json:"consentId"`
+	PatientIdentifier   PatientIdentifier `json:"patientIdentifier"`
+	RequestorProviderID string            `json:"requestorProviderId,omitempty"`
+	TargetProviderID    string            `json:"targetProviderId,omitempty"`
+	Decision            ConsentDecision   `json:"decision"`
+	Status              ConsentStatus     `json:"status"`
+	PurposesOfUse       []PurposeOfUse    `json:"purposesOfUse,omitempty"`
+	PeriodStart         string            `json:"periodStart,omitempty"`
+	PeriodEnd           string            `json:"periodEnd,omitempty"`
+	Resource            json.RawMessage   `json:"resource"`
+	CreatedAt           string            `json:"createdAt"`
+	UpdatedAt           string            `json:"updatedAt"`
+}
+
+// ConsentOverride records an emergency release without patient consent.
+type ConsentOverride struct {
+	Justification string `json:"justification"`
+	OverriddenAt  string `json:"overriddenAt"`
+}
@@ -0,0 +1,61 @@
+package model
+
+// CircuitState is the state of a callback URL's delivery circuit breaker.
+type CircuitState string
+
+const (
+	// CircuitClosed delivers normally.
+	CircuitClosed CircuitState = "CLOSED"
+	// CircuitOpen queues deliveries instead of attempting them.
+	CircuitOpen CircuitState = "OPEN"
+	// CircuitHalfOpen lets a single probe delivery through.
+	CircuitHalfOpen CircuitState = "HALF_OPEN"
+)
+
+// EndpointHealth tracks deliveries to one callback URL. Each URL has its
+// own circuit, so a provider's working callbacks keep receiving while
+// another of its URLs is down. A URL several providers use has one record.
+type EndpointHealth struct {
+	URL                 string       `json:"url"`
+	State               CircuitState `json:"state"`
+	Deliveries          int          `json:"deliveries"`
+	Failures            int          `json:"failures"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	LastLatencyMs       int64        `json:"lastLatencyMs"`
+	// AvgLatencyMs is an exponentially weighted moving average.
+	AvgLatencyMs  int64  `json:"avgLatencyMs"`
+	LastSuccessAt string `json:"lastSuccessAt,omitempty"`
+	LastFailureAt string `json:"lastFailureAt,omitempty"`
+	LastError     string `json:"lastError,omitempty"`
+	OpenedAt      string `json:"openedAt,omitempty"`
+	// NextProbeAt is when an open circuit lets a probe through.
+	NextProbeAt string `json:"nextProbeAt,omitempty"`
+	// QueuedDeliveries and FailedDeliveries are filled in when health is
+	// read.
+	QueuedDeliveries int `json:"queuedDeliveries"`
+	FailedDeliveries int `json:"failedDeliveries"`
+}
+
+// QueuedDelivery is a push held back by an open circuit or waiting to be
+// retried. It references the request rather than copying the payload,
+// which is rebuilt on delivery.
+type QueuedDelivery struct {
+	ProviderID string `json:"providerId"`
+	// Callback is the subscription ID.
+	Callback string `json:"callback"`
+	// URL is the subscription's URL when the delivery was queued, whose
+	// circuit holds it back.
+	URL       string       `json:"url"`
+	Event     WebhookEvent `json:"event"`
+	RequestID string       `json:"requestId"`
+	QueuedAt  string       `json:"queuedAt"`
+	// Attempts counts the failed attempts to deliver it.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// FailedDelivery is a queued delivery given up after the maximum number of
+// attempts. It is kept for operators and never retried.
+type FailedDelivery struct {
+	QueuedDelivery
+	FailedAt string `json:"failedAt"`
+}
@@ -0,0 +1,34 @@
+package model
+
+// CheckDigitAlgorithm names a check digit rule of an identifier system.
+type CheckDigitAlgorithm string
+
+const (
+	CheckDigitNone  CheckDigitAlgorithm = ""
+	CheckDigitLuhn  CheckDigitAlgorithm = "luhn"
+	CheckDigitMod11 CheckDigitAlgorithm = "mod11"
+)
+
+func (a CheckDigitAlgorithm) IsValid() bool {
+	switch a {
+	case CheckDigitNone, CheckDigitLuhn, CheckDigitMod11:
+		return true
+	}
+	return false
+}
+
+// IdentifierSystem is a registered patient identifier namespace. Aliases
+// are legacy free-text names that are rewritten to the canonical URI.
+type IdentifierSystem struct {
+	URI     string   `json:"uri"`
+	Display string   `json:"display"`
+	Aliases []string `json:"aliases,omitempty"`
+	// Pattern is a regular expression the whole value must match.
+	Pattern string `json:"pattern,omitempty"`
+	// StripSeparators removes spaces and hyphens from values before they
+	// are validated and stored.
+	StripSeparators bool                `json:"stripSeparators,omitempty"`
+	CheckDigit      CheckDigitAlgorithm `json:"checkDigit,omitempty"`
+	CreatedAt       string              `json:"createdAt"`
+	UpdatedAt       string              `json:"updatedAt"`
+}
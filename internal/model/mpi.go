@@ -0,0 +1,38 @@
+package model
+
+// MPIPerson is a master patient index entry: the identifiers that different
+// providers use for the same patient.
+type MPIPerson struct {
+	PersonID    string          `json:"personId"`
+	Identifiers []MPIIdentifier `json:"identifiers"`
+	// LocalIDs are the patient's resource IDs on provider systems.
+	LocalIDs []MPILocalID `json:"localIds,omitempty"`
+	// Demographics are taken from the latest Patient returned for the person.
+	Demographics *Demographics `json:"demographics,omitempty"`
+	CreatedAt    string        `json:"createdAt"`
+	UpdatedAt    string        `json:"updatedAt"`
+}
+
+// MPIIdentifier is a linked identifier and the providers known to use it.
+type MPIIdentifier struct {
+	System      string   `json:"system"`
+	Value       string   `json:"value"`
+	ProviderIDs []string `json:"providerIds,omitempty"`
+	// SourceRequestID is the exchange the link was learned from.
+	SourceRequestID string `json:"sourceRequestId,omitempty"`
+	LinkedAt        string `json:"linkedAt"`
+}
+
+type MPILocalID struct {
+	ProviderID string `json:"providerId"`
+	PatientID  string `json:"patientId"`
+}
+
+// MPIResolution records how the MPI expanded a request's patient reference.
+type MPIResolution struct {
+	PersonID string `json:"personId"`
+	// AddedIdentifiers are the target's identifiers added to the request.
+	AddedIdentifiers []PatientIdentifier `json:"addedIdentifiers,omitempty"`
+	// PatientID is set when the MPI supplied the target's resource ID.
+	PatientID string `json:"patientId,omitempty"`
+}
@@ -5,9 +5,18 @@ import "encoding/json"
 type RequestStatus string
 
 const (
-	RequestStatusPending   RequestStatus = "PENDING"
-	RequestStatusCompleted RequestStatus = "COMPLETED"
-	RequestStatusFailed    RequestStatus = "FAILED"
+	RequestStatusPending RequestStatus = "PENDING"
+	// RequestStatusAwaitingApproval means the target's reviewers have not
+	// yet decided; the target has not received the request.
+	RequestStatusAwaitingApproval RequestStatus = "AWAITING_APPROVAL"
+	RequestStatusCompleted        RequestStatus = "COMPLETED"
+	RequestStatusFailed           RequestStatus = "FAILED"
+	// RequestStatusCancelled means the request was withdrawn before the
+	// target answered, e.g. because its requestor was deactivated.
+	RequestStatusCancelled RequestStatus = "CANCELLED"
+	// RequestStatusConsentDenied means the patient has not consented to the
+	// exchange; no data is forwarded.
+	RequestStatusConsentDenied RequestStatus = "CONSENT_DENIED"
 )
 
 type PatientIdentifier struct {
@@ -18,11 +27,58 @@ type PatientIdentifier struct {
 type PatientReference struct {
 	ID          string              `json:"id,omitempty"`
 	Identifiers []PatientIdentifier `json:"identifiers,omitempty"`
+	// Demographics help the target find the patient when identifiers are
+	// missing or unknown to it.
+	Demographics *Demographics `json:"demographics,omitempty"`
+	// MatchToken names a patient found by demographic matching against
+	// the MPI. It is exchanged for the target's identifiers on creation.
+	MatchToken string `json:"matchToken,omitempty"`
+}
+
+// Demographics describe a patient for probabilistic matching. MiddleName
+// follows the Filipino convention of the mother's maiden surname.
+type Demographics struct {
+	GivenName  string `json:"givenName,omitempty"`
+	MiddleName string `json:"middleName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+	Suffix     string `json:"suffix,omitempty"`
+	// BirthDate is a FHIR date: YYYY, YYYY-MM or YYYY-MM-DD.
+	BirthDate string `json:"birthDate,omitempty"`
+	Gender    string `json:"gender,omitempty"`
+}
+
+// PurposeOfUse is a code from the HL7 v3 PurposeOfUse value set stating why
+// patient data is requested.
+type PurposeOfUse string
+
+const (
+	PurposeOfUseTreatment          PurposeOfUse = "TREAT"
+	PurposeOfUseEmergencyTreatment PurposeOfUse = "ETREAT"
+	PurposeOfUsePayment            PurposeOfUse = "HPAYMT"
+	PurposeOfUseOperations         PurposeOfUse = "HOPERAT"
+	PurposeOfUsePublicHealth       PurposeOfUse = "PUBHLTH"
+	PurposeOfUseResearch           PurposeOfUse = "HRESCH"
+	PurposeOfUsePatientRequest     PurposeOfUse = "PATRQT"
+)
+
+func (p PurposeOfUse) IsValid() bool {
+	switch p {
+	case PurposeOfUseTreatment, PurposeOfUseEmergencyTreatment, PurposeOfUsePayment,
+		PurposeOfUseOperations, PurposeOfUsePublicHealth, PurposeOfUseResearch, PurposeOfUsePatientRequest:
+		return true
+	}
+	return false
 }
 
 type FHIRConstraints struct {
 	ResourceType string `json:"resourceType"`
 	Version      string `json:"version"`
+	// Elements limits the returned resource to these top-level elements,
+	// like the FHIR _elements parameter. Empty means the full resource.
+	Elements     []string     `json:"elements,omitempty"`
+	PurposeOfUse PurposeOfUse `json:"purposeOfUse,omitempty"`
+	// Profile is the canonical URL of a profile the resource must conform to.
+	Profile string `json:"profile,omitempty"`
 }
 
 type RequestMetadata struct {
@@ -38,16 +94,50 @@ type PatientRequest struct {
 	PatientReference    PatientReference `json:"patientReference"`
 	FHIRConstraints     FHIRConstraints  `json:"fhirConstraints"`
 	Metadata            RequestMetadata  `json:"metadata,omitempty"`
-	Status              RequestStatus    `json:"status"`
-	CreatedAt           string           `json:"createdAt"`
-	UpdatedAt           string           `json:"updatedAt"`
+	ConsentOverride     *ConsentOverride `json:"consentOverride,omitempty"`
+	BreakGlass          *BreakGlass      `json:"breakGlass,omitempty"`
+	MPI                 *MPIResolution   `json:"mpi,omitempty"`
+	ApprovalID          string           `json:"approvalId,omitempty"`
+	// PolicyDecisionID is the access policy decision that permitted the request.
+	PolicyDecisionID string        `json:"policyDecisionId,omitempty"`
+	Status           RequestStatus `json:"status"`
+	CreatedAt        string        `json:"createdAt"`
+	UpdatedAt        string        `json:"updatedAt"`
+}
+
+// ForTarget returns the request as its target sees it: the patient
+// reference also carries the target's identifiers and resource ID resolved
+// by the MPI. Those stay in MPI on the stored request, so nothing the
+// requestor receives includes them.
+func (r PatientRequest) ForTarget() PatientRequest {
+	r.PatientReference.Identifiers = append([]PatientIdentifier{}, r.PatientReference.Identifiers...)
+	if r.MPI == nil {
+		return r
+	}
+	r.PatientReference.Identifiers = append(r.PatientReference.Identifiers, r.MPI.AddedIdentifiers...)
+	if r.MPI.PatientID != "" {
+		r.PatientReference.ID = r.MPI.PatientID
+	}
+	return r
 }
 
 type PatientResponse struct {
 	RequestID      string          `json:"requestId"`
 	FromProviderID string          `json:"fromProviderId"`
 	FHIRPatient    json.RawMessage `json:"fhirPatient,omitempty"`
-	Status         RequestStatus   `json:"status"`
-	Error          string          `json:"error,omitempty"`
-	ReceivedAt     string          `json:"receivedAt"`
+	FHIRVersion    string          `json:"fhirVersion,omitempty"`
+	// SourceFHIRVersion is set when the target answered in another FHIR
+	// version and FHIRPatient was converted to the requested one.
+	SourceFHIRVersion string `json:"sourceFhirVersion,omitempty"`
+	// Deidentified is set when FHIRPatient went through the research
+	// de-identification pipeline before storage.
+	Deidentified bool          `json:"deidentified,omitempty"`
+	Status       RequestStatus `json:"status"`
+	Error        string        `json:"error,omitempty"`
+	ReceivedAt   string        `json:"receivedAt"`
+	// DeliveredAt is when the requestor first received FHIRPatient, by
+	// callback or by reading the response.
+	DeliveredAt string `json:"deliveredAt,omitempty"`
+	// PurgedAt is when the retention policy removed FHIRPatient.
+	PurgedAt string `json:"purgedAt,omitempty"`
 }
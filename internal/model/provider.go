@@ -1,5 +1,7 @@
 package model
 
+import "strings"
+
 type ProviderType string
 
 const (
@@ -10,15 +12,115 @@ const (
 	ProviderTypeOther    ProviderType = "OTHER"
 )
 
+// ProviderStatus is whether a provider may take part in exchanges.
+type ProviderStatus string
+
+const (
+	// ProviderStatusPendingApproval is a registered provider waiting for an
+	// administrator to approve it.
+	ProviderStatusPendingApproval ProviderStatus = "PENDING_APPROVAL"
+	ProviderStatusActive          ProviderStatus = "ACTIVE"
+	// ProviderStatusSuspended is an approved provider an administrator has
+	// barred from exchanges until it is approved again.
+	ProviderStatusSuspended ProviderStatus = "SUSPENDED"
+	// ProviderStatusDeactivated is a soft delete: the provider is kept for
+	// the record but can no longer send or receive requests.
+	ProviderStatusDeactivated ProviderStatus = "DEACTIVATED"
+)
+
+func (s ProviderStatus) IsValid() bool {
+	switch s {
+	case ProviderStatusPendingApproval, ProviderStatusActive, ProviderStatusSuspended, ProviderStatusDeactivated:
+		return true
+	}
+	return false
+}
+
+// FHIRFormat is the wire format a provider uses for FHIR resources.
+type FHIRFormat string
+
+const (
+	FHIRFormatJSON FHIRFormat = "json"
+	FHIRFormatXML  FHIRFormat = "xml"
+)
+
+func (f FHIRFormat) IsValid() bool {
+	return f == FHIRFormatJSON || f == FHIRFormatXML
+}
+
+// ProviderEndpoints are paths on the provider's BaseURL that the gateway
+// calls itself.
 type ProviderEndpoints struct {
 	PatientRequest string `json:"patientRequest,omitempty"`
+	// Pull makes the gateway fetch the Patient from PatientRequest when a
+	// request is created, instead of waiting for the provider to respond.
+	Pull bool `json:"pull,omitempty"`
 }
 
+// PatientRequestURL is the URL the gateway pulls patient data from.
+func (e ProviderEndpoints) PatientRequestURL(baseURL string) string {
+	if e.PatientRequest == "" {
+		return ""
+	}
+	return strings.TrimRight(baseURL, "/") + "/" + strings.TrimLeft(e.PatientRequest, "/")
+}
+
+// ProviderCallback holds the callback URLs used before webhook
+// subscriptions existed. They still work as subscriptions of their own (see
+// Provider.Subscriptions).
 type ProviderCallback struct {
 	PatientRequest  string `json:"patientRequest,omitempty"`
 	PatientResponse string `json:"patientResponse,omitempty"`
 }
 
+// Subscription IDs of the legacy callback URLs.
+const (
+	CallbackPatientRequest  = "patientRequest"
+	CallbackPatientResponse = "patientResponse"
+)
+
+// CallbackPull names the verification record of the pull endpoint, which
+// is challenged like a subscription before it is sent patient identifiers.
+const CallbackPull = "pull"
+
+type CallbackVerificationStatus string
+
+const (
+	CallbackVerificationPending  CallbackVerificationStatus = "PENDING"
+	CallbackVerificationVerified CallbackVerificationStatus = "VERIFIED"
+	CallbackVerificationFailed   CallbackVerificationStatus = "FAILED"
+)
+
+// CallbackVerification records the ownership challenge of a subscription's
+// URL or the pull endpoint. The gateway only delivers to, and pulls from,
+// verified URLs.
+type CallbackVerification struct {
+	// Callback is the subscription ID, or CallbackPull.
+	Callback     string                     `json:"callback"`
+	URL          string                     `json:"url"`
+	Status       CallbackVerificationStatus `json:"status"`
+	ChallengedAt string                     `json:"challengedAt,omitempty"`
+	VerifiedAt   string                     `json:"verifiedAt,omitempty"`
+	Error        string                     `json:"error,omitempty"`
+}
+
+// ProviderLocation places a provider for directory searches. Region is
+// the administrative region, e.g. "NCR" or "Region VII".
+type ProviderLocation struct {
+	City     string `json:"city,omitempty"`
+	Province string `json:"province,omitempty"`
+	Region   string `json:"region,omitempty"`
+}
+
+// ProviderCapabilities declares what a provider can return. An empty list
+// places no restriction on that aspect.
+type ProviderCapabilities struct {
+	ResourceTypes     []string `json:"resourceTypes,omitempty"`
+	FHIRVersions      []string `json:"fhirVersions,omitempty"`
+	IdentifierSystems []string `json:"identifierSystems,omitempty"`
+	Profiles          []string `json:"profiles,omitempty"`
+}
+
 type Provider struct {
 	ProviderID string            `json:"providerId"`
 	Name       string            `json:"name"`
@@ -26,6 +128,46 @@ type Provider struct {
 	BaseURL    string            `json:"baseUrl"`
 	Endpoints  ProviderEndpoints `json:"endpoints,omitempty"`
 	Callback   ProviderCallback  `json:"callback"`
-	CreatedAt  string            `json:"createdAt"`
-	UpdatedAt  string            `json:"updatedAt"`
+	// Webhooks are the provider's event subscriptions besides Callback.
+	Webhooks   []WebhookSubscription `json:"webhooks,omitempty"`
+	FHIRFormat FHIRFormat            `json:"fhirFormat,omitempty"`
+	Location   *ProviderLocation     `json:"location,omitempty"`
+	// Groups name networks the provider belongs to, for access policies.
+	Groups []string `json:"groups,omitempty"`
+	// Capabilities is nil for providers that accept any request.
+	Capabilities *ProviderCapabilities `json:"capabilities,omitempty"`
+	// Approval, when set, holds incoming requests for manual review.
+	Approval *ApprovalSettings `json:"approval,omitempty"`
+	// CallbackVerification holds one record per subscription.
+	CallbackVerification []CallbackVerification `json:"callbackVerification,omitempty"`
+	// APIKeyHash is the SHA-256 of the provider's API key. The key itself
+	// is only shown when it is issued.
+	APIKeyHash string `json:"apiKeyHash,omitempty"`
+	// Status is empty for providers registered before statuses existed,
+	// which are active.
+	Status           ProviderStatus `json:"status,omitempty"`
+	ApprovedAt       string         `json:"approvedAt,omitempty"`
+	ApproveReason    string         `json:"approveReason,omitempty"`
+	SuspendedAt      string         `json:"suspendedAt,omitempty"`
+	SuspendReason    string         `json:"suspendReason,omitempty"`
+	DeactivatedAt    string         `json:"deactivatedAt,omitempty"`
+	DeactivateReason string         `json:"deactivateReason,omitempty"`
+	CreatedAt        string         `json:"createdAt"`
+	UpdatedAt        string         `json:"updatedAt"`
+}
+
+// IsActive reports whether the provider may send and receive requests.
+// Pending, suspended and deactivated providers may not.
+func (p Provider) IsActive() bool {
+	return p.Status == "" || p.Status == ProviderStatusActive
+}
+
+// CallbackVerified reports whether url passed its ownership challenge.
+func (p Provider) CallbackVerified(url string) bool {
+	for _, v := range p.CallbackVerification {
+		if v.URL == url && v.Status == CallbackVerificationVerified {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,103 @@
+package model
+
+// WebhookEvent is something that happened to a request that providers can
+// subscribe to.
+type WebhookEvent string
+
+const (
+	// WebhookEventRequestCreated is sent to the target when a request
+	// reaches it.
+	WebhookEventRequestCreated WebhookEvent = "request.created"
+	// WebhookEventRequestCancelled is sent to the target when the
+	// requestor withdraws a request.
+	WebhookEventRequestCancelled WebhookEvent = "request.cancelled"
+	// WebhookEventStatusChanged is sent to both parties whenever an
+	// existing request changes status.
+	WebhookEventStatusChanged WebhookEvent = "request.status_changed"
+	// WebhookEventRequestCompleted is sent to the requestor with the
+	// patient data.
+	WebhookEventRequestCompleted WebhookEvent = "request.completed"
+	// WebhookEventRequestFailed is sent to the requestor when the request
+	// failed or consent stopped the release.
+	WebhookEventRequestFailed WebhookEvent = "request.failed"
+)
+
+var WebhookEvents = []WebhookEvent{
+	WebhookEventRequestCreated,
+	WebhookEventRequestCancelled,
+	WebhookEventStatusChanged,
+	WebhookEventRequestCompleted,
+	WebhookEventRequestFailed,
+}
+
+func (e WebhookEvent) IsValid() bool {
+	for _, v := range WebhookEvents {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSubscription sends the events it lists to a URL. The ID names the
+// subscription in verification records and queued deliveries.
+type WebhookSubscription struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Events is empty for subscriptions that receive every event.
+	Events []WebhookEvent `json:"events,omitempty"`
+	// Secret, when set, signs each delivery with HMAC-SHA256.
+	Secret  string `json:"secret,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+// Receives reports whether the subscription wants event.
+func (w WebhookSubscription) Receives(event WebhookEvent) bool {
+	if !w.Enabled {
+		return false
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscriptions returns the provider's webhooks, preceded by the legacy
+// callback URLs as subscriptions named after them: patientRequest receives
+// new requests and patientResponse completed responses, as it always did.
+// Failures only reach webhooks subscribed to request.failed.
+func (p Provider) Subscriptions() []WebhookSubscription {
+	var subs []WebhookSubscription
+	if p.Callback.PatientRequest != "" {
+		subs = append(subs, WebhookSubscription{
+			ID:      CallbackPatientRequest,
+			URL:     p.Callback.PatientRequest,
+			Events:  []WebhookEvent{WebhookEventRequestCreated},
+			Enabled: true,
+		})
+	}
+	if p.Callback.PatientResponse != "" {
+		subs = append(subs, WebhookSubscription{
+			ID:      CallbackPatientResponse,
+			URL:     p.Callback.PatientResponse,
+			Events:  []WebhookEvent{WebhookEventRequestCompleted},
+			Enabled: true,
+		})
+	}
+	return append(subs, p.Webhooks...)
+}
+
+// Subscription returns the subscription with the given ID.
+func (p Provider) Subscription(id string) (WebhookSubscription, bool) {
+	for _, sub := range p.Subscriptions() {
+		if sub.ID == id {
+			return sub, true
+		}
+	}
+	return WebhookSubscription{}, false
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/wah4pc/gateway/internal/model"
+)
+
+var (
+	ErrAccessPolicyNotFound   = errors.New("access policy not found")
+	ErrPolicyDecisionNotFound = errors.New("policy decision not found")
+)
+
+// AccessPolicyRepository stores access policies and the decisions made
+// with them.
+type AccessPolicyRepository struct {
+	store              *JSONStore
+	collection         string
+	decisionCollection string
+}
+
+func NewAccessPolicyRepository(store *JSONStore) *AccessPolicyRepository {
+	return &AccessPolicyRepository{
+		store:              store,
+		collection:         "access_policies",
+		decisionCollection: "policy_decisions",
+	}
+}
+
+func (r *AccessPolicyRepository) GetAll() ([]model.AccessPolicy, error) {
+	var policies []model.AccessPolicy
+	if err := r.store.Load(r.collection, &policies); err != nil {
+		return nil, err
+	}
+	if policies == nil {
+		policies = []model.AccessPolicy{}
+	}
+	return policies, nil
+}
+
+func (r *AccessPolicyRepository) GetByID(policyID string) (*model.AccessPolicy, error) {
+	policies, err := r.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range policies {
+		if p.PolicyID == policyID {
+			return &p, nil
+		}
+	}
+
+	return nil, ErrAccessPolicyNotFound
+}
+
+func (r *AccessPolicyRepository) Create(policy model.AccessPolicy) error {
+	policies, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	policies = append(policies, policy)
+	return r.store.Save(r.collection, policies)
+}
+
+func (r *AccessPolicyRepository) Update(policy model.AccessPolicy) error {
+	policies, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for i, p := range policies {
+		if p.PolicyID == policy.PolicyID {
+			policies[i] = policy
+			return r.store.Save(r.collection, policies)
+		}
+	}
+
+	return ErrAccessPolicyNotFound
+}
+
+func (r *AccessPolicyRepository) Delete(policyID string) error {
+	policies, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for i, p := range policies {
+		if p.PolicyID == policyID {
+			policies = append(policies[:i], policies[i+1:]...)
+			return r.store.Save(r.collection, policies)
+		}
+	}
+
+	return ErrAccessPolicyNotFound
+}
+
+func (r *AccessPolicyRepository) GetAllDecisions() ([]model.PolicyDecision, error) {
+	var decisions []model.PolicyDecision
+	if err := r.store.Load(r.decisionCollection, &decisions); err != nil {
+		return nil, err
+	}
+	if decisions == nil {
+		decisions = []model.PolicyDecision{}
+	}
+	return decisions, nil
+}
+
+func (r *AccessPolicyRepository) GetDecisionByID(decisionID string) (*model.PolicyDecision, error) {
+	decisions, err := r.GetAllDecisions()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range decisions {
+		if d.DecisionID == decisionID {
+			return &d, nil
+		}
+	}
+
+	return nil, ErrPolicyDecisionNotFound
+}
+
+func (r *AccessPolicyRepository) CreateDecision(decision model.PolicyDecision) error {
+	decisions, err := r.GetAllDecisions()
+	if err != nil {
+		return err
+	}
+
+	decisions = append(decisions, decision)
+	return r.store.Save(r.decisionCollection, decisions)
+}
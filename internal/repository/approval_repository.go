@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/wah4pc/gateway/internal/model"
+)
+
+var ErrApprovalNotFound = errors.New("approval not found")
+
+type ApprovalRepository struct {
+	store      *JSONStore
+	collection string
+}
+
+func NewApprovalRepository(store *JSONStore) *ApprovalRepository {
+	return &ApprovalRepository{
+		store:      store,
+		collection: "approvals",
+	}
+}
+
+func (r *ApprovalRepository) GetAll() ([]model.Approval, error) {
+	var approvals []model.Approval
+	if err := r.store.Load(r.collection, &approvals); err != nil {
+		return nil, err
+	}
+	if approvals == nil {
+		approvals = []model.Approval{}
+	}
+
+	var err error
+	for i := range approvals {
+		if approvals[i].PatientReference, err = r.store.openReference(approvals[i].PatientReference); err != nil {
+			return nil, err
+		}
+	}
+	return approvals, nil
+}
+
+func (r *ApprovalRepository) GetByID(approvalID string) (*model.Approval, error) {
+	approvals, err := r.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range approvals {
+		if a.ApprovalID == approvalID {
+			return &a, nil
+		}
+	}
+
+	return nil, ErrApprovalNotFound
+}
+
+func (r *ApprovalRepository) Create(approval model.Approval) error {
+	approvals, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	approvals = append(approvals, approval)
+	return r.save(approvals)
+}
+
+func (r *ApprovalRepository) Update(approval model.Approval) error {
+	approvals, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for i, a := range approvals {
+		if a.ApprovalID == approval.ApprovalID {
+			approvals[i] = approval
+			return r.save(approvals)
+		}
+	}
+
+	return ErrApprovalNotFound
+}
+
+// Delete removes the approvals of the given requests.
+func (r *ApprovalRepository) Delete(requestIDs []string) error {
+	approvals, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	remove := make(map[string]bool, len(requestIDs))
+	for _, id := range requestIDs {
+		remove[id] = true
+	}
+
+	kept := approvals[:0]
+	for _, a := range approvals {
+		if !remove[a.RequestID] {
+			kept = append(kept, a)
+		}
+	}
+	return r.save(kept)
+}
+
+// save seals patient data in a copy of approvals before writing the collection.
+func (r *ApprovalRepository) save(approvals []model.Approval) error {
+	sealed := make([]model.Approval, len(approvals))
+	copy(sealed, approvals)
+
+	var err error
+	for i := range sealed {
+		if sealed[i].PatientReference, err = r.store.sealReference(sealed[i].PatientReference); err != nil {
+			return err
+		}
+	}
+	return r.store.Save(r.collection, sealed)
+}
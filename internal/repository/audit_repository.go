@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/wah4pc/gateway/internal/model"
+)
+
+// AuditRepository stores the audit trail as an append-only JSON lines file.
+// Entries are never updated or removed.
+type AuditRepository struct {
+	store      *JSONStore
+	collection string
+}
+
+func NewAuditRepository(store *JSONStore) *AuditRepository {
+	return &AuditRepository{
+		store:      store,
+		collection: "audit",
+	}
+}
+
+func (r *AuditRepository) GetAll() ([]model.AuditEntry, error) {
+	lines, err := r.store.LoadLines(r.collection)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]model.AuditEntry, 0, len(lines))
+	for i, line := range lines {
+		var entry model.AuditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("audit line %d: %w", i+1, err)
+		}
+		if entry.PatientIdentifiers, err = r.store.openIdentifiers(entry.PatientIdentifiers); err != nil {
+			return nil, fmt.Errorf("audit line %d: %w", i+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Append stores entry with its patient identifiers sealed. Hashes cover the
+// plaintext entry, so they verify regardless of encryption keys.
+func (r *AuditRepository) Append(entry model.AuditEntry) error {
+	var err error
+	if entry.PatientIdentifiers, err = r.store.sealIdentifiers(entry.PatientIdentifiers); err != nil {
+		return err
+	}
+	return r.store.Append(r.collection, entry)
+}
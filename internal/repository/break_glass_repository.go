@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/wah4pc/gateway/internal/model"
+)
+
+var ErrBreakGlassReviewNotFound = errors.New("break-glass review not found")
+
+type BreakGlassRepository struct {
+	store      *JSONStore
+	collection string
+}
+
+func NewBreakGlassRepository(store *JSONStore) *BreakGlassRepository {
+	return &BreakGlassRepository{
+		store:      store,
+		collection: "break_glass_reviews",
+	}
+}
+
+func (r *BreakGlassRepository) GetAll() ([]model.BreakGlassReview, error) {
+	var reviews []model.BreakGlassReview
+	if err := r.store.Load(r.collection, &reviews); err != nil {
+		return nil, err
+	}
+	if reviews == nil {
+		reviews = []model.BreakGlassReview{}
+	}
+
+	var err error
+	for i := range reviews {
+		if reviews[i].PatientReference, err = r.store.openReference(reviews[i].PatientReference); err != nil {
+			return nil, err
+		}
+	}
+	return reviews, nil
+}
+
+func (r *BreakGlassRepository) GetByID(reviewID string) (*model.BreakGlassReview, error) {
+	reviews, err := r.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rv := range reviews {
+		if rv.ReviewID == reviewID {
+			return &rv, nil
+		}
+	}
+
+	return nil, ErrBreakGlassReviewNotFound
+}
+
+func (r *BreakGlassRepository) Create(review model.BreakGlassReview) error {
+	reviews, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	reviews = append(reviews, review)
+	return r.save(reviews)
+}
+
+func (r *BreakGlassRepository) Update(review model.BreakGlassReview) error {
+	reviews, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for i, rv := range reviews {
+		if rv.ReviewID == review.ReviewID {
+			reviews[i] = review
+			return r.save(reviews)
+		}
+	}
+
+	return ErrBreakGlassReviewNotFound
+}
+
+// Delete removes the break-glass reviews of the given requests.
+func (r *BreakGlassRepository) Delete(requestIDs []string) error {
+	reviews, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	remove := make(map[string]bool, len(requestIDs))
+	for _, id := range requestIDs {
+		remove[id] = true
+	}
+
+	kept := reviews[:0]
+	for _, rv := range reviews {
+		if !remove[rv.RequestID] {
+			kept = append(kept, rv)
+		}
+	}
+	return r.save(kept)
+}
+
+// save seals patient data in a copy of reviews before writing the collection.
+func (r *BreakGlassRepository) save(reviews []model.BreakGlassReview) error {
+	sealed := make([]model.BreakGlassReview, len(reviews))
+	copy(sealed, reviews)
+
+	var err error
+	for i := range sealed {
+		if sealed[i].PatientReference, err = r.store.sealReference(sealed[i].PatientReference); err != nil {
+			return err
+		}
+	}
+	return r.store.Save(r.collection, sealed)
+}
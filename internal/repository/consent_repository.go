@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/wah4pc/gateway/internal/model"
+)
+
+var ErrConsentNotFound = errors.New("consent not found")
+
+type ConsentRepository struct {
+	store      *JSONStore
+	collection string
+}
+
+func NewConsentRepository(store *JSONStore) *ConsentRepository {
+	return &ConsentRepository{
+		store:      store,
+		collection: "consents",
+	}
+}
+
+func (r *ConsentRepository) GetAll() ([]model.Consent, error) {
+	var consents []model.Consent
+	if err := r.store.Load(r.collection, &consents); err != nil {
+		return nil, err
+	}
+	if consents == nil {
+		consents = []model.Consent{}
+	}
+
+	var err error
+	for i := range consents {
+		if consents[i].PatientIdentifier.Value, err = r.store.openString(consents[i].PatientIdentifier.Value); err != nil {
+			return nil, err
+		}
+		if consents[i].Resource, err = r.store.openJSON(consents[i].Resource); err != nil {
+			return nil, err
+		}
+	}
+	return consents, nil
+}
+
+func (r *ConsentRepository) GetByID(consentID string) (*model.Consent, error) {
+	consents, err := r.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range consents {
+		if c.ConsentID == consentID {
+			return &c, nil
+		}
+	}
+
+	return nil, ErrConsentNotFound
+}
+
+// GetByIdentifier returns all consents recorded for a patient identifier.
+func (r *ConsentRepository) GetByIdentifier(identifier model.PatientIdentifier) ([]model.Consent, error) {
+	consents, err := r.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []model.Consent
+	for _, c := range consents {
+		if c.PatientIdentifier == identifier {
+			filtered = append(filtered, c)
+		}
+	}
+
+	return filtered, nil
+}
+
+func (r *ConsentRepository) Create(consent model.Consent) error {
+	consents, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	consents = append(consents, consent)
+	return r.save(consents)
+}
+
+func (r *ConsentRepository) Update(consent model.Consent) error {
+	consents, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for i, c := range consents {
+		if c.ConsentID == consent.ConsentID {
+			consents[i] = consent
+			return r.save(consents)
+		}
+	}
+
+	return ErrConsentNotFound
+}
+
+// save seals patient data in a copy of consents before writing the collection.
+func (r *ConsentRepository) save(consents []model.Consent) error {
+	sealed := make([]model.Consent, len(consents))
+	copy(sealed, consents)
+
+	var err error
+	for i := range sealed {
+		if sealed[i].PatientIdentifier.Value, err = r.store.sealString(sealed[i].PatientIdentifier.Value); err != nil {
+			return err
+		}
+		if sealed[i].Resource, err = r.store.sealJSON(sealed[i].Resource); err != nil {
+			return err
+		}
+	}
+	return r.store.Save(r.collection, sealed)
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"github.com/wah4pc/gateway/internal/model"
+)
+
+// DeliveryRepository stores the delivery health of callback URLs and the
+// queue of deliveries held back by open circuits, along with those given up.
+type DeliveryRepository struct {
+	store            *JSONStore
+	collection       string
+	queueCollection  string
+	failedCollection string
+}
+
+func NewDeliveryRepository(store *JSONStore) *DeliveryRepository {
+	return &DeliveryRepository{
+		store:            store,
+		collection:       "provider_health",
+		queueCollection:  "delivery_queue",
+		failedCollection: "delivery_failed",
+	}
+}
+
+// GetAllHealth returns the health of every callback URL.
+func (r *DeliveryRepository) GetAllHealth() ([]model.EndpointHealth, error) {
+	var health []model.EndpointHealth
+	if err := r.store.Load(r.collection, &health); err != nil {
+		return nil, err
+	}
+	if health == nil {
+		health = []model.EndpointHealth{}
+	}
+	return health, nil
+}
+
+// GetHealth returns a URL's health, or nil if nothing was delivered to it
+// yet.
+func (r *DeliveryRepository) GetHealth(url string) (*model.EndpointHealth, error) {
+	health, err := r.GetAllHealth()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range health {
+		if h.URL == url {
+			return &h, nil
+		}
+	}
+	return nil, nil
+}
+
+// SaveHealth creates or replaces a URL's health record.
+func (r *DeliveryRepository) SaveHealth(h model.EndpointHealth) error {
+	health, err := r.GetAllHealth()
+	if err != nil {
+		return err
+	}
+
+	for i, existing := range health {
+		if existing.URL == h.URL {
+			health[i] = h
+			return r.store.Save(r.collection, health)
+		}
+	}
+
+	health = append(health, h)
+	return r.store.Save(r.collection, health)
+}
+
+func (r *DeliveryRepository) GetQueue() ([]model.QueuedDelivery, error) {
+	var queue []model.QueuedDelivery
+	if err := r.store.Load(r.queueCollection, &queue); err != nil {
+		return nil, err
+	}
+	if queue == nil {
+		queue = []model.QueuedDelivery{}
+	}
+	return queue, nil
+}
+
+func (r *DeliveryRepository) SaveQueue(queue []model.QueuedDelivery) error {
+	return r.store.Save(r.queueCollection, queue)
+}
+
+func (r *DeliveryRepository) GetFailed() ([]model.FailedDelivery, error) {
+	var failed []model.FailedDelivery
+	if err := r.store.Load(r.failedCollection, &failed); err != nil {
+		return nil, err
+	}
+	if failed == nil {
+		failed = []model.FailedDelivery{}
+	}
+	return failed, nil
+}
+
+func (r *DeliveryRepository) SaveFailed(failed []model.FailedDelivery) error {
+	return r.store.Save(r.failedCollection, failed)
+}
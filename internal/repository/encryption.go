@@ -0,0 +1,275 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/pkg/envelope"
+)
+
+var ErrNoKeyring = errors.New("stored data is encrypted but no encryption keys are configured")
+
+// Field level encryption of patient data. Repositories seal values on write
+// and open them on read, so callers only ever see plaintext. Values written
+// before encryption was enabled are read as they are and sealed on the next
+// write of their collection.
+
+func (s *JSONStore) sealString(value string) (string, error) {
+	if s.keyring == nil || value == "" || envelope.IsSealed(value) {
+		return value, nil
+	}
+	return s.keyring.Seal([]byte(value))
+}
+
+func (s *JSONStore) openString(value string) (string, error) {
+	if !envelope.IsSealed(value) {
+		return value, nil
+	}
+	if s.keyring == nil {
+		return "", ErrNoKeyring
+	}
+	plaintext, err := s.keyring.Open(value)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// sealJSON replaces a JSON value with a JSON string holding its sealed form.
+func (s *JSONStore) sealJSON(raw json.RawMessage) (json.RawMessage, error) {
+	if s.keyring == nil || len(raw) == 0 {
+		return raw, nil
+	}
+	sealed, err := s.keyring.Seal(raw)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sealed)
+}
+
+func (s *JSONStore) openJSON(raw json.RawMessage) (json.RawMessage, error) {
+	var sealed string
+	if len(raw) == 0 || raw[0] != '"' || json.Unmarshal(raw, &sealed) != nil || !envelope.IsSealed(sealed) {
+		return raw, nil
+	}
+	if s.keyring == nil {
+		return nil, ErrNoKeyring
+	}
+	return s.keyring.Open(sealed)
+}
+
+// sealIdentifiers returns a sealed copy; the system stays readable.
+func (s *JSONStore) sealIdentifiers(ids []model.PatientIdentifier) ([]model.PatientIdentifier, error) {
+	return s.mapIdentifiers(ids, s.sealString)
+}
+
+func (s *JSONStore) openIdentifiers(ids []model.PatientIdentifier) ([]model.PatientIdentifier, error) {
+	return s.mapIdentifiers(ids, s.openString)
+}
+
+func (s *JSONStore) mapIdentifiers(ids []model.PatientIdentifier, fn func(string) (string, error)) ([]model.PatientIdentifier, error) {
+	if ids == nil {
+		return nil, nil
+	}
+	result := make([]model.PatientIdentifier, len(ids))
+	for i, id := range ids {
+		value, err := fn(id.Value)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = model.PatientIdentifier{System: id.System, Value: value}
+	}
+	return result, nil
+}
+
+// Rekey re-seals every value in the store that was sealed with a key other
+// than the active one, and seals nothing else. It returns the number of
+// values rewritten. Retired keys can be removed from the keyring afterwards.
+func (s *JSONStore) Rekey() (int, error) {
+	if s.keyring == nil {
+		return 0, ErrNoKeyring
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	paths, err := filepath.Glob(filepath.Join(s.basePath, "*.json*"))
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return total, err
+		}
+
+		var n int
+		var out []byte
+		if strings.HasSuffix(path, ".jsonl") {
+			out, n, err = s.rekeyLines(data)
+		} else {
+			var v interface{}
+			if v, err = decodeGeneric(data); err != nil {
+				return total, fmt.Errorf("%s: %w", filepath.Base(path), err)
+			}
+			if v, n, err = s.rekeyValue(v); err == nil && n > 0 {
+				out, err = json.MarshalIndent(v, "", "  ")
+			}
+		}
+		if err != nil {
+			return total, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		if n == 0 {
+			continue
+		}
+		if err := os.WriteFile(path, out, 0600); err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (s *JSONStore) rekeyLines(data []byte) ([]byte, int, error) {
+	var out []byte
+	total := 0
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		v, err := decodeGeneric([]byte(line))
+		if err != nil {
+			return nil, 0, err
+		}
+		v, n, err := s.rekeyValue(v)
+		if err != nil {
+			return nil, 0, err
+		}
+		if n > 0 {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, 0, err
+			}
+			line = string(b)
+		}
+		total += n
+		out = append(out, line+"\n"...)
+	}
+	return out, total, nil
+}
+
+func (s *JSONStore) rekeyValue(v interface{}) (interface{}, int, error) {
+	total := 0
+	switch value := v.(type) {
+	case string:
+		if !envelope.IsSealed(value) || envelope.KeyID(value) == s.keyring.ActiveKeyID() {
+			return value, 0, nil
+		}
+		plaintext, err := s.keyring.Open(value)
+		if err != nil {
+			return nil, 0, err
+		}
+		sealed, err := s.keyring.Seal(plaintext)
+		return sealed, 1, err
+	case map[string]interface{}:
+		for k, item := range value {
+			item, n, err := s.rekeyValue(item)
+			if err != nil {
+				return nil, 0, err
+			}
+			value[k] = item
+			total += n
+		}
+	case []interface{}:
+		for i, item := range value {
+			item, n, err := s.rekeyValue(item)
+			if err != nil {
+				return nil, 0, err
+			}
+			value[i] = item
+			total += n
+		}
+	}
+	return v, total, nil
+}
+
+// decodeGeneric keeps numbers as written so rewriting does not alter them.
+func decodeGeneric(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	return v, err
+}
+
+func (s *JSONStore) sealReference(ref model.PatientReference) (model.PatientReference, error) {
+	return s.mapReference(ref, s.sealString)
+}
+
+func (s *JSONStore) openReference(ref model.PatientReference) (model.PatientReference, error) {
+	return s.mapReference(ref, s.openString)
+}
+
+func (s *JSONStore) mapReference(ref model.PatientReference, fn func(string) (string, error)) (model.PatientReference, error) {
+	id, err := fn(ref.ID)
+	if err != nil {
+		return ref, err
+	}
+	ids, err := s.mapIdentifiers(ref.Identifiers, fn)
+	if err != nil {
+		return ref, err
+	}
+	demographics, err := mapDemographics(ref.Demographics, fn)
+	if err != nil {
+		return ref, err
+	}
+	ref.ID, ref.Identifiers, ref.Demographics = id, ids, demographics
+	return ref, nil
+}
+
+// mapDemographics applies fn to every demographic field.
+func mapDemographics(d *model.Demographics, fn func(string) (string, error)) (*model.Demographics, error) {
+	if d == nil {
+		return nil, nil
+	}
+	result := *d
+	for _, field := range []*string{&result.GivenName, &result.MiddleName, &result.FamilyName, &result.Suffix, &result.BirthDate, &result.Gender} {
+		value, err := fn(*field)
+		if err != nil {
+			return nil, err
+		}
+		*field = value
+	}
+	return &result, nil
+}
+
+func (s *JSONStore) sealResolution(res *model.MPIResolution) (*model.MPIResolution, error) {
+	return s.mapResolution(res, s.sealString)
+}
+
+func (s *JSONStore) openResolution(res *model.MPIResolution) (*model.MPIResolution, error) {
+	return s.mapResolution(res, s.openString)
+}
+
+func (s *JSONStore) mapResolution(res *model.MPIResolution, fn func(string) (string, error)) (*model.MPIResolution, error) {
+	if res == nil {
+		return nil, nil
+	}
+	patientID, err := fn(res.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	added, err := s.mapIdentifiers(res.AddedIdentifiers, fn)
+	if err != nil {
+		return nil, err
+	}
+	return &model.MPIResolution{PersonID: res.PersonID, AddedIdentifiers: added, PatientID: patientID}, nil
+}
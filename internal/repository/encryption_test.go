@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/pkg/envelope"
+)
+
+func testKeyring(t *testing.T, ids ...string) (*envelope.Keyring, []string) {
+	t.Helper()
+	var entries []string
+	for _, id := range ids {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, id+":"+base64.StdEncoding.EncodeToString(key))
+	}
+	k, err := envelope.NewKeyring(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k, entries
+}
+
+func TestSealedAtRest(t *testing.T) {
+	keyring, _ := testKeyring(t, "k1")
+	dir := t.TempDir()
+	store, err := NewJSONStore(dir, keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestRepo := NewRequestRepository(store)
+	if err := requestRepo.Create(model.PatientRequest{
+		RequestID:        "REQ-1",
+		PatientReference: model.PatientReference{Identifiers: []model.PatientIdentifier{{System: "http://hospital-b.ph/mrn", Value: "CB-MRN-5678"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "requests.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "CB-MRN-5678") {
+		t.Error("identifier value is stored in plaintext")
+	}
+	if !strings.Contains(string(data), "http://hospital-b.ph/mrn") {
+		t.Error("identifier system is not readable at rest")
+	}
+
+	got, err := requestRepo.GetByID("REQ-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := got.PatientReference.Identifiers[0].Value; v != "CB-MRN-5678" {
+		t.Errorf("identifier value = %s, want CB-MRN-5678", v)
+	}
+
+	if _, err := NewRequestRepository(mustStore(t, dir, nil)).GetByID("REQ-1"); err != ErrNoKeyring {
+		t.Errorf("GetByID without keys error = %v, want ErrNoKeyring", err)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	_, entries := testKeyring(t, "k1", "k2")
+	dir := t.TempDir()
+
+	oldKeyring, err := envelope.NewKeyring(entries[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := mustStore(t, dir, oldKeyring)
+	if err := NewRequestRepository(before).Create(model.PatientRequest{
+		RequestID:        "REQ-1",
+		PatientReference: model.PatientReference{ID: "b-7", Identifiers: []model.PatientIdentifier{{System: "http://hospital-b.ph/mrn", Value: "CB-MRN-5678"}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	patient := json.RawMessage(`{"resourceType":"Patient","id":"b-7"}`)
+	if err := NewResponseRepository(before).Create(model.PatientResponse{RequestID: "REQ-1", FHIRPatient: patient}); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := envelope.NewKeyring(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := mustStore(t, dir, rotated)
+	n, err := store.Rekey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("Rekey() = %d, want 3", n)
+	}
+	if n, err := store.Rekey(); err != nil || n != 0 {
+		t.Errorf("second Rekey() = %d, %v, want 0, nil", n, err)
+	}
+
+	newKeyring, err := envelope.NewKeyring(entries[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := mustStore(t, dir, newKeyring)
+	request, err := NewRequestRepository(after).GetByID("REQ-1")
+	if err != nil {
+		t.Fatalf("GetByID with only the new key: %v", err)
+	}
+	if request.PatientReference.ID != "b-7" || request.PatientReference.Identifiers[0].Value != "CB-MRN-5678" {
+		t.Errorf("patient reference = %+v, want b-7 and CB-MRN-5678", request.PatientReference)
+	}
+	response, err := NewResponseRepository(after).GetByRequestID("REQ-1")
+	if err != nil {
+		t.Fatalf("GetByRequestID with only the new key: %v", err)
+	}
+	if string(response.FHIRPatient) != string(patient) {
+		t.Errorf("fhirPatient = %s, want %s", response.FHIRPatient, patient)
+	}
+}
+
+func TestRekeyWithoutKeyring(t *testing.T) {
+	if _, err := mustStore(t, t.TempDir(), nil).Rekey(); err != ErrNoKeyring {
+		t.Errorf("Rekey() error = %v, want ErrNoKeyring", err)
+	}
+}
+
+func mustStore(t *testing.T, dir string, keyring *envelope.Keyring) *JSONStore {
+	t.Helper()
+	store, err := NewJSONStore(dir, keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/wah4pc/gateway/internal/model"
+)
+
+var (
+	ErrIdentifierSystemNotFound      = errors.New("identifier system not found")
+	ErrIdentifierSystemAlreadyExists = errors.New("identifier system already exists")
+)
+
+type IdentifierSystemRepository struct {
+	store      *JSONStore
+	collection string
+}
+
+func NewIdentifierSystemRepository(store *JSONStore) *IdentifierSystemRepository {
+	return &IdentifierSystemRepository{
+		store:      store,
+		collection: "identifier_systems",
+	}
+}
+
+func (r *IdentifierSystemRepository) GetAll() ([]model.IdentifierSystem, error) {
+	var systems []model.IdentifierSystem
+	if err := r.store.Load(r.collection, &systems); err != nil {
+		return nil, err
+	}
+	if systems == nil {
+		systems = []model.IdentifierSystem{}
+	}
+	return systems, nil
+}
+
+func (r *IdentifierSystemRepository) GetByURI(uri string) (*model.IdentifierSystem, error) {
+	systems, err := r.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range systems {
+		if s.URI == uri {
+			return &s, nil
+		}
+	}
+
+	return nil, ErrIdentifierSystemNotFound
+}
+
+func (r *IdentifierSystemRepository) Create(system model.IdentifierSystem) error {
+	systems, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range systems {
+		if s.URI == system.URI {
+			return ErrIdentifierSystemAlreadyExists
+		}
+	}
+
+	systems = append(systems, system)
+	return r.store.Save(r.collection, systems)
+}
+
+func (r *IdentifierSystemRepository) Update(system model.IdentifierSystem) error {
+	systems, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for i, s := range systems {
+		if s.URI == system.URI {
+			systems[i] = system
+			return r.store.Save(r.collection, systems)
+		}
+	}
+
+	return ErrIdentifierSystemNotFound
+}
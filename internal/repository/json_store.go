@@ -1,22 +1,29 @@
 package repository
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"os"
 	"path/filepath"
 	"sync"
+
+	"github.com/wah4pc/gateway/pkg/envelope"
 )
 
 type JSONStore struct {
 	basePath string
+	keyring  *envelope.Keyring
 	mu       sync.RWMutex
 }
 
-func NewJSONStore(basePath string) (*JSONStore, error) {
-	if err := os.MkdirAll(basePath, 0755); err != nil {
+// NewJSONStore opens the store at basePath. With a keyring, repositories
+// encrypt patient data before it is written; a nil keyring stores plaintext.
+func NewJSONStore(basePath string, keyring *envelope.Keyring) (*JSONStore, error) {
+	if err := os.MkdirAll(basePath, 0700); err != nil {
 		return nil, err
 	}
-	return &JSONStore{basePath: basePath}, nil
+	return &JSONStore{basePath: basePath, keyring: keyring}, nil
 }
 
 func (s *JSONStore) filePath(collection string) string {
@@ -47,5 +54,57 @@ func (s *JSONStore) Save(collection string, v interface{}) error {
 		return err
 	}
 
-	return os.WriteFile(s.filePath(collection), data, 0644)
+	if err := os.WriteFile(s.filePath(collection), data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of existing files, which may predate 0600.
+	return os.Chmod(s.filePath(collection), 0600)
+}
+
+func (s *JSONStore) linesPath(collection string) string {
+	return filepath.Join(s.basePath, collection+".jsonl")
+}
+
+// Append writes v as a single JSON line to an append-only collection.
+func (s *JSONStore) Append(collection string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.linesPath(collection), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// LoadLines returns the raw lines of an append-only collection.
+func (s *JSONStore) LoadLines(collection string) ([][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := os.ReadFile(s.linesPath(collection))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			lines = append(lines, append([]byte(nil), line...))
+		}
+	}
+	return lines, scanner.Err()
 }
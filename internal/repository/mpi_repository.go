@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/wah4pc/gateway/internal/model"
+)
+
+var ErrMPIPersonNotFound = errors.New("MPI person not found")
+
+type MPIRepository struct {
+	store      *JSONStore
+	collection string
+}
+
+func NewMPIRepository(store *JSONStore) *MPIRepository {
+	return &MPIRepository{
+		store:      store,
+		collection: "mpi",
+	}
+}
+
+func (r *MPIRepository) GetAll() ([]model.MPIPerson, error) {
+	var persons []model.MPIPerson
+	if err := r.store.Load(r.collection, &persons); err != nil {
+		return nil, err
+	}
+	if persons == nil {
+		persons = []model.MPIPerson{}
+	}
+
+	for i := range persons {
+		p, err := r.mapPerson(persons[i], r.store.openString)
+		if err != nil {
+			return nil, err
+		}
+		persons[i] = p
+	}
+	return persons, nil
+}
+
+func (r *MPIRepository) GetByID(personID string) (*model.MPIPerson, error) {
+	persons, err := r.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range persons {
+		if p.PersonID == personID {
+			return &p, nil
+		}
+	}
+
+	return nil, ErrMPIPersonNotFound
+}
+
+// GetByIdentifier returns every person holding the identifier.
+func (r *MPIRepository) GetByIdentifier(identifier model.PatientIdentifier) ([]model.MPIPerson, error) {
+	persons, err := r.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var filtered []model.MPIPerson
+	for _, p := range persons {
+		for _, id := range p.Identifiers {
+			if id.System == identifier.System && id.Value == identifier.Value {
+				filtered = append(filtered, p)
+				break
+			}
+		}
+	}
+
+	return filtered, nil
+}
+
+// Replace stores person and removes the persons it was merged from in a
+// single write.
+func (r *MPIRepository) Replace(person model.MPIPerson, mergedIDs []string) error {
+	persons, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	remove := make(map[string]bool, len(mergedIDs))
+	for _, id := range mergedIDs {
+		remove[id] = true
+	}
+
+	kept := []model.MPIPerson{}
+	found := false
+	for _, p := range persons {
+		switch {
+		case p.PersonID == person.PersonID:
+			kept = append(kept, person)
+			found = true
+		case !remove[p.PersonID]:
+			kept = append(kept, p)
+		}
+	}
+	if !found {
+		kept = append(kept, person)
+	}
+	return r.save(kept)
+}
+
+// save seals identifier values and local IDs in a copy of persons before
+// writing the collection.
+func (r *MPIRepository) save(persons []model.MPIPerson) error {
+	sealed := make([]model.MPIPerson, len(persons))
+	for i := range persons {
+		p, err := r.mapPerson(persons[i], r.store.sealString)
+		if err != nil {
+			return err
+		}
+		sealed[i] = p
+	}
+	return r.store.Save(r.collection, sealed)
+}
+
+func (r *MPIRepository) mapPerson(p model.MPIPerson, fn func(string) (string, error)) (model.MPIPerson, error) {
+	identifiers := make([]model.MPIIdentifier, len(p.Identifiers))
+	for i, id := range p.Identifiers {
+		value, err := fn(id.Value)
+		if err != nil {
+			return p, err
+		}
+		id.Value = value
+		identifiers[i] = id
+	}
+
+	var localIDs []model.MPILocalID
+	for _, local := range p.LocalIDs {
+		patientID, err := fn(local.PatientID)
+		if err != nil {
+			return p, err
+		}
+		localIDs = append(localIDs, model.MPILocalID{ProviderID: local.ProviderID, PatientID: patientID})
+	}
+
+	demographics, err := mapDemographics(p.Demographics, fn)
+	if err != nil {
+		return p, err
+	}
+
+	p.Identifiers, p.LocalIDs, p.Demographics = identifiers, localIDs, demographics
+	return p, nil
+}
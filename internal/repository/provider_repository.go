@@ -66,6 +66,22 @@ func (r *ProviderRepository) Create(provider model.Provider) error {
 	return r.store.Save(r.collection, providers)
 }
 
+func (r *ProviderRepository) Update(provider model.Provider) error {
+	providers, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for i, p := range providers {
+		if p.ProviderID == provider.ProviderID {
+			providers[i] = provider
+			return r.store.Save(r.collection, providers)
+		}
+	}
+
+	return ErrProviderNotFound
+}
+
 func (r *ProviderRepository) Exists(providerID string) bool {
 	_, err := r.GetByID(providerID)
 	return err == nil
@@ -28,6 +28,16 @@ func (r *RequestRepository) GetAll() ([]model.PatientRequest, error) {
 	if requests == nil {
 		requests = []model.PatientRequest{}
 	}
+
+	var err error
+	for i := range requests {
+		if requests[i].PatientReference, err = r.store.openReference(requests[i].PatientReference); err != nil {
+			return nil, err
+		}
+		if requests[i].MPI, err = r.store.openResolution(requests[i].MPI); err != nil {
+			return nil, err
+		}
+	}
 	return requests, nil
 }
 
@@ -69,7 +79,7 @@ func (r *RequestRepository) Create(request model.PatientRequest) error {
 	}
 
 	requests = append(requests, request)
-	return r.store.Save(r.collection, requests)
+	return r.save(requests)
 }
 
 func (r *RequestRepository) Update(request model.PatientRequest) error {
@@ -81,9 +91,47 @@ func (r *RequestRepository) Update(request model.PatientRequest) error {
 	for i, req := range requests {
 		if req.RequestID == request.RequestID {
 			requests[i] = request
-			return r.store.Save(r.collection, requests)
+			return r.save(requests)
 		}
 	}
 
 	return ErrRequestNotFound
 }
+
+// Delete removes the given requests.
+func (r *RequestRepository) Delete(requestIDs []string) error {
+	requests, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	remove := make(map[string]bool, len(requestIDs))
+	for _, id := range requestIDs {
+		remove[id] = true
+	}
+
+	kept := requests[:0]
+	for _, req := range requests {
+		if !remove[req.RequestID] {
+			kept = append(kept, req)
+		}
+	}
+	return r.save(kept)
+}
+
+// save seals patient data in a copy of requests before writing the collection.
+func (r *RequestRepository) save(requests []model.PatientRequest) error {
+	sealed := make([]model.PatientRequest, len(requests))
+	copy(sealed, requests)
+
+	var err error
+	for i := range sealed {
+		if sealed[i].PatientReference, err = r.store.sealReference(sealed[i].PatientReference); err != nil {
+			return err
+		}
+		if sealed[i].MPI, err = r.store.sealResolution(sealed[i].MPI); err != nil {
+			return err
+		}
+	}
+	return r.store.Save(r.collection, sealed)
+}
@@ -28,6 +28,13 @@ func (r *ResponseRepository) GetAll() ([]model.PatientResponse, error) {
 	if responses == nil {
 		responses = []model.PatientResponse{}
 	}
+
+	var err error
+	for i := range responses {
+		if responses[i].FHIRPatient, err = r.store.openJSON(responses[i].FHIRPatient); err != nil {
+			return nil, err
+		}
+	}
 	return responses, nil
 }
 
@@ -53,5 +60,56 @@ func (r *ResponseRepository) Create(response model.PatientResponse) error {
 	}
 
 	responses = append(responses, response)
-	return r.store.Save(r.collection, responses)
+	return r.save(responses)
+}
+
+func (r *ResponseRepository) Update(response model.PatientResponse) error {
+	responses, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	for i, resp := range responses {
+		if resp.RequestID == response.RequestID {
+			responses[i] = response
+			return r.save(responses)
+		}
+	}
+
+	return ErrResponseNotFound
+}
+
+// Delete removes the responses of the given requests.
+func (r *ResponseRepository) Delete(requestIDs []string) error {
+	responses, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+
+	remove := make(map[string]bool, len(requestIDs))
+	for _, id := range requestIDs {
+		remove[id] = true
+	}
+
+	kept := responses[:0]
+	for _, resp := range responses {
+		if !remove[resp.RequestID] {
+			kept = append(kept, resp)
+		}
+	}
+	return r.save(kept)
+}
+
+// save seals patient data in a copy of responses before writing the collection.
+func (r *ResponseRepository) save(responses []model.PatientResponse) error {
+	sealed := make([]model.PatientResponse, len(responses))
+	copy(sealed, responses)
+
+	var err error
+	for i := range sealed {
+		if sealed[i].FHIRPatient, err = r.store.sealJSON(sealed[i].FHIRPatient); err != nil {
+			return err
+		}
+	}
+	return r.store.Save(r.collection, sealed)
 }
@@ -0,0 +1,226 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+var (
+	ErrAccessPolicyNotFound     = errors.New("access policy not found")
+	ErrPolicyDecisionNotFound   = errors.New("policy decision not found")
+	ErrPolicyRequestorsRequired = errors.New("requestors must list at least one provider ID, type or group")
+	ErrPolicyDenied             = errors.New("the target's access policies do not permit this request")
+)
+
+type AccessPolicyService struct {
+	repo         *repository.AccessPolicyRepository
+	providerRepo *repository.ProviderRepository
+	auditSvc     *AuditService
+}
+
+func NewAccessPolicyService(repo *repository.AccessPolicyRepository, providerRepo *repository.ProviderRepository, auditSvc *AuditService) *AccessPolicyService {
+	return &AccessPolicyService{repo: repo, providerRepo: providerRepo, auditSvc: auditSvc}
+}
+
+// AccessPolicyInput holds the fields of a policy set by its target.
+type AccessPolicyInput struct {
+	TargetProviderID string
+	Description      string
+	Requestors       model.PolicyRequestors
+	ResourceTypes    []string
+}
+
+// ListPolicies returns all policies, or those of one target.
+func (s *AccessPolicyService) ListPolicies(targetProviderID string) ([]model.AccessPolicy, error) {
+	policies, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []model.AccessPolicy{}
+	for _, p := range policies {
+		if targetProviderID == "" || p.TargetProviderID == targetProviderID {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered, nil
+}
+
+func (s *AccessPolicyService) GetPolicy(policyID string) (*model.AccessPolicy, error) {
+	policy, err := s.repo.GetByID(policyID)
+	if err == repository.ErrAccessPolicyNotFound {
+		return nil, ErrAccessPolicyNotFound
+	}
+	return policy, err
+}
+
+func (s *AccessPolicyService) CreatePolicy(input AccessPolicyInput) (*model.AccessPolicy, error) {
+	if err := s.validate(input); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	policy := model.AccessPolicy{
+		PolicyID:         newID("POL"),
+		TargetProviderID: input.TargetProviderID,
+		Description:      input.Description,
+		Requestors:       input.Requestors,
+		ResourceTypes:    input.ResourceTypes,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := s.repo.Create(policy); err != nil {
+		return nil, err
+	}
+
+	s.recordChange(&policy, "created")
+	return &policy, nil
+}
+
+// UpdatePolicy replaces a policy's rules. Its target cannot change.
+func (s *AccessPolicyService) UpdatePolicy(policyID string, input AccessPolicyInput) (*model.AccessPolicy, error) {
+	policy, err := s.GetPolicy(policyID)
+	if err != nil {
+		return nil, err
+	}
+	input.TargetProviderID = policy.TargetProviderID
+	if err := s.validate(input); err != nil {
+		return nil, err
+	}
+
+	policy.Description = input.Description
+	policy.Requestors = input.Requestors
+	policy.ResourceTypes = input.ResourceTypes
+	policy.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := s.repo.Update(*policy); err != nil {
+		return nil, err
+	}
+
+	s.recordChange(policy, "updated")
+	return policy, nil
+}
+
+// DeletePolicy removes a policy. Removing a target's last policy opens it
+// to every requestor again.
+func (s *AccessPolicyService) DeletePolicy(policyID string) error {
+	policy, err := s.GetPolicy(policyID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(policyID); err != nil {
+		return err
+	}
+
+	s.recordChange(policy, "deleted")
+	return nil
+}
+
+func (s *AccessPolicyService) validate(input AccessPolicyInput) error {
+	if !s.providerRepo.Exists(input.TargetProviderID) {
+		return ErrTargetNotFound
+	}
+	r := input.Requestors
+	if len(r.ProviderIDs) == 0 && len(r.Types) == 0 && len(r.Groups) == 0 {
+		return ErrPolicyRequestorsRequired
+	}
+	return nil
+}
+
+func (s *AccessPolicyService) recordChange(policy *model.AccessPolicy, change string) {
+	s.auditSvc.Record(model.AuditEntry{
+		Action:     model.AuditActionProviderUpdate,
+		Outcome:    model.AuditOutcomeSuccess,
+		ProviderID: policy.TargetProviderID,
+		Details:    "access policy " + policy.PolicyID + " " + change,
+	})
+}
+
+// Evaluate decides whether requestor may request resourceType from the
+// target and records the decision. Targets without policies accept every
+// requestor; no decision is recorded for them and nil is returned.
+func (s *AccessPolicyService) Evaluate(requestor *model.Provider, targetProviderID, resourceType, requestID string) (*model.PolicyDecision, error) {
+	policies, err := s.ListPolicies(targetProviderID)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	decision := model.PolicyDecision{
+		DecisionID:          newID("PDC"),
+		RequestorProviderID: requestor.ProviderID,
+		TargetProviderID:    targetProviderID,
+		ResourceType:        resourceType,
+		Decision:            model.PolicyEffectDeny,
+		Reason:              "no policy permits " + requestor.ProviderID + " to request " + resourceType,
+		DecidedAt:           time.Now().UTC().Format(time.RFC3339),
+	}
+	for _, p := range policies {
+		if policySelects(p.Requestors, requestor) && (len(p.ResourceTypes) == 0 || containsString(p.ResourceTypes, resourceType)) {
+			decision.Decision = model.PolicyEffectPermit
+			decision.PolicyID = p.PolicyID
+			decision.RequestID = requestID
+			decision.Reason = "permitted by " + p.PolicyID
+			break
+		}
+	}
+
+	if err := s.repo.CreateDecision(decision); err != nil {
+		return nil, err
+	}
+	return &decision, nil
+}
+
+func policySelects(r model.PolicyRequestors, requestor *model.Provider) bool {
+	if containsString(r.ProviderIDs, requestor.ProviderID) {
+		return true
+	}
+	for _, t := range r.Types {
+		if t == requestor.Type {
+			return true
+		}
+	}
+	for _, g := range requestor.Groups {
+		if containsString(r.Groups, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyDecisionFilter narrows ListDecisions. Empty fields match everything.
+type PolicyDecisionFilter struct {
+	TargetProviderID    string
+	RequestorProviderID string
+	Decision            model.PolicyEffect
+}
+
+func (s *AccessPolicyService) ListDecisions(filter PolicyDecisionFilter) ([]model.PolicyDecision, error) {
+	decisions, err := s.repo.GetAllDecisions()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []model.PolicyDecision{}
+	for _, d := range decisions {
+		if (filter.TargetProviderID != "" && d.TargetProviderID != filter.TargetProviderID) ||
+			(filter.RequestorProviderID != "" && d.RequestorProviderID != filter.RequestorProviderID) ||
+			(filter.Decision != "" && d.Decision != filter.Decision) {
+			continue
+		}
+		filtered = append(filtered, d)
+	}
+	return filtered, nil
+}
+
+func (s *AccessPolicyService) GetDecision(decisionID string) (*model.PolicyDecision, error) {
+	decision, err := s.repo.GetDecisionByID(decisionID)
+	if err == repository.ErrPolicyDecisionNotFound {
+		return nil, ErrPolicyDecisionNotFound
+	}
+	return decision, err
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+)
+
+var ErrInvalidAPIKey = errors.New("invalid provider API key")
+
+// apiKeyPrefix marks gateway API keys so leaked ones are easy to spot.
+const apiKeyPrefix = "wah4pc_"
+
+// newAPIKey returns a provider API key and the hash stored in its place.
+func newAPIKey() (key, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	key = apiKeyPrefix + hex.EncodeToString(b)
+	return key, hashAPIKey(key), nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueAPIKey replaces a provider's API key and returns the new one. The
+// old key stops working at once; only the hash of the new one is kept.
+func (s *ProviderService) IssueAPIKey(providerID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	provider, err := s.GetProvider(providerID)
+	if err != nil {
+		return "", err
+	}
+	key, hash, err := newAPIKey()
+	if err != nil {
+		return "", err
+	}
+	provider.APIKeyHash = hash
+	provider.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := s.repo.Update(*provider); err != nil {
+		return "", err
+	}
+
+	s.auditSvc.Record(model.AuditEntry{
+		Action:     model.AuditActionProviderUpdate,
+		Outcome:    model.AuditOutcomeSuccess,
+		ProviderID: provider.ProviderID,
+		Details:    "API key issued",
+	})
+	return key, nil
+}
+
+// AuthenticateProvider returns the provider holding key.
+func (s *ProviderService) AuthenticateProvider(key string) (*model.Provider, error) {
+	if key == "" {
+		return nil, ErrInvalidAPIKey
+	}
+	providers, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	hash := hashAPIKey(key)
+	for _, p := range providers {
+		if p.APIKeyHash != "" && p.APIKeyHash == hash {
+			return &p, nil
+		}
+	}
+	return nil, ErrInvalidAPIKey
+}
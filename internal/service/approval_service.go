@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+var (
+	ErrApprovalNotFound     = errors.New("approval not found")
+	ErrApprovalDecided      = errors.New("approval has already been decided")
+	ErrInvalidDecision      = errors.New("decision must be APPROVE or DENY")
+	ErrDenialReasonRequired = errors.New("a reason is required to deny a request")
+	ErrNotApprovalTarget    = errors.New("only the target provider may decide this approval")
+)
+
+type ApprovalService struct {
+	repo *repository.ApprovalRepository
+}
+
+func NewApprovalService(repo *repository.ApprovalRepository) *ApprovalService {
+	return &ApprovalService{repo: repo}
+}
+
+// Open routes a request to the target's reviewers.
+func (s *ApprovalService) Open(request *model.PatientRequest, reviewers []string) (*model.Approval, error) {
+	approval := model.Approval{
+		ApprovalID:          newID("APR"),
+		RequestID:           request.RequestID,
+		RequestorProviderID: request.RequestorProviderID,
+		TargetProviderID:    request.TargetProviderID,
+		PatientReference:    request.PatientReference,
+		PurposeOfUse:        request.FHIRConstraints.PurposeOfUse,
+		Reviewers:           reviewers,
+		Status:              model.ApprovalStatusPending,
+		CreatedAt:           time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if err := s.repo.Create(approval); err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
+
+// ApprovalFilter narrows ListApprovals. Empty fields match everything.
+type ApprovalFilter struct {
+	Status              model.ApprovalStatus
+	TargetProviderID    string
+	RequestorProviderID string
+	RequestID           string
+	// Reviewer limits the listing to approvals assigned to this reviewer.
+	Reviewer string
+}
+
+func (s *ApprovalService) ListApprovals(filter ApprovalFilter) ([]model.Approval, error) {
+	approvals, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []model.Approval{}
+	for _, a := range approvals {
+		if (filter.Status != "" && a.Status != filter.Status) ||
+			(filter.TargetProviderID != "" && a.TargetProviderID != filter.TargetProviderID) ||
+			(filter.RequestorProviderID != "" && a.RequestorProviderID != filter.RequestorProviderID) ||
+			(filter.RequestID != "" && a.RequestID != filter.RequestID) ||
+			(filter.Reviewer != "" && !containsString(a.Reviewers, filter.Reviewer)) {
+			continue
+		}
+		filtered = append(filtered, a)
+	}
+
+	return filtered, nil
+}
+
+func (s *ApprovalService) GetApproval(approvalID string) (*model.Approval, error) {
+	approval, err := s.repo.GetByID(approvalID)
+	if err == repository.ErrApprovalNotFound {
+		return nil, ErrApprovalNotFound
+	}
+	return approval, err
+}
+
+// ApprovalDecisionInput is a decision by DecidedBy, the authenticated
+// provider.
+type ApprovalDecisionInput struct {
+	DecidedBy string
+	Decision  model.ApprovalDecision
+	Reason    string
+}
+
+// Decide records the target's decision. Decisions are final.
+func (s *ApprovalService) Decide(approvalID string, input ApprovalDecisionInput) (*model.Approval, error) {
+	if !input.Decision.IsValid() {
+		return nil, ErrInvalidDecision
+	}
+	if input.Decision == model.ApprovalDecisionDeny && input.Reason == "" {
+		return nil, ErrDenialReasonRequired
+	}
+
+	approval, err := s.GetApproval(approvalID)
+	if err != nil {
+		return nil, err
+	}
+	if approval.Status != model.ApprovalStatusPending {
+		return nil, ErrApprovalDecided
+	}
+	if approval.TargetProviderID != input.DecidedBy {
+		return nil, ErrNotApprovalTarget
+	}
+
+	approval.Status = model.ApprovalStatusApproved
+	if input.Decision == model.ApprovalDecisionDeny {
+		approval.Status = model.ApprovalStatusDenied
+	}
+	approval.Decision = input.Decision
+	approval.DecidedBy = input.DecidedBy
+	approval.Reason = input.Reason
+	approval.DecidedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := s.repo.Update(*approval); err != nil {
+		return nil, err
+	}
+	return approval, nil
+}
+
+// Withdraw closes an undecided approval whose request was closed otherwise.
+func (s *ApprovalService) Withdraw(approvalID, reason string) error {
+	approval, err := s.GetApproval(approvalID)
+	if err != nil {
+		return err
+	}
+	if approval.Status != model.ApprovalStatusPending {
+		return nil
+	}
+
+	approval.Status = model.ApprovalStatusWithdrawn
+	approval.Reason = reason
+	approval.DecidedAt = time.Now().UTC().Format(time.RFC3339)
+	return s.repo.Update(*approval)
+}
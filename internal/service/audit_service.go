@@ -0,0 +1,208 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+// AuditService appends hash-chained entries to the audit trail. The hashes
+// are HMACs under a key kept outside the data directory, so the chain
+// cannot be rewritten by someone who can only edit the trail.
+type AuditService struct {
+	repo     *repository.AuditRepository
+	key      []byte
+	mu       sync.Mutex
+	lastSeq  int64
+	lastHash string
+}
+
+// NewAuditService resumes the chain from the last stored entry.
+func NewAuditService(repo *repository.AuditRepository, key []byte) (*AuditService, error) {
+	entries, err := repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &AuditService{repo: repo, key: key}
+	if n := len(entries); n > 0 {
+		s.lastSeq = entries[n-1].Sequence
+		s.lastHash = entries[n-1].Hash
+	}
+	return s, nil
+}
+
+// Record appends an entry. Sequence, timestamp and hashes are assigned here.
+// Failures are logged rather than failing the audited operation.
+func (s *AuditService) Record(entry model.AuditEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.Sequence = s.lastSeq + 1
+	entry.Recorded = time.Now().UTC().Format(time.RFC3339Nano)
+	entry.PrevHash = s.lastHash
+	hash, err := hashAuditEntry(s.key, entry)
+	if err != nil {
+		log.Printf("audit: failed to hash %s entry: %v", entry.Action, err)
+		return
+	}
+	entry.Hash = hash
+
+	if err := s.repo.Append(entry); err != nil {
+		log.Printf("audit: failed to append %s entry: %v", entry.Action, err)
+		return
+	}
+
+	s.lastSeq = entry.Sequence
+	s.lastHash = entry.Hash
+}
+
+// hashAuditEntry computes the HMAC-SHA256 of the entry with its Hash field
+// cleared.
+func hashAuditEntry(key []byte, entry model.AuditEntry) (string, error) {
+	entry.Hash = ""
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// AuditFilter narrows ListEntries. Empty fields match everything.
+type AuditFilter struct {
+	Action     model.AuditAction
+	ProviderID string
+	RequestID  string
+	From       time.Time
+	To         time.Time
+}
+
+func (s *AuditService) ListEntries(filter AuditFilter) ([]model.AuditEntry, error) {
+	entries, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []model.AuditEntry{}
+	for _, e := range entries {
+		if (filter.Action != "" && e.Action != filter.Action) ||
+			(filter.ProviderID != "" && e.ProviderID != filter.ProviderID) ||
+			(filter.RequestID != "" && !containsString(e.RequestIDs, filter.RequestID)) ||
+			!withinPeriod(e.Recorded, filter.From, filter.To) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	return filtered, nil
+}
+
+// AuditVerification is the result of checking the hash chain. Head is the
+// hash of the last entry; recorded elsewhere, it lets a later check notice
+// entries removed from the end.
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int    `json:"entries"`
+	Head     string `json:"head,omitempty"`
+	BrokenAt int64  `json:"brokenAt,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Verify checks the stored chain. Unlike VerifyAuditChain it also detects
+// entries removed from the end since this process last appended, or since
+// head, a previously reported head, was recorded.
+func (s *AuditService) Verify(head string) (*AuditVerification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := s.repo.GetAll()
+	if err != nil {
+		return &AuditVerification{Valid: false, Reason: err.Error()}, nil
+	}
+
+	result := VerifyAuditChain(s.key, entries)
+	if result.Valid && s.lastHash != "" && (len(entries) == 0 || entries[len(entries)-1].Hash != s.lastHash) {
+		result.Valid = false
+		result.BrokenAt = int64(len(entries))
+		result.Reason = "trailing entries were removed"
+	}
+	CheckAuditHead(result, entries, head)
+	return result, nil
+}
+
+// VerifyAuditChain recomputes every hash under key and checks the chain
+// links and sequence numbers.
+func VerifyAuditChain(key []byte, entries []model.AuditEntry) *AuditVerification {
+	result := &AuditVerification{Valid: true, Entries: len(entries)}
+	prevHash := ""
+	for i, e := range entries {
+		expectedSeq := int64(i + 1)
+		hash, err := hashAuditEntry(key, e)
+		if err != nil {
+			result.Reason = err.Error()
+		}
+
+		switch {
+		case result.Reason != "":
+		case e.Sequence != expectedSeq:
+			result.Reason = fmt.Sprintf("expected sequence %d, found %d", expectedSeq, e.Sequence)
+		case e.PrevHash != prevHash:
+			result.Reason = "prevHash does not match the preceding entry"
+		case e.Hash != hash:
+			result.Reason = "entry hash does not match its contents"
+		default:
+			prevHash = e.Hash
+			continue
+		}
+		result.Valid = false
+		result.BrokenAt = expectedSeq
+		return result
+	}
+	result.Head = prevHash
+	return result
+}
+
+// CheckAuditHead checks that the entry a previously recorded head names is
+// still in the chain, which catches entries removed from the end since.
+func CheckAuditHead(result *AuditVerification, entries []model.AuditEntry, head string) {
+	if !result.Valid || head == "" {
+		return
+	}
+	for _, e := range entries {
+		if e.Hash == head {
+			return
+		}
+	}
+	result.Valid = false
+	result.BrokenAt = int64(len(entries))
+	result.Reason = "the recorded head is no longer in the chain"
+}
+
+func withinPeriod(recorded string, from, to time.Time) bool {
+	if from.IsZero() && to.IsZero() {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339Nano, recorded)
+	if err != nil {
+		return false
+	}
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || !t.After(to))
+}
+
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
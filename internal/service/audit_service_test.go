@@ -0,0 +1,169 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+var testAuditKey = []byte("test-audit-key")
+
+func recordAuditEntries(t *testing.T, dir string, n int) *AuditService {
+	t.Helper()
+	store, err := repository.NewJSONStore(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := NewAuditService(repository.NewAuditRepository(store), testAuditKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		svc.Record(model.AuditEntry{
+			Action:     model.AuditActionRequestCreate,
+			Outcome:    model.AuditOutcomeSuccess,
+			ProviderID: "clinic-a",
+			RequestIDs: []string{"REQ-1"},
+		})
+	}
+	return svc
+}
+
+func TestAuditChain(t *testing.T) {
+	dir := t.TempDir()
+	recordAuditEntries(t, dir, 2)
+	// A restarted service continues the chain from the last stored entry.
+	svc := recordAuditEntries(t, dir, 1)
+
+	entries, err := svc.ListEntries(AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+	for i, e := range entries {
+		if e.Sequence != int64(i+1) {
+			t.Errorf("entry %d sequence = %d, want %d", i, e.Sequence, i+1)
+		}
+		if i > 0 && e.PrevHash != entries[i-1].Hash {
+			t.Errorf("entry %d prevHash does not link to entry %d", i+1, i)
+		}
+	}
+
+	result, err := svc.Verify("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Valid || result.Entries != 3 || result.Head != entries[2].Hash {
+		t.Errorf("Verify() = %+v, want a valid chain of 3 entries", result)
+	}
+}
+
+func TestVerifyAuditChainDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name         string
+		tamper       func([]model.AuditEntry) []model.AuditEntry
+		wantBrokenAt int64
+	}{
+		{"edited entry", func(e []model.AuditEntry) []model.AuditEntry {
+			e[1].ProviderID = "hospital-b"
+			return e
+		}, 2},
+		{"edited entry with its hash recomputed", func(e []model.AuditEntry) []model.AuditEntry {
+			e[1].Outcome = model.AuditOutcomeDenied
+			e[1].Hash, _ = hashAuditEntry(testAuditKey, e[1])
+			return e
+		}, 3},
+		{"chain rewritten without the key", func(e []model.AuditEntry) []model.AuditEntry {
+			e[1].Outcome = model.AuditOutcomeDenied
+			for i := 1; i < len(e); i++ {
+				e[i].PrevHash = e[i-1].Hash
+				e[i].Hash, _ = hashAuditEntry([]byte("guessed-key"), e[i])
+			}
+			return e
+		}, 2},
+		{"removed entry", func(e []model.AuditEntry) []model.AuditEntry {
+			return append(e[:1], e[2:]...)
+		}, 2},
+		{"reordered entries", func(e []model.AuditEntry) []model.AuditEntry {
+			e[1], e[2] = e[2], e[1]
+			return e
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := recordAuditEntries(t, t.TempDir(), 3).ListEntries(AuditFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := VerifyAuditChain(testAuditKey, tt.tamper(entries))
+			if result.Valid {
+				t.Fatal("VerifyAuditChain() = valid, want broken")
+			}
+			if result.BrokenAt != tt.wantBrokenAt {
+				t.Errorf("brokenAt = %d, want %d (%s)", result.BrokenAt, tt.wantBrokenAt, result.Reason)
+			}
+		})
+	}
+}
+
+func TestVerifyDetectsRemovedTrailingEntries(t *testing.T) {
+	dir := t.TempDir()
+	svc := recordAuditEntries(t, dir, 3)
+
+	path := filepath.Join(dir, "audit.jsonl")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(strings.TrimSpace(string(data)), "\n")
+	if err := os.WriteFile(path, []byte(strings.Join(lines[:2], "")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := svc.Verify("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid {
+		t.Error("Verify() = valid after the last entry was removed")
+	}
+}
+
+func TestVerifyDetectsTruncationBeforeRestart(t *testing.T) {
+	dir := t.TempDir()
+	svc := recordAuditEntries(t, dir, 3)
+	before, err := svc.Verify("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "audit.jsonl")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(strings.TrimSpace(string(data)), "\n")
+	if err := os.WriteFile(path, []byte(strings.Join(lines[:2], "")), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted service only knows the truncated chain; the head recorded
+	// earlier still shows the loss.
+	restarted := recordAuditEntries(t, dir, 0)
+	if result, err := restarted.Verify(""); err != nil || !result.Valid {
+		t.Fatalf("Verify() without a head = %+v, %v; want valid", result, err)
+	}
+	result, err := restarted.Verify(before.Head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid {
+		t.Error("Verify(head) = valid after the recorded head was removed")
+	}
+}
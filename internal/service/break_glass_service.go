@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+var (
+	ErrBreakGlassReviewNotFound  = errors.New("break-glass review not found")
+	ErrBreakGlassAlreadyReviewed = errors.New("break-glass access has already been reviewed")
+	ErrInvalidBreakGlassOutcome  = errors.New("outcome must be JUSTIFIED or UNJUSTIFIED")
+)
+
+// breakGlassReviewWindow is how long reviewers have to assess an emergency access.
+const breakGlassReviewWindow = 72 * time.Hour
+
+type BreakGlassService struct {
+	repo *repository.BreakGlassRepository
+}
+
+func NewBreakGlassService(repo *repository.BreakGlassRepository) *BreakGlassService {
+	return &BreakGlassService{repo: repo}
+}
+
+// OpenReview records the mandatory review of a break-glass request.
+func (s *BreakGlassService) OpenReview(request *model.PatientRequest, reason string) (*model.BreakGlassReview, error) {
+	now := time.Now().UTC()
+	review := model.BreakGlassReview{
+		ReviewID:            newID("BTG"),
+		RequestID:           request.RequestID,
+		RequestorProviderID: request.RequestorProviderID,
+		TargetProviderID:    request.TargetProviderID,
+		PatientReference:    request.PatientReference,
+		Reason:              reason,
+		InvokedAt:           now.Format(time.RFC3339),
+		DueAt:               now.Add(breakGlassReviewWindow).Format(time.RFC3339),
+		Status:              model.BreakGlassReviewPending,
+	}
+
+	if err := s.repo.Create(review); err != nil {
+		return nil, err
+	}
+
+	log.Printf("BREAK-GLASS: request %s from %s to %s invoked emergency access: %s (review %s due %s)",
+		request.RequestID, request.RequestorProviderID, request.TargetProviderID, reason, review.ReviewID, review.DueAt)
+	return &review, nil
+}
+
+// BreakGlassFilter narrows ListReviews. Empty fields match everything.
+type BreakGlassFilter struct {
+	Status              model.BreakGlassReviewStatus
+	RequestorProviderID string
+	TargetProviderID    string
+	// Overdue limits the listing to pending reviews past their due date.
+	Overdue bool
+}
+
+// ListReviews is the dedicated audit listing of break-glass accesses.
+func (s *BreakGlassService) ListReviews(filter BreakGlassFilter) ([]model.BreakGlassReview, error) {
+	reviews, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	filtered := []model.BreakGlassReview{}
+	for _, rv := range reviews {
+		if (filter.Status != "" && rv.Status != filter.Status) ||
+			(filter.RequestorProviderID != "" && rv.RequestorProviderID != filter.RequestorProviderID) ||
+			(filter.TargetProviderID != "" && rv.TargetProviderID != filter.TargetProviderID) ||
+			(filter.Overdue && (rv.Status != model.BreakGlassReviewPending || rv.DueAt > now)) {
+			continue
+		}
+		filtered = append(filtered, rv)
+	}
+
+	return filtered, nil
+}
+
+func (s *BreakGlassService) GetReview(reviewID string) (*model.BreakGlassReview, error) {
+	review, err := s.repo.GetByID(reviewID)
+	if err == repository.ErrBreakGlassReviewNotFound {
+		return nil, ErrBreakGlassReviewNotFound
+	}
+	return review, err
+}
+
+type CompleteReviewInput struct {
+	Reviewer string
+	Outcome  model.BreakGlassOutcome
+	Notes    string
+}
+
+// CompleteReview records the reviewer's assessment. Reviews are final.
+func (s *BreakGlassService) CompleteReview(reviewID string, input CompleteReviewInput) (*model.BreakGlassReview, error) {
+	if !input.Outcome.IsValid() {
+		return nil, ErrInvalidBreakGlassOutcome
+	}
+
+	review, err := s.GetReview(reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if review.Status == model.BreakGlassReviewReviewed {
+		return nil, ErrBreakGlassAlreadyReviewed
+	}
+
+	review.Status = model.BreakGlassReviewReviewed
+	review.Reviewer = input.Reviewer
+	review.Outcome = input.Outcome
+	review.Notes = input.Notes
+	review.ReviewedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if err := s.repo.Update(*review); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/pkg/httpclient"
+)
+
+var errChallengeMismatch = errors.New("response did not echo the challenge")
+
+// CallbackChallenge is posted to a callback URL to prove the provider
+// controls it. The URL must answer with the same challenge.
+type CallbackChallenge struct {
+	Type       string `json:"type"`
+	ProviderID string `json:"providerId"`
+	Callback   string `json:"callback"`
+	Challenge  string `json:"challenge"`
+}
+
+type callbackChallengeReply struct {
+	Challenge string `json:"challenge"`
+}
+
+// challengeTargets are the URLs a provider must prove it controls: its
+// subscriptions and, in pull mode, its pull endpoint.
+func challengeTargets(provider *model.Provider) []model.WebhookSubscription {
+	targets := provider.Subscriptions()
+	if provider.Endpoints.Pull {
+		targets = append(targets, model.WebhookSubscription{
+			ID:  model.CallbackPull,
+			URL: provider.Endpoints.PatientRequestURL(provider.BaseURL),
+		})
+	}
+	return targets
+}
+
+// syncVerification brings a provider's verification records in line with
+// its challenge targets: known URLs keep their record, new URLs need a
+// challenge. It reports whether any URL awaits one.
+func syncVerification(provider *model.Provider) bool {
+	var records []model.CallbackVerification
+	pending := false
+	for _, sub := range challengeTargets(provider) {
+		record := model.CallbackVerification{Callback: sub.ID, URL: sub.URL, Status: model.CallbackVerificationPending}
+		for _, v := range provider.CallbackVerification {
+			if v.Callback == sub.ID && v.URL == sub.URL {
+				record = v
+			}
+		}
+		// Ownership is proven per URL, so another subscription's verified
+		// record counts too.
+		if record.Status == model.CallbackVerificationPending {
+			for _, v := range provider.CallbackVerification {
+				if v.URL == sub.URL && v.Status == model.CallbackVerificationVerified {
+					record = v
+					record.Callback = sub.ID
+				}
+			}
+		}
+		if record.Status == model.CallbackVerificationPending {
+			pending = true
+		}
+		records = append(records, record)
+	}
+	provider.CallbackVerification = records
+	return pending
+}
+
+// VerifyCallbacks challenges the URL of each of a provider's subscriptions
+// and its pull endpoint, and records the outcome.
+func (s *ProviderService) VerifyCallbacks(providerID string) (*model.Provider, error) {
+	return s.verifyCallbacks(providerID, true)
+}
+
+// verifyCallbacks challenges the provider's callback URLs, or with all
+// false only those awaiting a challenge.
+func (s *ProviderService) verifyCallbacks(providerID string, all bool) (*model.Provider, error) {
+	provider, err := s.GetProvider(providerID)
+	if err != nil {
+		return nil, err
+	}
+	syncVerification(provider)
+
+	var results []model.CallbackVerification
+	for _, sub := range challengeTargets(provider) {
+		for _, v := range provider.CallbackVerification {
+			if v.Callback == sub.ID && (all || v.Status == model.CallbackVerificationPending) {
+				results = append(results, challengeCallback(providerID, sub))
+			}
+		}
+	}
+	if len(results) == 0 {
+		return provider, nil
+	}
+
+	// Challenges take a while; apply the results to the current record so
+	// that concurrent updates are kept, skipping URLs changed meanwhile.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	provider, err = s.GetProvider(providerID)
+	if err != nil {
+		return nil, err
+	}
+	syncVerification(provider)
+	for i, v := range provider.CallbackVerification {
+		for _, result := range results {
+			if result.Callback == v.Callback && result.URL == v.URL {
+				provider.CallbackVerification[i] = result
+				log.Printf("callback verification: provider %s %s %s: %s %s", providerID, result.Callback, result.URL, result.Status, result.Error)
+			}
+		}
+	}
+
+	if err := s.repo.Update(*provider); err != nil {
+		return nil, err
+	}
+	return provider, nil
+}
+
+// VerifyPendingCallbacks challenges the callbacks of active providers that
+// have not been challenged yet, such as those registered before
+// verification existed.
+func (s *ProviderService) VerifyPendingCallbacks() {
+	providers, err := s.repo.GetAll()
+	if err != nil {
+		log.Printf("callback verification: failed to load providers: %v", err)
+		return
+	}
+
+	for _, p := range providers {
+		if p.Status == model.ProviderStatusDeactivated || !syncVerification(&p) {
+			continue
+		}
+		if _, err := s.verifyCallbacks(p.ProviderID, false); err != nil {
+			log.Printf("callback verification: provider %s: %v", p.ProviderID, err)
+		}
+	}
+}
+
+// challengeCallback challenges a subscription's URL. The challenge is
+// signed like any delivery when the subscription has a secret.
+func challengeCallback(providerID string, sub model.WebhookSubscription) model.CallbackVerification {
+	now := time.Now().UTC().Format(time.RFC3339)
+	result := model.CallbackVerification{
+		Callback:     sub.ID,
+		URL:          sub.URL,
+		Status:       model.CallbackVerificationFailed,
+		ChallengedAt: now,
+	}
+
+	token, err := newChallengeToken()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var reply callbackChallengeReply
+	err = httpclient.PostJSONWith(sub.URL, CallbackChallenge{
+		Type:       "callback_verification",
+		ProviderID: providerID,
+		Callback:   sub.ID,
+		Challenge:  token,
+	}, httpclient.Options{Secret: sub.Secret}, &reply)
+	if err == nil && subtle.ConstantTimeCompare([]byte(reply.Challenge), []byte(token)) != 1 {
+		err = errChallengeMismatch
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Status = model.CallbackVerificationVerified
+	result.VerifiedAt = now
+	return result
+}
+
+func newChallengeToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
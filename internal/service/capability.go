@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+var ErrTargetIncapable = errors.New("target provider cannot fulfil this request")
+
+// normalizeCapabilities stores FHIR versions in their full form, so they
+// compare equal to normalized request versions.
+func normalizeCapabilities(c *model.ProviderCapabilities) {
+	if c == nil {
+		return
+	}
+	for i, v := range c.FHIRVersions {
+		if version, ok := fhir.NormalizeVersion(v); ok {
+			c.FHIRVersions[i] = version
+		}
+	}
+}
+
+// checkCapabilities rejects a request the target declared it cannot
+// fulfil. The error wraps ErrTargetIncapable and names what is missing.
+func (s *PatientService) checkCapabilities(request *model.PatientRequest, target *model.Provider) error {
+	c := target.Capabilities
+	if c == nil {
+		return nil
+	}
+	constraints := request.FHIRConstraints
+
+	if len(c.ResourceTypes) > 0 && !containsString(c.ResourceTypes, constraints.ResourceType) {
+		return fmt.Errorf("%w: resource type %s is not supported (supports %s)", ErrTargetIncapable, constraints.ResourceType, strings.Join(c.ResourceTypes, ", "))
+	}
+
+	// The gateway converts between releases where it can, so any declared
+	// version it can convert from is enough.
+	if len(c.FHIRVersions) > 0 {
+		supported := false
+		for _, v := range c.FHIRVersions {
+			if fhir.CanConvert(constraints.ResourceType, v, constraints.Version) {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("%w: FHIR version %s is not supported (supports %s)", ErrTargetIncapable, constraints.Version, strings.Join(c.FHIRVersions, ", "))
+		}
+	}
+
+	if constraints.Profile != "" && len(c.Profiles) > 0 && !containsString(c.Profiles, constraints.Profile) {
+		return fmt.Errorf("%w: profile %s is not supported", ErrTargetIncapable, constraints.Profile)
+	}
+
+	// Demographics let the target search without a known identifier.
+	if len(c.IdentifierSystems) > 0 && request.PatientReference.Demographics == nil {
+		known := false
+		for _, name := range c.IdentifierSystems {
+			system, err := s.identifierSvc.Canonical(name)
+			if err != nil {
+				return err
+			}
+			for _, id := range request.PatientReference.Identifiers {
+				if id.System == system {
+					known = true
+				}
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: none of the patient identifier systems is supported (supports %s)", ErrTargetIncapable, strings.Join(c.IdentifierSystems, ", "))
+		}
+	}
+	return nil
+}
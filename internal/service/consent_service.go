@@ -0,0 +1,224 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/fhirmap"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+var (
+	ErrInvalidConsent   = errors.New("invalid Consent resource")
+	ErrConsentNotFound  = errors.New("consent not found")
+	ErrNotConsentHolder = errors.New("only the provider holding a consent may manage it")
+)
+
+// ConsentMode decides what happens when no consent is on file.
+type ConsentMode string
+
+const (
+	// ConsentModeOptIn requires a permitting consent before data is shared.
+	ConsentModeOptIn ConsentMode = "opt-in"
+	// ConsentModeOptOut shares data unless a denying consent exists.
+	ConsentModeOptOut ConsentMode = "opt-out"
+)
+
+type ConsentService struct {
+	repo          *repository.ConsentRepository
+	identifierSvc *IdentifierSystemService
+	mode          ConsentMode
+}
+
+func NewConsentService(repo *repository.ConsentRepository, identifierSvc *IdentifierSystemService, mode ConsentMode) *ConsentService {
+	if mode != ConsentModeOptOut {
+		mode = ConsentModeOptIn
+	}
+	return &ConsentService{repo: repo, identifierSvc: identifierSvc, mode: mode}
+}
+
+// RegisterConsent stores a FHIR Consent resource. The patient is taken from
+// patient.identifier, the target (custodian) from organization and the
+// requestor from the first provision.actor. A non-empty holderID must be
+// the custodian; only the admin registers consents for any target.
+func (s *ConsentService) RegisterConsent(resource json.RawMessage, holderID string) (*model.Consent, error) {
+	var c fhir.Consent
+	if err := json.Unmarshal(resource, &c); err != nil || c.ResourceType != "Consent" {
+		return nil, ErrInvalidConsent
+	}
+	if c.Patient == nil || c.Patient.Identifier == nil || c.Patient.Identifier.Value == "" {
+		return nil, ErrInvalidConsent
+	}
+	if c.Provision == nil || (c.Provision.Type != string(model.ConsentDecisionPermit) && c.Provision.Type != string(model.ConsentDecisionDeny)) {
+		return nil, ErrInvalidConsent
+	}
+
+	// Consents must match requests, whose identifiers are normalized too.
+	identifiers, err := s.identifierSvc.Normalize([]model.PatientIdentifier{{
+		System: c.Patient.Identifier.System,
+		Value:  c.Patient.Identifier.Value,
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	consent := model.Consent{
+		ConsentID:         newID("CNS"),
+		PatientIdentifier: identifiers[0],
+		Decision:          model.ConsentDecision(c.Provision.Type),
+		Status:            model.ConsentStatusInactive,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	if c.Status == "active" {
+		consent.Status = model.ConsentStatusActive
+	}
+	if len(c.Organization) > 0 {
+		consent.TargetProviderID = fhirmap.ProviderIDFromReference(&c.Organization[0])
+	}
+	if len(c.Provision.Actor) > 0 {
+		consent.RequestorProviderID = fhirmap.ProviderIDFromReference(&c.Provision.Actor[0].Reference)
+	}
+	if holderID != "" && consent.TargetProviderID != holderID {
+		return nil, ErrNotConsentHolder
+	}
+	if c.Provision.Period != nil {
+		consent.PeriodStart = c.Provision.Period.Start
+		consent.PeriodEnd = c.Provision.Period.End
+	}
+	for _, p := range c.Provision.Purpose {
+		consent.PurposesOfUse = append(consent.PurposesOfUse, model.PurposeOfUse(p.Code))
+	}
+
+	// Keep the stored resource's id in step with the registry.
+	c.ID = consent.ConsentID
+	stored, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	consent.Resource = stored
+
+	if err := s.repo.Create(consent); err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (s *ConsentService) GetConsent(consentID string) (*model.Consent, error) {
+	consent, err := s.repo.GetByID(consentID)
+	if err == repository.ErrConsentNotFound {
+		return nil, ErrConsentNotFound
+	}
+	return consent, err
+}
+
+// ListConsents returns the consents for an identifier, or all consents
+// when the identifier is empty.
+func (s *ConsentService) ListConsents(identifier model.PatientIdentifier) ([]model.Consent, error) {
+	if identifier.Value == "" {
+		return s.repo.GetAll()
+	}
+
+	consents, err := s.repo.GetByIdentifier(identifier)
+	if err != nil {
+		return nil, err
+	}
+	if consents == nil {
+		consents = []model.Consent{}
+	}
+	return consents, nil
+}
+
+// RevokeConsent marks a consent inactive; it is kept for the record. A
+// non-empty holderID must be the consent's custodian.
+func (s *ConsentService) RevokeConsent(consentID, holderID string) (*model.Consent, error) {
+	consent, err := s.GetConsent(consentID)
+	if err != nil {
+		return nil, err
+	}
+	if holderID != "" && consent.TargetProviderID != holderID {
+		return nil, ErrNotConsentHolder
+	}
+
+	consent.Status = model.ConsentStatusInactive
+	consent.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := s.repo.Update(*consent); err != nil {
+		return nil, err
+	}
+	return consent, nil
+}
+
+// IsPermitted decides whether data about the patient may flow from target
+// to requestor for the given purpose. A matching deny always wins; otherwise
+// a matching permit allows, and the consent mode decides when none matches.
+func (s *ConsentService) IsPermitted(identifiers []model.PatientIdentifier, requestorID, targetID string, purpose model.PurposeOfUse) (bool, error) {
+	now := time.Now().UTC()
+	permitted := false
+
+	for _, identifier := range identifiers {
+		consents, err := s.repo.GetByIdentifier(identifier)
+		if err != nil {
+			return false, err
+		}
+
+		for _, c := range consents {
+			if !consentApplies(c, requestorID, targetID, purpose, now) {
+				continue
+			}
+			if c.Decision == model.ConsentDecisionDeny {
+				return false, nil
+			}
+			permitted = true
+		}
+	}
+
+	return permitted || s.mode == ConsentModeOptOut, nil
+}
+
+func consentApplies(c model.Consent, requestorID, targetID string, purpose model.PurposeOfUse, now time.Time) bool {
+	if c.Status != model.ConsentStatusActive {
+		return false
+	}
+	if (c.RequestorProviderID != "" && c.RequestorProviderID != requestorID) ||
+		(c.TargetProviderID != "" && c.TargetProviderID != targetID) {
+		return false
+	}
+	if len(c.PurposesOfUse) > 0 {
+		matched := false
+		for _, p := range c.PurposesOfUse {
+			if p == purpose {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if start, ok := parseFHIRDateTime(c.PeriodStart); ok && now.Before(start) {
+		return false
+	}
+	if end, ok := parseFHIRDateTime(c.PeriodEnd); ok {
+		// A date-only end covers the whole day.
+		if len(c.PeriodEnd) == len("2006-01-02") {
+			end = end.Add(24 * time.Hour)
+		}
+		if !now.Before(end) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseFHIRDateTime parses the date and dateTime forms used in periods.
+func parseFHIRDateTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,72 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+func newTestConsentService(t *testing.T) *ConsentService {
+	t.Helper()
+	store, err := repository.NewJSONStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identifierSvc, err := NewIdentifierSystemService(repository.NewIdentifierSystemRepository(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewConsentService(repository.NewConsentRepository(store), identifierSvc, ConsentModeOptIn)
+}
+
+func TestConsentHolder(t *testing.T) {
+	resource := func(organization string) json.RawMessage {
+		c := `{"resourceType":"Consent","status":"active",` +
+			`"patient":{"identifier":{"system":"urn:oid:2.16.840.1.113883.4.1","value":"123"}},` +
+			`"provision":{"type":"permit"}`
+		if organization != "" {
+			c += `,"organization":[{"reference":"Organization/` + organization + `"}]`
+		}
+		return json.RawMessage(c + `}`)
+	}
+
+	tests := []struct {
+		name         string
+		organization string
+		holderID     string
+		wantErr      error
+	}{
+		{"admin, any target", "", "", nil},
+		{"admin, named target", "hospital-b", "", nil},
+		{"custodian", "hospital-b", "hospital-b", nil},
+		{"other provider", "hospital-b", "clinic-a", ErrNotConsentHolder},
+		{"provider, any target", "", "clinic-a", ErrNotConsentHolder},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestConsentService(t)
+			_, err := svc.RegisterConsent(resource(tt.organization), tt.holderID)
+			if err != tt.wantErr {
+				t.Errorf("RegisterConsent error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	svc := newTestConsentService(t)
+	consent, err := svc.RegisterConsent(resource("hospital-b"), "hospital-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.RevokeConsent(consent.ConsentID, "clinic-a"); err != ErrNotConsentHolder {
+		t.Errorf("RevokeConsent by another provider error = %v, want ErrNotConsentHolder", err)
+	}
+	revoked, err := svc.RevokeConsent(consent.ConsentID, "hospital-b")
+	if err != nil {
+		t.Fatalf("RevokeConsent by the holder error = %v", err)
+	}
+	if revoked.Status != model.ConsentStatusInactive {
+		t.Errorf("status = %s, want inactive", revoked.Status)
+	}
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+var (
+	ErrDeliveryQueued = errors.New("callback circuit is open, delivery queued")
+	ErrCircuitOpen    = errors.New("callback circuit is open")
+	ErrDeliveryFailed = errors.New("delivery failed too many times, given up")
+)
+
+// latencyWeight is the weight of the newest sample in the latency average.
+const latencyWeight = 0.2
+
+// CircuitPolicy configures the per-URL delivery circuit breaker.
+type CircuitPolicy struct {
+	// FailureThreshold is the number of consecutive failed deliveries that
+	// opens the circuit.
+	FailureThreshold int
+	// OpenDuration is how long an open circuit waits before a probe.
+	OpenDuration time.Duration
+	// MaxAttempts is the number of failed attempts after which a queued
+	// delivery is given up. Zero retries forever.
+	MaxAttempts int
+}
+
+// DeliveryService tracks delivery health per callback URL and decides
+// whether a delivery is attempted or queued. Circuits are kept per URL
+// rather than per provider, so one unreachable URL does not hold back a
+// provider's other callbacks.
+type DeliveryService struct {
+	repo   *repository.DeliveryRepository
+	policy CircuitPolicy
+	mu     sync.Mutex
+}
+
+func NewDeliveryService(repo *repository.DeliveryRepository, policy CircuitPolicy) *DeliveryService {
+	return &DeliveryService{repo: repo, policy: policy}
+}
+
+// Allow reports whether a delivery to url may be attempted now. An open
+// circuit past its wait lets one probe through and turns half-open.
+func (s *DeliveryService) Allow(url string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	health, err := s.repo.GetHealth(url)
+	if err != nil {
+		log.Printf("delivery: failed to read health of %s: %v", url, err)
+		return true
+	}
+	if health == nil || health.State == model.CircuitClosed {
+		return true
+	}
+
+	now := time.Now().UTC()
+	if now.Format(time.RFC3339) < health.NextProbeAt {
+		return false
+	}
+
+	// A probe that never reported back is replaced after another wait.
+	health.State = model.CircuitHalfOpen
+	health.NextProbeAt = now.Add(s.policy.OpenDuration).Format(time.RFC3339)
+	if err := s.repo.SaveHealth(*health); err != nil {
+		log.Printf("delivery: failed to save health of %s: %v", url, err)
+	}
+	log.Printf("delivery: circuit of %s half-open, probing", url)
+	return true
+}
+
+// Record updates the health of url with the outcome of a delivery and
+// returns the resulting circuit state.
+func (s *DeliveryService) Record(url string, latency time.Duration, deliveryErr error) model.CircuitState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	health, err := s.repo.GetHealth(url)
+	if err != nil {
+		log.Printf("delivery: failed to read health of %s: %v", url, err)
+		return model.CircuitClosed
+	}
+	if health == nil {
+		health = &model.EndpointHealth{URL: url, State: model.CircuitClosed}
+	}
+
+	now := time.Now().UTC()
+	ms := latency.Milliseconds()
+	health.Deliveries++
+	health.LastLatencyMs = ms
+	if health.Deliveries == 1 {
+		health.AvgLatencyMs = ms
+	} else {
+		health.AvgLatencyMs = int64(float64(health.AvgLatencyMs)*(1-latencyWeight) + float64(ms)*latencyWeight)
+	}
+
+	if deliveryErr == nil {
+		if health.State != model.CircuitClosed {
+			log.Printf("delivery: circuit of %s closed", url)
+		}
+		health.State = model.CircuitClosed
+		health.ConsecutiveFailures = 0
+		health.LastSuccessAt = now.Format(time.RFC3339)
+		health.OpenedAt = ""
+		health.NextProbeAt = ""
+	} else {
+		health.Failures++
+		health.ConsecutiveFailures++
+		health.LastFailureAt = now.Format(time.RFC3339)
+		health.LastError = deliveryErr.Error()
+		if health.State == model.CircuitHalfOpen || health.ConsecutiveFailures >= s.policy.FailureThreshold {
+			if health.State != model.CircuitOpen {
+				log.Printf("delivery: circuit of %s opened after %d consecutive failures", url, health.ConsecutiveFailures)
+			}
+			health.State = model.CircuitOpen
+			health.OpenedAt = now.Format(time.RFC3339)
+			health.NextProbeAt = now.Add(s.policy.OpenDuration).Format(time.RFC3339)
+		}
+	}
+
+	if err := s.repo.SaveHealth(*health); err != nil {
+		log.Printf("delivery: failed to save health of %s: %v", url, err)
+	}
+	return health.State
+}
+
+// Enqueue holds a delivery until its URL's circuit lets it through. A
+// delivery already queued keeps its place, and one requeued after a failed
+// attempt keeps its original QueuedAt, so it is retried first. A delivery
+// that reached the policy's maximum attempts is moved to the failed
+// deliveries instead, and ErrDeliveryFailed returned.
+func (s *DeliveryService) Enqueue(item model.QueuedDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.policy.MaxAttempts > 0 && item.Attempts >= s.policy.MaxAttempts {
+		failed, err := s.repo.GetFailed()
+		if err != nil {
+			return err
+		}
+		failed = append(failed, model.FailedDelivery{
+			QueuedDelivery: item,
+			FailedAt:       time.Now().UTC().Format(time.RFC3339),
+		})
+		if err := s.repo.SaveFailed(failed); err != nil {
+			return err
+		}
+		log.Printf("delivery: gave up %s for %s to %s after %d attempts", item.Callback, item.RequestID, item.URL, item.Attempts)
+		return ErrDeliveryFailed
+	}
+
+	queue, err := s.repo.GetQueue()
+	if err != nil {
+		return err
+	}
+	for _, q := range queue {
+		if q.ProviderID == item.ProviderID && q.Callback == item.Callback && q.RequestID == item.RequestID && q.Event == item.Event {
+			return nil
+		}
+	}
+	if item.QueuedAt == "" {
+		item.QueuedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	return s.repo.SaveQueue(append(queue, item))
+}
+
+// Dequeue removes and returns the oldest delivery queued for url.
+func (s *DeliveryService) Dequeue(url string) (*model.QueuedDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queue, err := s.repo.GetQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	oldest := -1
+	for i, q := range queue {
+		if q.URL == url && (oldest < 0 || q.QueuedAt < queue[oldest].QueuedAt) {
+			oldest = i
+		}
+	}
+	if oldest < 0 {
+		return nil, nil
+	}
+
+	item := queue[oldest]
+	queue = append(queue[:oldest], queue[oldest+1:]...)
+	if err := s.repo.SaveQueue(queue); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ProbeDue lists URLs with deliveries waiting that may be attempted now:
+// those whose circuit is closed, which hold deliveries requeued after a
+// failed attempt, and those whose open circuit is due for a probe.
+func (s *DeliveryService) ProbeDue() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queue, err := s.repo.GetQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	seen := map[string]bool{}
+	var due []string
+	for _, q := range queue {
+		if seen[q.URL] {
+			continue
+		}
+		seen[q.URL] = true
+		health, err := s.repo.GetHealth(q.URL)
+		if err != nil {
+			return nil, err
+		}
+		if health == nil || health.State == model.CircuitClosed || now >= health.NextProbeAt {
+			due = append(due, q.URL)
+		}
+	}
+	return due, nil
+}
+
+// Health returns the delivery health of those of urls delivered to so far.
+// Health is kept per URL, so providers sharing a URL see the same record.
+func (s *DeliveryService) Health(urls []string) ([]model.EndpointHealth, error) {
+	health, err := s.AllHealth()
+	if err != nil {
+		return nil, err
+	}
+	return healthOf(health, urls), nil
+}
+
+// healthOf picks the records of urls out of health.
+func healthOf(health []model.EndpointHealth, urls []string) []model.EndpointHealth {
+	wanted := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		wanted[url] = true
+	}
+	var picked []model.EndpointHealth
+	for _, h := range health {
+		if wanted[h.URL] {
+			picked = append(picked, h)
+		}
+	}
+	return picked
+}
+
+// AllHealth returns the health of every URL delivered to so far.
+func (s *DeliveryService) AllHealth() ([]model.EndpointHealth, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	health, err := s.repo.GetAllHealth()
+	if err != nil {
+		return nil, err
+	}
+	queue, err := s.repo.GetQueue()
+	if err != nil {
+		return nil, err
+	}
+	failed, err := s.repo.GetFailed()
+	if err != nil {
+		return nil, err
+	}
+
+	queued := map[string]int{}
+	for _, q := range queue {
+		queued[q.URL]++
+	}
+	given := map[string]int{}
+	for _, f := range failed {
+		given[f.URL]++
+	}
+	for i := range health {
+		health[i].QueuedDeliveries = queued[health[i].URL]
+		health[i].FailedDeliveries = given[health[i].URL]
+	}
+	sort.Slice(health, func(i, j int) bool { return health[i].URL < health[j].URL })
+	return health, nil
+}
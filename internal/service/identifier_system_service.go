@@ -0,0 +1,272 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+var (
+	ErrInvalidIdentifier             = errors.New("invalid patient identifier")
+	ErrInvalidIdentifierSystem       = errors.New("identifier system needs a URI, a display name, a valid pattern and checkDigit luhn, mod11 or empty")
+	ErrIdentifierSystemNotFound      = errors.New("identifier system not found")
+	ErrIdentifierSystemAlreadyExists = errors.New("identifier system already exists")
+	ErrIdentifierAliasConflict       = errors.New("alias is already used by another identifier system")
+)
+
+// Canonical URIs of the built-in identifier systems.
+const (
+	SystemPhilHealthID = "http://philhealth.gov.ph/fhir/Identifier/philhealth-id"
+	SystemPhilSysPCN   = "http://philsys.gov.ph/fhir/Identifier/philsys-pcn"
+)
+
+// defaultIdentifierSystems seed an empty registry.
+var defaultIdentifierSystems = []model.IdentifierSystem{
+	{
+		URI:             SystemPhilHealthID,
+		Display:         "PhilHealth Identification Number (PIN)",
+		Aliases:         []string{"PHILHEALTH", "PHILHEALTH_ID", "PHILHEALTH_PIN", "PIN"},
+		Pattern:         `^[0-9]{12}$`,
+		StripSeparators: true,
+		// PhilHealth has not published the PIN check digit rule, so none
+		// is enforced until it can be verified against known PINs.
+		CheckDigit: model.CheckDigitNone,
+	},
+	{
+		URI:             SystemPhilSysPCN,
+		Display:         "PhilSys Card Number (PCN)",
+		Aliases:         []string{"NATIONAL_ID", "PHILSYS", "PHILSYS_ID", "PCN"},
+		Pattern:         `^[0-9]{16}$`,
+		StripSeparators: true,
+	},
+}
+
+// IdentifierSystemService is the registry of known patient identifier
+// systems. It validates identifiers and rewrites aliases to canonical URIs.
+type IdentifierSystemService struct {
+	repo *repository.IdentifierSystemRepository
+}
+
+// NewIdentifierSystemService opens the registry, seeding the built-in
+// systems on first use.
+func NewIdentifierSystemService(repo *repository.IdentifierSystemRepository) (*IdentifierSystemService, error) {
+	systems, err := repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(systems) == 0 {
+		now := time.Now().UTC().Format(time.RFC3339)
+		for _, system := range defaultIdentifierSystems {
+			system.CreatedAt, system.UpdatedAt = now, now
+			if err := repo.Create(system); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Registries seeded by earlier versions enforce an unverified mod11
+	// rule on PhilHealth PINs. Drop it unless an operator has since
+	// edited the system.
+	for _, system := range systems {
+		if system.URI == SystemPhilHealthID && system.CheckDigit == model.CheckDigitMod11 && system.UpdatedAt == system.CreatedAt {
+			system.CheckDigit = model.CheckDigitNone
+			if err := repo.Update(system); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &IdentifierSystemService{repo: repo}, nil
+}
+
+func (s *IdentifierSystemService) ListSystems() ([]model.IdentifierSystem, error) {
+	return s.repo.GetAll()
+}
+
+// RegisterSystem adds a system to the registry.
+func (s *IdentifierSystemService) RegisterSystem(system model.IdentifierSystem) (*model.IdentifierSystem, error) {
+	if err := s.validateSystem(system); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	system.CreatedAt, system.UpdatedAt = now, now
+	if err := s.repo.Create(system); err != nil {
+		if err == repository.ErrIdentifierSystemAlreadyExists {
+			return nil, ErrIdentifierSystemAlreadyExists
+		}
+		return nil, err
+	}
+	return &system, nil
+}
+
+// UpdateSystem replaces the definition of a registered system.
+func (s *IdentifierSystemService) UpdateSystem(system model.IdentifierSystem) (*model.IdentifierSystem, error) {
+	existing, err := s.repo.GetByURI(system.URI)
+	if err != nil {
+		if err == repository.ErrIdentifierSystemNotFound {
+			return nil, ErrIdentifierSystemNotFound
+		}
+		return nil, err
+	}
+	if err := s.validateSystem(system); err != nil {
+		return nil, err
+	}
+
+	system.CreatedAt = existing.CreatedAt
+	system.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := s.repo.Update(system); err != nil {
+		return nil, err
+	}
+	return &system, nil
+}
+
+func (s *IdentifierSystemService) validateSystem(system model.IdentifierSystem) error {
+	if !strings.Contains(system.URI, ":") || system.Display == "" || !system.CheckDigit.IsValid() {
+		return ErrInvalidIdentifierSystem
+	}
+	if _, err := regexp.Compile(system.Pattern); err != nil {
+		return ErrInvalidIdentifierSystem
+	}
+
+	systems, err := s.repo.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, other := range systems {
+		if other.URI == system.URI {
+			continue
+		}
+		for _, alias := range system.Aliases {
+			if strings.EqualFold(alias, other.URI) || containsFold(other.Aliases, alias) {
+				return ErrIdentifierAliasConflict
+			}
+		}
+	}
+	return nil
+}
+
+// Normalize validates identifiers against the registry and returns them
+// with aliases replaced by canonical URIs and separators stripped. Systems
+// that are not registered are accepted if they are URIs, so providers can
+// keep using their own MRN namespaces.
+func (s *IdentifierSystemService) Normalize(identifiers []model.PatientIdentifier) ([]model.PatientIdentifier, error) {
+	if len(identifiers) == 0 {
+		return identifiers, nil
+	}
+
+	systems, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	normalized := make([]model.PatientIdentifier, 0, len(identifiers))
+	for _, id := range identifiers {
+		id.System = strings.TrimSpace(id.System)
+		id.Value = strings.TrimSpace(id.Value)
+		if id.System == "" || id.Value == "" {
+			return nil, fmt.Errorf("%w: system and value are required", ErrInvalidIdentifier)
+		}
+
+		system := lookupIdentifierSystem(systems, id.System)
+		if system == nil {
+			if !strings.Contains(id.System, ":") {
+				return nil, fmt.Errorf("%w: system %q is not registered; use a URI or a registered alias", ErrInvalidIdentifier, id.System)
+			}
+			normalized = append(normalized, id)
+			continue
+		}
+
+		id.System = system.URI
+		if system.StripSeparators {
+			id.Value = strings.NewReplacer(" ", "", "-", "").Replace(id.Value)
+		}
+		if system.Pattern != "" {
+			re, err := regexp.Compile(system.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			if !re.MatchString(id.Value) {
+				return nil, fmt.Errorf("%w: %s value does not match %s", ErrInvalidIdentifier, system.Display, system.Pattern)
+			}
+		}
+		if !validCheckDigit(system.CheckDigit, id.Value) {
+			return nil, fmt.Errorf("%w: %s check digit is wrong", ErrInvalidIdentifier, system.Display)
+		}
+		normalized = append(normalized, id)
+	}
+	return normalized, nil
+}
+
+// Canonical returns the URI of a registered system named by URI or alias,
+// or name itself when it is not registered.
+func (s *IdentifierSystemService) Canonical(name string) (string, error) {
+	systems, err := s.repo.GetAll()
+	if err != nil {
+		return "", err
+	}
+	if system := lookupIdentifierSystem(systems, strings.TrimSpace(name)); system != nil {
+		return system.URI, nil
+	}
+	return strings.TrimSpace(name), nil
+}
+
+// lookupIdentifierSystem matches a URI exactly or an alias case-insensitively.
+func lookupIdentifierSystem(systems []model.IdentifierSystem, name string) *model.IdentifierSystem {
+	for i := range systems {
+		if systems[i].URI == name || containsFold(systems[i].Aliases, name) {
+			return &systems[i]
+		}
+	}
+	return nil
+}
+
+func containsFold(values []string, v string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// validCheckDigit checks the last digit of value. Values with non-digits
+// fail any algorithm.
+func validCheckDigit(algorithm model.CheckDigitAlgorithm, value string) bool {
+	if algorithm == model.CheckDigitNone {
+		return true
+	}
+	if len(value) < 2 || strings.Trim(value, "0123456789") != "" {
+		return false
+	}
+
+	switch algorithm {
+	case model.CheckDigitLuhn:
+		sum := 0
+		for i := 0; i < len(value); i++ {
+			d := int(value[len(value)-1-i] - '0')
+			if i%2 == 1 {
+				if d *= 2; d > 9 {
+					d -= 9
+				}
+			}
+			sum += d
+		}
+		return sum%10 == 0
+	case model.CheckDigitMod11:
+		// Weights 2, 3, 4, ... from the rightmost payload digit; a
+		// remainder that would need check digit 10 is never valid.
+		payload, check := value[:len(value)-1], int(value[len(value)-1]-'0')
+		sum := 0
+		for i := 0; i < len(payload); i++ {
+			sum += int(payload[len(payload)-1-i]-'0') * (i + 2)
+		}
+		expected := (11 - sum%11) % 11
+		return expected < 10 && expected == check
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+func TestValidCheckDigit(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm model.CheckDigitAlgorithm
+		value     string
+		want      bool
+	}{
+		{"none accepts anything", model.CheckDigitNone, "abc", true},
+		{"luhn valid", model.CheckDigitLuhn, "79927398713", true},
+		{"luhn wrong digit", model.CheckDigitLuhn, "79927398710", false},
+		{"luhn transposed digits", model.CheckDigitLuhn, "79927398731", false},
+		{"luhn non-digits", model.CheckDigitLuhn, "7992739871X", false},
+		{"luhn too short", model.CheckDigitLuhn, "0", false},
+		// 8*2 + 7*3 + 6*4 + 5*5 + 4*6 + 3*7 + 2*8 + 1*9 = 156, 11 - 156%11 = 9
+		{"mod11 valid", model.CheckDigitMod11, "123456789", true},
+		{"mod11 wrong digit", model.CheckDigitMod11, "123456788", false},
+		// 9*2 + ... + 1*10 = 210, 11 - 210%11 = 10, which no digit can hold
+		{"mod11 remainder needing 10", model.CheckDigitMod11, "1234567890", false},
+		// 0*2 + 1*3 = 3, 11 - 3 = 8
+		{"mod11 short valid", model.CheckDigitMod11, "108", true},
+		{"mod11 zero sum", model.CheckDigitMod11, "000", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validCheckDigit(tt.algorithm, tt.value); got != tt.want {
+				t.Errorf("validCheckDigit(%q, %q) = %v, want %v", tt.algorithm, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func newTestIdentifierSystemService(t *testing.T) *IdentifierSystemService {
+	t.Helper()
+	store, err := repository.NewJSONStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc, err := NewIdentifierSystemService(repository.NewIdentifierSystemRepository(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+func TestNormalize(t *testing.T) {
+	svc := newTestIdentifierSystemService(t)
+
+	tests := []struct {
+		name    string
+		in      model.PatientIdentifier
+		want    model.PatientIdentifier
+		wantErr bool
+	}{
+		{
+			name: "PhilHealth alias with separators",
+			in:   model.PatientIdentifier{System: "philhealth", Value: "12-345678901-2"},
+			want: model.PatientIdentifier{System: SystemPhilHealthID, Value: "123456789012"},
+		},
+		{
+			name:    "PhilHealth wrong length",
+			in:      model.PatientIdentifier{System: "PIN", Value: "12345"},
+			wantErr: true,
+		},
+		{
+			name: "NATIONAL_ID is a PCN",
+			in:   model.PatientIdentifier{System: "NATIONAL_ID", Value: "1234 5678 9012 3456"},
+			want: model.PatientIdentifier{System: SystemPhilSysPCN, Value: "1234567890123456"},
+		},
+		{
+			name:    "NATIONAL_ID free text",
+			in:      model.PatientIdentifier{System: "NATIONAL_ID", Value: "A-123"},
+			wantErr: true,
+		},
+		{
+			name: "unregistered URI",
+			in:   model.PatientIdentifier{System: "urn:clinic-b:mrn", Value: " B-123 "},
+			want: model.PatientIdentifier{System: "urn:clinic-b:mrn", Value: "B-123"},
+		},
+		{
+			name:    "unregistered free-text system",
+			in:      model.PatientIdentifier{System: "mrn-b", Value: "B-123"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.Normalize([]model.PatientIdentifier{tt.in})
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidIdentifier) {
+					t.Fatalf("Normalize(%v) error = %v, want ErrInvalidIdentifier", tt.in, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Normalize(%v): %v", tt.in, err)
+			}
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("Normalize(%v) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeededPhilHealthCheckDigitMigration(t *testing.T) {
+	tests := []struct {
+		name      string
+		updatedAt string
+		want      model.CheckDigitAlgorithm
+	}{
+		{"seeded and never edited", "2026-01-01T00:00:00Z", model.CheckDigitNone},
+		{"edited by an operator", "2026-02-01T00:00:00Z", model.CheckDigitMod11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := repository.NewJSONStore(t.TempDir(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			repo := repository.NewIdentifierSystemRepository(store)
+			if err := repo.Create(model.IdentifierSystem{
+				URI:        SystemPhilHealthID,
+				Display:    "PhilHealth Identification Number (PIN)",
+				Pattern:    `^[0-9]{12}$`,
+				CheckDigit: model.CheckDigitMod11,
+				CreatedAt:  "2026-01-01T00:00:00Z",
+				UpdatedAt:  tt.updatedAt,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := NewIdentifierSystemService(repo); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := repo.GetByURI(SystemPhilHealthID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.CheckDigit != tt.want {
+				t.Errorf("checkDigit = %q, want %q", got.CheckDigit, tt.want)
+			}
+		})
+	}
+}
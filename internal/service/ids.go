@@ -0,0 +1,15 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// newID returns a unique identifier such as CNS-20251205-1a2b3c4d.
+func newID(prefix string) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%s-%s", prefix, time.Now().UTC().Format("20060102"), hex.EncodeToString(b))
+}
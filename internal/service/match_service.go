@@ -0,0 +1,210 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/fhirmap"
+	"github.com/wah4pc/gateway/internal/matching"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+var (
+	ErrMatchQueryIncomplete  = errors.New("demographics need at least a family name, given name or birthDate")
+	ErrInvalidMatchCandidate = errors.New("each candidate needs an id and demographics or a FHIR Patient")
+	ErrMatchScopeRequired    = errors.New("candidates or targetProviderId is required")
+	ErrInvalidMatchToken     = errors.New("match token is unknown, expired or issued for another requestor or target")
+)
+
+// defaultMatchMinScore drops candidates graded certainly-not.
+const defaultMatchMinScore = 0.5
+
+// matchTokenTTL is how long an MPI match can be used in a request.
+const matchTokenTTL = time.Hour
+
+// MatchCandidate is a record supplied by the caller, typically a target
+// provider's own patients, given as demographics or a FHIR Patient.
+type MatchCandidate struct {
+	ID           string              `json:"id"`
+	Demographics *model.Demographics `json:"demographics,omitempty"`
+	Patient      json.RawMessage     `json:"patient,omitempty"`
+}
+
+type MatchInput struct {
+	// ProviderID is the caller.
+	ProviderID   string
+	Demographics model.Demographics
+	// Candidates to score. Without candidates the MPI persons known to
+	// TargetProviderID are searched.
+	Candidates       []MatchCandidate
+	TargetProviderID string
+	MinScore         float64
+	Limit            int
+}
+
+// MatchResult is a scored candidate. Caller supplied candidates carry
+// their ID. MPI matches carry only a match token, which the caller can use
+// in a request to the target in place of identifiers it does not know.
+type MatchResult struct {
+	CandidateID string `json:"candidateId,omitempty"`
+	MatchToken  string `json:"matchToken,omitempty"`
+	matching.Result
+	personID string
+}
+
+// matchToken is an issued MPI match, valid for one requestor and target.
+type matchToken struct {
+	personID    string
+	requestorID string
+	targetID    string
+	expiresAt   time.Time
+}
+
+type MatchService struct {
+	mpiRepo  *repository.MPIRepository
+	matcher  *matching.Matcher
+	auditSvc *AuditService
+	// tokens are kept in memory only; they expire within matchTokenTTL
+	// anyway.
+	tokens map[string]matchToken
+	mu     sync.Mutex
+}
+
+func NewMatchService(mpiRepo *repository.MPIRepository, matcher *matching.Matcher, auditSvc *AuditService) *MatchService {
+	return &MatchService{mpiRepo: mpiRepo, matcher: matcher, auditSvc: auditSvc, tokens: map[string]matchToken{}}
+}
+
+// Match scores candidates (or MPI persons) against the query demographics
+// and returns those above MinScore, best first. Every call is audited.
+func (s *MatchService) Match(input MatchInput) ([]MatchResult, error) {
+	if !matching.Comparable(input.Demographics) {
+		return nil, ErrMatchQueryIncomplete
+	}
+	if len(input.Candidates) == 0 && input.TargetProviderID == "" {
+		return nil, ErrMatchScopeRequired
+	}
+	if input.MinScore == 0 {
+		input.MinScore = defaultMatchMinScore
+	}
+
+	var results []MatchResult
+	if len(input.Candidates) > 0 {
+		for _, c := range input.Candidates {
+			demographics := c.Demographics
+			if demographics == nil && len(c.Patient) > 0 {
+				demographics = fhirmap.DemographicsFromPatient(c.Patient)
+			}
+			if c.ID == "" || demographics == nil {
+				return nil, ErrInvalidMatchCandidate
+			}
+			results = append(results, MatchResult{
+				CandidateID: c.ID,
+				Result:      s.matcher.Compare(input.Demographics, *demographics),
+			})
+		}
+	} else {
+		persons, err := s.mpiRepo.GetAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range persons {
+			if p.Demographics == nil || !knownTo(p, input.TargetProviderID) {
+				continue
+			}
+			result := s.matcher.Compare(input.Demographics, *p.Demographics)
+			// Reasons would describe the stored demographics.
+			result.Reasons = nil
+			results = append(results, MatchResult{Result: result, personID: p.PersonID})
+		}
+	}
+
+	filtered := []MatchResult{}
+	for _, r := range results {
+		if r.Score >= input.MinScore {
+			filtered = append(filtered, r)
+		}
+	}
+	sort.SliceStable(filtered, func(i, j int) bool { return filtered[i].Score > filtered[j].Score })
+	if input.Limit > 0 && len(filtered) > input.Limit {
+		filtered = filtered[:input.Limit]
+	}
+
+	details := fmt.Sprintf("%d candidates, %d matches", len(input.Candidates), len(filtered))
+	if len(input.Candidates) == 0 {
+		details = fmt.Sprintf("MPI for %s, %d matches", input.TargetProviderID, len(filtered))
+		for i := range filtered {
+			token, err := s.issueToken(filtered[i].personID, input.ProviderID, input.TargetProviderID)
+			if err != nil {
+				return nil, err
+			}
+			filtered[i].MatchToken = token
+		}
+	}
+	s.auditSvc.Record(model.AuditEntry{
+		Action:     model.AuditActionPatientMatch,
+		Outcome:    model.AuditOutcomeSuccess,
+		ProviderID: input.ProviderID,
+		Details:    details,
+	})
+	return filtered, nil
+}
+
+// knownTo reports whether the target uses any of the person's identifiers
+// or has a resource ID for it, so a match leads somewhere.
+func knownTo(p model.MPIPerson, targetProviderID string) bool {
+	for _, ident := range p.Identifiers {
+		if containsString(ident.ProviderIDs, targetProviderID) {
+			return true
+		}
+	}
+	for _, local := range p.LocalIDs {
+		if local.ProviderID == targetProviderID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MatchService) issueToken(personID, requestorID, targetID string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := "MT-" + hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for t, issued := range s.tokens {
+		if now.After(issued.expiresAt) {
+			delete(s.tokens, t)
+		}
+	}
+	s.tokens[token] = matchToken{
+		personID:    personID,
+		requestorID: requestorID,
+		targetID:    targetID,
+		expiresAt:   now.Add(matchTokenTTL),
+	}
+	return token, nil
+}
+
+// RedeemToken returns the MPI person of a match token issued to requestorID
+// for targetID.
+func (s *MatchService) RedeemToken(token, requestorID, targetID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	issued, ok := s.tokens[token]
+	if !ok || time.Now().After(issued.expiresAt) || issued.requestorID != requestorID || issued.targetID != targetID {
+		return "", ErrInvalidMatchToken
+	}
+	return issued.personID, nil
+}
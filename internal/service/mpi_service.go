@@ -0,0 +1,342 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/fhirmap"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+var (
+	ErrMPIPersonNotFound = errors.New("MPI person not found")
+	ErrMPIAmbiguous      = errors.New("identifiers belong to more than one MPI person")
+)
+
+// MPIService is the master patient index. It learns which identifiers refer
+// to the same patient from completed exchanges and translates identifiers
+// into those a target provider uses.
+type MPIService struct {
+	repo       *repository.MPIRepository
+	consentSvc *ConsentService
+	auditSvc   *AuditService
+	mu         sync.Mutex
+}
+
+func NewMPIService(repo *repository.MPIRepository, consentSvc *ConsentService, auditSvc *AuditService) *MPIService {
+	return &MPIService{repo: repo, consentSvc: consentSvc, auditSvc: auditSvc}
+}
+
+// Learn links the identifiers of a completed exchange: those the requestor
+// submitted and those in the Patient the target returned. Persons sharing
+// any of them are merged.
+func (s *MPIService) Learn(request *model.PatientRequest, resource json.RawMessage) {
+	type link struct {
+		id       model.PatientIdentifier
+		provider string
+	}
+	var links []link
+	for _, id := range request.PatientReference.Identifiers {
+		links = append(links, link{id, request.RequestorProviderID})
+	}
+	if request.MPI != nil {
+		for _, id := range request.MPI.AddedIdentifiers {
+			links = append(links, link{id, request.TargetProviderID})
+		}
+	}
+	returned := fhir.ResourceIdentifiers(resource)
+	for _, id := range returned {
+		if id.System != "" && id.Value != "" {
+			links = append(links, link{model.PatientIdentifier{System: id.System, Value: id.Value}, request.TargetProviderID})
+		}
+	}
+	localID := fhir.ResourceID(resource)
+
+	// Without anything from the target there is nothing to link.
+	if len(returned) == 0 && localID == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	seen := map[string]bool{}
+	var persons []model.MPIPerson
+	for _, l := range links {
+		matches, err := s.repo.GetByIdentifier(l.id)
+		if err != nil {
+			log.Printf("mpi: failed to look up identifier for request %s: %v", request.RequestID, err)
+			return
+		}
+		for _, p := range matches {
+			if !seen[p.PersonID] {
+				seen[p.PersonID] = true
+				persons = append(persons, p)
+			}
+		}
+	}
+
+	// The exchange proves all matched persons are one patient; merge them
+	// into the oldest.
+	person := &model.MPIPerson{PersonID: newID("MPI"), CreatedAt: now}
+	var mergedIDs []string
+	if len(persons) > 0 {
+		sort.Slice(persons, func(i, j int) bool { return persons[i].CreatedAt < persons[j].CreatedAt })
+		person = &persons[0]
+		for _, other := range persons[1:] {
+			mergedIDs = append(mergedIDs, other.PersonID)
+			for _, ident := range other.Identifiers {
+				for _, provider := range ident.ProviderIDs {
+					addMPIIdentifier(person, model.PatientIdentifier{System: ident.System, Value: ident.Value}, provider, ident.SourceRequestID, ident.LinkedAt)
+				}
+			}
+			for _, local := range other.LocalIDs {
+				addMPILocalID(person, local)
+			}
+		}
+	}
+
+	for _, l := range links {
+		addMPIIdentifier(person, l.id, l.provider, request.RequestID, now)
+	}
+	if localID != "" {
+		addMPILocalID(person, model.MPILocalID{ProviderID: request.TargetProviderID, PatientID: localID})
+	}
+	if demographics := fhirmap.DemographicsFromPatient(resource); demographics != nil {
+		person.Demographics = demographics
+	}
+	person.UpdatedAt = now
+
+	if err := s.repo.Replace(*person, mergedIDs); err != nil {
+		log.Printf("mpi: failed to store links from request %s: %v", request.RequestID, err)
+		return
+	}
+	if len(mergedIDs) > 0 {
+		log.Printf("mpi: request %s merged %v into %s", request.RequestID, mergedIDs, person.PersonID)
+	}
+}
+
+func addMPIIdentifier(person *model.MPIPerson, id model.PatientIdentifier, providerID, requestID, linkedAt string) {
+	for i := range person.Identifiers {
+		existing := &person.Identifiers[i]
+		if existing.System != id.System || existing.Value != id.Value {
+			continue
+		}
+		if !containsString(existing.ProviderIDs, providerID) {
+			existing.ProviderIDs = append(existing.ProviderIDs, providerID)
+		}
+		return
+	}
+	person.Identifiers = append(person.Identifiers, model.MPIIdentifier{
+		System:          id.System,
+		Value:           id.Value,
+		ProviderIDs:     []string{providerID},
+		SourceRequestID: requestID,
+		LinkedAt:        linkedAt,
+	})
+}
+
+func addMPILocalID(person *model.MPIPerson, local model.MPILocalID) {
+	for i, existing := range person.LocalIDs {
+		if existing.ProviderID == local.ProviderID {
+			person.LocalIDs[i] = local
+			return
+		}
+	}
+	person.LocalIDs = append(person.LocalIDs, local)
+}
+
+// Resolve finds the person behind a patient reference and returns the
+// identifiers and resource ID the target uses that the reference lacks.
+// It returns nil when the MPI knows none of the identifiers.
+func (s *MPIService) Resolve(ref model.PatientReference, targetProviderID string) (*model.MPIResolution, error) {
+	var person *model.MPIPerson
+	for _, id := range ref.Identifiers {
+		matches, err := s.repo.GetByIdentifier(id)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range matches {
+			p := p
+			if person != nil && person.PersonID != p.PersonID {
+				return nil, ErrMPIAmbiguous
+			}
+			person = &p
+		}
+	}
+	if person == nil {
+		return nil, nil
+	}
+	return resolve(*person, ref, targetProviderID), nil
+}
+
+// ResolvePerson returns the identifiers and resource ID the target uses
+// for a known person that the reference lacks.
+func (s *MPIService) ResolvePerson(personID string, ref model.PatientReference, targetProviderID string) (*model.MPIResolution, error) {
+	person, err := s.repo.GetByID(personID)
+	if err == repository.ErrMPIPersonNotFound {
+		return nil, ErrMPIPersonNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resolve(*person, ref, targetProviderID), nil
+}
+
+func resolve(person model.MPIPerson, ref model.PatientReference, targetProviderID string) *model.MPIResolution {
+	known := map[model.PatientIdentifier]bool{}
+	for _, id := range ref.Identifiers {
+		known[id] = true
+	}
+
+	resolution := &model.MPIResolution{PersonID: person.PersonID}
+	for _, ident := range person.Identifiers {
+		id := model.PatientIdentifier{System: ident.System, Value: ident.Value}
+		if !known[id] && containsString(ident.ProviderIDs, targetProviderID) {
+			resolution.AddedIdentifiers = append(resolution.AddedIdentifiers, id)
+		}
+	}
+	if ref.ID == "" {
+		for _, local := range person.LocalIDs {
+			if local.ProviderID == targetProviderID {
+				resolution.PatientID = local.PatientID
+			}
+		}
+	}
+	return resolution
+}
+
+// ResolveFor is Resolve on behalf of a requestor. The target's identifiers
+// are only disclosed when consent lets the requestor obtain the patient's
+// data from the target. Every lookup is audited.
+func (s *MPIService) ResolveFor(requestorID string, ref model.PatientReference, targetProviderID string, purpose model.PurposeOfUse) (*model.MPIResolution, error) {
+	entry := model.AuditEntry{
+		Action:             model.AuditActionMPIRead,
+		Outcome:            model.AuditOutcomeSuccess,
+		ProviderID:         requestorID,
+		PatientIdentifiers: ref.Identifiers,
+		Details:            "resolve for " + targetProviderID,
+	}
+
+	resolution, err := s.Resolve(ref, targetProviderID)
+	if err != nil {
+		entry.Outcome = model.AuditOutcomeFailure
+		entry.Details += ": " + err.Error()
+		s.auditSvc.Record(entry)
+		return nil, err
+	}
+	if resolution == nil {
+		entry.Details += ": not known"
+		s.auditSvc.Record(entry)
+		return nil, nil
+	}
+
+	identifiers := append(append([]model.PatientIdentifier{}, ref.Identifiers...), resolution.AddedIdentifiers...)
+	permitted, err := s.consentSvc.IsPermitted(identifiers, requestorID, targetProviderID, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if !permitted {
+		entry.Outcome = model.AuditOutcomeDenied
+		entry.Details += ": consent not granted"
+		s.auditSvc.Record(entry)
+		return nil, ErrConsentDenied
+	}
+
+	entry.PatientIdentifiers = identifiers
+	s.auditSvc.Record(entry)
+	return resolution, nil
+}
+
+// personView is person as providerID may see it: only the identifiers and
+// resource IDs that provider uses itself. Identifiers of other providers
+// are disclosed through ResolveFor, which checks consent.
+func personView(person model.MPIPerson, providerID string) (model.MPIPerson, bool) {
+	view := model.MPIPerson{
+		PersonID:  person.PersonID,
+		CreatedAt: person.CreatedAt,
+		UpdatedAt: person.UpdatedAt,
+	}
+	for _, ident := range person.Identifiers {
+		if containsString(ident.ProviderIDs, providerID) {
+			ident.ProviderIDs = []string{providerID}
+			view.Identifiers = append(view.Identifiers, ident)
+		}
+	}
+	for _, local := range person.LocalIDs {
+		if local.ProviderID == providerID {
+			view.LocalIDs = append(view.LocalIDs, local)
+		}
+	}
+	return view, len(view.Identifiers) > 0 || len(view.LocalIDs) > 0
+}
+
+// GetPerson returns a person as providerID sees it. Persons the provider
+// has no link to are not found.
+func (s *MPIService) GetPerson(providerID, personID string) (*model.MPIPerson, error) {
+	person, err := s.repo.GetByID(personID)
+	if err == repository.ErrMPIPersonNotFound {
+		return nil, ErrMPIPersonNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	view, ok := personView(*person, providerID)
+	if !ok {
+		return nil, ErrMPIPersonNotFound
+	}
+
+	s.auditSvc.Record(model.AuditEntry{
+		Action:             model.AuditActionMPIRead,
+		Outcome:            model.AuditOutcomeSuccess,
+		ProviderID:         providerID,
+		PatientIdentifiers: mpiIdentifiers(view.Identifiers),
+		Details:            "person " + personID,
+	})
+	return &view, nil
+}
+
+// FindPersons returns the persons holding an identifier, as providerID
+// sees them. Only identifiers the provider uses itself are searched, so a
+// search cannot reveal how other providers' identifiers are linked.
+func (s *MPIService) FindPersons(providerID string, identifier model.PatientIdentifier) ([]model.MPIPerson, error) {
+	persons, err := s.repo.GetByIdentifier(identifier)
+	if err != nil {
+		return nil, err
+	}
+	views := []model.MPIPerson{}
+	for _, person := range persons {
+		view, _ := personView(person, providerID)
+		for _, id := range mpiIdentifiers(view.Identifiers) {
+			if id == identifier {
+				views = append(views, view)
+				break
+			}
+		}
+	}
+
+	s.auditSvc.Record(model.AuditEntry{
+		Action:             model.AuditActionMPIRead,
+		Outcome:            model.AuditOutcomeSuccess,
+		ProviderID:         providerID,
+		PatientIdentifiers: []model.PatientIdentifier{identifier},
+		Details:            fmt.Sprintf("search, %d persons", len(views)),
+	})
+	return views, nil
+}
+
+func mpiIdentifiers(idents []model.MPIIdentifier) []model.PatientIdentifier {
+	ids := make([]model.PatientIdentifier, 0, len(idents))
+	for _, ident := range idents {
+		ids = append(ids, model.PatientIdentifier{System: ident.System, Value: ident.Value})
+	}
+	return ids
+}
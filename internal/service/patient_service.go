@@ -7,33 +7,82 @@ import (
 	"log"
 	"time"
 
+	"github.com/wah4pc/gateway/internal/fhirmap"
 	"github.com/wah4pc/gateway/internal/model"
 	"github.com/wah4pc/gateway/internal/repository"
+	"github.com/wah4pc/gateway/pkg/fhir"
 	"github.com/wah4pc/gateway/pkg/httpclient"
 )
 
 var (
-	ErrRequestorNotFound   = errors.New("requestor provider not found")
-	ErrTargetNotFound      = errors.New("target provider not found")
-	ErrInvalidFromProvider = errors.New("response fromProviderId does not match request targetProviderId")
+	ErrRequestorNotFound      = errors.New("requestor provider not found")
+	ErrTargetNotFound         = errors.New("target provider not found")
+	ErrRequestorInactive      = errors.New("requestor provider is not active")
+	ErrTargetInactive         = errors.New("target provider is not active")
+	ErrRequestClosed          = errors.New("request is not open for responses")
+	ErrInvalidFromProvider    = errors.New("response fromProviderId does not match request targetProviderId")
+	ErrUnsupportedFHIRVersion = errors.New("unsupported FHIR version")
+	ErrFHIRVersionMismatch    = errors.New("submitted FHIR version does not match the requested version and cannot be converted")
+	ErrInvalidPurposeOfUse    = errors.New("invalid purposeOfUse")
+	ErrInvalidFHIRResource    = errors.New("fhirPatient is not a valid FHIR resource")
+	ErrConsentDenied          = errors.New("patient consent not granted")
+	ErrOverrideNotAllowed     = errors.New("consent override requires purposeOfUse ETREAT and a justification")
+	ErrBreakGlassPurpose      = errors.New("break-glass requests must use purposeOfUse ETREAT")
+	ErrInvalidPullResponse    = errors.New("target answered the pull without a valid status and fhirPatient")
+	ErrNotRequestor           = errors.New("only the requestor may read the response")
+	ErrPullNotVerified        = errors.New("target pull endpoint has not passed verification")
 )
 
 type PatientService struct {
 	providerRepo   *repository.ProviderRepository
 	requestRepo    *repository.RequestRepository
 	responseRepo   *repository.ResponseRepository
+	consentSvc     *ConsentService
+	breakGlassSvc  *BreakGlassService
+	deidentifier   *fhir.Deidentifier
+	auditSvc       *AuditService
+	mpiSvc         *MPIService
+	matchSvc       *MatchService
+	identifierSvc  *IdentifierSystemService
+	approvalSvc    *ApprovalService
+	deliverySvc    *DeliveryService
+	policySvc      *AccessPolicyService
 	requestCounter int
 }
 
-func NewPatientService(
-	providerRepo *repository.ProviderRepository,
-	requestRepo *repository.RequestRepository,
-	responseRepo *repository.ResponseRepository,
-) *PatientService {
+// PatientServiceDeps are the repositories and services PatientService
+// works with. Dependencies a caller leaves nil must not be reached.
+type PatientServiceDeps struct {
+	ProviderRepo  *repository.ProviderRepository
+	RequestRepo   *repository.RequestRepository
+	ResponseRepo  *repository.ResponseRepository
+	ConsentSvc    *ConsentService
+	BreakGlassSvc *BreakGlassService
+	Deidentifier  *fhir.Deidentifier
+	AuditSvc      *AuditService
+	MPISvc        *MPIService
+	MatchSvc      *MatchService
+	IdentifierSvc *IdentifierSystemService
+	ApprovalSvc   *ApprovalService
+	DeliverySvc   *DeliveryService
+	PolicySvc     *AccessPolicyService
+}
+
+func NewPatientService(deps PatientServiceDeps) *PatientService {
 	return &PatientService{
-		providerRepo:   providerRepo,
-		requestRepo:    requestRepo,
-		responseRepo:   responseRepo,
+		providerRepo:   deps.ProviderRepo,
+		requestRepo:    deps.RequestRepo,
+		responseRepo:   deps.ResponseRepo,
+		consentSvc:     deps.ConsentSvc,
+		breakGlassSvc:  deps.BreakGlassSvc,
+		deidentifier:   deps.Deidentifier,
+		auditSvc:       deps.AuditSvc,
+		mpiSvc:         deps.MPISvc,
+		matchSvc:       deps.MatchSvc,
+		identifierSvc:  deps.IdentifierSvc,
+		approvalSvc:    deps.ApprovalSvc,
+		deliverySvc:    deps.DeliverySvc,
+		policySvc:      deps.PolicySvc,
 		requestCounter: 0,
 	}
 }
@@ -45,16 +94,35 @@ type CreateRequestInput struct {
 	PatientReference    model.PatientReference
 	FHIRConstraints     model.FHIRConstraints
 	Metadata            model.RequestMetadata
+	// OverrideJustification releases data without consent in emergencies.
+	OverrideJustification string
+	// BreakGlassReason requests emergency access. It bypasses consent and
+	// opens a mandatory post-hoc review.
+	BreakGlassReason string
 }
 
 func (s *PatientService) CreateRequest(input CreateRequestInput) (*model.PatientRequest, error) {
-	if !s.providerRepo.Exists(input.RequestorProviderID) {
+	requestor, err := s.providerRepo.GetByID(input.RequestorProviderID)
+	if err != nil {
 		return nil, ErrRequestorNotFound
 	}
+	if !requestor.IsActive() {
+		return nil, ErrRequestorInactive
+	}
 
-	if !s.providerRepo.Exists(input.TargetProviderID) {
+	target, err := s.providerRepo.GetByID(input.TargetProviderID)
+	if err != nil {
 		return nil, ErrTargetNotFound
 	}
+	if !target.IsActive() {
+		return nil, ErrTargetInactive
+	}
+
+	identifiers, err := s.identifierSvc.Normalize(input.PatientReference.Identifiers)
+	if err != nil {
+		return nil, err
+	}
+	input.PatientReference.Identifiers = identifiers
 
 	now := time.Now().UTC()
 	s.requestCounter++
@@ -64,7 +132,28 @@ func (s *PatientService) CreateRequest(input CreateRequestInput) (*model.Patient
 		input.FHIRConstraints.ResourceType = "Patient"
 	}
 	if input.FHIRConstraints.Version == "" {
-		input.FHIRConstraints.Version = "4.0.1"
+		input.FHIRConstraints.Version = fhir.VersionR4
+	}
+	version, ok := fhir.NormalizeVersion(input.FHIRConstraints.Version)
+	if !ok {
+		return nil, ErrUnsupportedFHIRVersion
+	}
+	input.FHIRConstraints.Version = version
+	if input.BreakGlassReason != "" && input.FHIRConstraints.PurposeOfUse == "" {
+		input.FHIRConstraints.PurposeOfUse = model.PurposeOfUseEmergencyTreatment
+	}
+	if input.FHIRConstraints.PurposeOfUse == "" {
+		input.FHIRConstraints.PurposeOfUse = model.PurposeOfUseTreatment
+	}
+	if !input.FHIRConstraints.PurposeOfUse.IsValid() {
+		return nil, ErrInvalidPurposeOfUse
+	}
+
+	if input.OverrideJustification != "" && input.FHIRConstraints.PurposeOfUse != model.PurposeOfUseEmergencyTreatment {
+		return nil, ErrOverrideNotAllowed
+	}
+	if input.BreakGlassReason != "" && input.FHIRConstraints.PurposeOfUse != model.PurposeOfUseEmergencyTreatment {
+		return nil, ErrBreakGlassPurpose
 	}
 
 	request := model.PatientRequest{
@@ -80,16 +169,196 @@ func (s *PatientService) CreateRequest(input CreateRequestInput) (*model.Patient
 		UpdatedAt:           now.Format(time.RFC3339),
 	}
 
+	// Translate the submitted identifiers, or the person behind a match
+	// token, into those the target uses.
+	var resolution *model.MPIResolution
+	if token := request.PatientReference.MatchToken; token != "" {
+		request.PatientReference.MatchToken = ""
+		var personID string
+		if personID, err = s.matchSvc.RedeemToken(token, request.RequestorProviderID, request.TargetProviderID); err != nil {
+			return nil, err
+		}
+		resolution, err = s.mpiSvc.ResolvePerson(personID, request.PatientReference, request.TargetProviderID)
+		if err == ErrMPIPersonNotFound {
+			// The person was merged into another since the match.
+			return nil, ErrInvalidMatchToken
+		}
+	} else {
+		resolution, err = s.mpiSvc.Resolve(request.PatientReference, request.TargetProviderID)
+	}
+	switch {
+	case err == ErrMPIAmbiguous:
+		log.Printf("mpi: request %s: %v, identifiers not resolved", requestID, err)
+	case err != nil:
+		return nil, err
+	case resolution != nil:
+		request.MPI = resolution
+	}
+
+	if err := s.checkCapabilities(&request, target); err != nil {
+		return nil, err
+	}
+
+	// Targets may restrict who can request what from them.
+	decision, err := s.policySvc.Evaluate(requestor, request.TargetProviderID, request.FHIRConstraints.ResourceType, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if decision != nil {
+		if decision.Decision == model.PolicyEffectDeny {
+			s.auditSvc.Record(model.AuditEntry{
+				Action:             model.AuditActionRequestCreate,
+				Outcome:            model.AuditOutcomeDenied,
+				ProviderID:         request.RequestorProviderID,
+				PatientIdentifiers: request.PatientReference.Identifiers,
+				Details:            "target " + request.TargetProviderID + ", policy decision " + decision.DecisionID + ": " + decision.Reason,
+			})
+			return nil, fmt.Errorf("%w (decision %s)", ErrPolicyDenied, decision.DecisionID)
+		}
+		request.PolicyDecisionID = decision.DecisionID
+	}
+
+	if input.BreakGlassReason != "" {
+		review, err := s.breakGlassSvc.OpenReview(&request, input.BreakGlassReason)
+		if err != nil {
+			return nil, err
+		}
+		request.BreakGlass = &model.BreakGlass{
+			Reason:    input.BreakGlassReason,
+			InvokedAt: review.InvokedAt,
+			ReviewID:  review.ReviewID,
+		}
+	} else if input.OverrideJustification != "" {
+		request.ConsentOverride = &model.ConsentOverride{
+			Justification: input.OverrideJustification,
+			OverriddenAt:  request.CreatedAt,
+		}
+		log.Printf("consent: request %s overrides consent: %s", requestID, input.OverrideJustification)
+	} else {
+		permitted, err := s.consentSvc.IsPermitted(request.ForTarget().PatientReference.Identifiers, request.RequestorProviderID, request.TargetProviderID, request.FHIRConstraints.PurposeOfUse)
+		if err != nil {
+			return nil, err
+		}
+		if !permitted {
+			request.Status = model.RequestStatusConsentDenied
+		}
+	}
+
+	// Targets may hold incoming requests for manual review. Break-glass
+	// access cannot wait for it.
+	if request.Status == model.RequestStatusPending && request.BreakGlass == nil {
+		if target.Approval != nil && len(target.Approval.Reviewers) > 0 {
+			approval, err := s.approvalSvc.Open(&request, target.Approval.Reviewers)
+			if err != nil {
+				return nil, err
+			}
+			request.ApprovalID = approval.ApprovalID
+			request.Status = model.RequestStatusAwaitingApproval
+		}
+	}
+
 	if err := s.requestRepo.Create(request); err != nil {
 		return nil, err
 	}
 
-	// Push request to target provider
-	go s.pushToTarget(&request)
+	entry := model.AuditEntry{
+		Action:             model.AuditActionRequestCreate,
+		Outcome:            model.AuditOutcomeSuccess,
+		ProviderID:         request.RequestorProviderID,
+		RequestIDs:         []string{request.RequestID},
+		PatientIdentifiers: request.PatientReference.Identifiers,
+		Details:            "target " + request.TargetProviderID + ", purposeOfUse " + string(request.FHIRConstraints.PurposeOfUse),
+	}
+	switch {
+	case request.Status == model.RequestStatusConsentDenied:
+		entry.Outcome = model.AuditOutcomeDenied
+		entry.Details += ", consent denied"
+	case request.BreakGlass != nil:
+		entry.Details += ", break-glass: " + request.BreakGlass.Reason
+	case request.ConsentOverride != nil:
+		entry.Details += ", consent override: " + request.ConsentOverride.Justification
+	}
+	if request.PolicyDecisionID != "" {
+		entry.Details += ", policy decision " + request.PolicyDecisionID
+	}
+	if request.ApprovalID != "" {
+		entry.Details += ", awaiting approval " + request.ApprovalID
+	}
+	s.auditSvc.Record(entry)
+
+	// Denied requests are kept for the record but never reach the target.
+	if request.Status == model.RequestStatusConsentDenied {
+		return &request, ErrConsentDenied
+	}
+
+	// Send request to target provider once its reviewers approve
+	if request.Status == model.RequestStatusPending {
+		s.sendToTarget(&request, target)
+	}
 
 	return &request, nil
 }
 
+// DecideApproval records a reviewer's decision on a held request. Approved
+// requests are pushed to the target; denied ones fail with the reviewer's
+// reason.
+func (s *PatientService) DecideApproval(approvalID string, input ApprovalDecisionInput) (*model.Approval, error) {
+	approval, err := s.approvalSvc.Decide(approvalID, input)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := s.requestRepo.GetByID(approval.RequestID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	request.UpdatedAt = now
+
+	if approval.Status == model.ApprovalStatusApproved {
+		request.Status = model.RequestStatusPending
+		if err := s.requestRepo.Update(*request); err != nil {
+			return nil, err
+		}
+		go s.notifyStatusChange(*request)
+		if target, err := s.providerRepo.GetByID(request.TargetProviderID); err == nil {
+			s.sendToTarget(request, target)
+		}
+		return approval, nil
+	}
+
+	response := model.PatientResponse{
+		RequestID:      request.RequestID,
+		FromProviderID: request.TargetProviderID,
+		Status:         model.RequestStatusFailed,
+		Error:          "denied by " + approval.DecidedBy + ": " + approval.Reason,
+		ReceivedAt:     now,
+	}
+	if err := s.responseRepo.Create(response); err != nil {
+		return nil, err
+	}
+
+	request.Status = model.RequestStatusFailed
+	if err := s.requestRepo.Update(*request); err != nil {
+		return nil, err
+	}
+
+	s.auditSvc.Record(model.AuditEntry{
+		Action:             model.AuditActionResponseSubmit,
+		Outcome:            model.AuditOutcomeDenied,
+		ProviderID:         request.TargetProviderID,
+		RequestIDs:         []string{request.RequestID},
+		PatientIdentifiers: request.PatientReference.Identifiers,
+		Details:            "status FAILED, approval " + approval.ApprovalID + " denied by " + approval.DecidedBy,
+	})
+
+	go s.notifyStatusChange(*request)
+	go s.pushToRequestor(request, &response)
+
+	return approval, nil
+}
+
 // RequestCallbackPayload is the payload sent to target provider when a new request is created
 type RequestCallbackPayload struct {
 	RequestID           string                 `json:"requestId"`
@@ -99,21 +368,16 @@ type RequestCallbackPayload struct {
 	FHIRConstraints     model.FHIRConstraints  `json:"fhirConstraints"`
 	Metadata            model.RequestMetadata  `json:"metadata,omitempty"`
 	CreatedAt           string                 `json:"createdAt"`
+	BreakGlass          *model.BreakGlass      `json:"breakGlass,omitempty"`
+	Task                *fhir.Task             `json:"task,omitempty"`
 }
 
-func (s *PatientService) pushToTarget(request *model.PatientRequest) {
-	target, err := s.providerRepo.GetByID(request.TargetProviderID)
-	if err != nil {
-		log.Printf("push to target: failed to get target provider %s: %v", request.TargetProviderID, err)
-		return
-	}
-
-	if target.Callback.PatientRequest == "" {
-		log.Printf("push to target: target %s has no patientRequest callback URL configured", request.TargetProviderID)
-		return
-	}
-
-	payload := RequestCallbackPayload{
+// requestPayload is the request as sent to its target, with the identifiers
+// resolved by the MPI.
+func requestPayload(request *model.PatientRequest) RequestCallbackPayload {
+	target := request.ForTarget()
+	request = &target
+	return RequestCallbackPayload{
 		RequestID:           request.RequestID,
 		RequestorProviderID: request.RequestorProviderID,
 		TargetProviderID:    request.TargetProviderID,
@@ -121,22 +385,111 @@ func (s *PatientService) pushToTarget(request *model.PatientRequest) {
 		FHIRConstraints:     request.FHIRConstraints,
 		Metadata:            request.Metadata,
 		CreatedAt:           request.CreatedAt,
+		BreakGlass:          request.BreakGlass,
+		Task:                fhirmap.TaskFromRequest(request, nil),
 	}
+}
 
-	if err := httpclient.PostJSON(target.Callback.PatientRequest, payload); err != nil {
-		log.Printf("push to target: failed to POST to %s: %v", target.Callback.PatientRequest, err)
+// sendToTarget pulls the Patient from targets in pull mode and completes
+// the request with it. Other targets, and pull targets that could not be
+// reached, get the request pushed to their callback. Both run in the
+// background, so the caller sees the request still PENDING.
+func (s *PatientService) sendToTarget(request *model.PatientRequest, target *model.Provider) {
+	pending := *request
+	if !target.Endpoints.Pull {
+		go s.pushToTarget(&pending)
 		return
 	}
+	go func() {
+		err := s.pullFromTarget(&pending, target)
+		if err == nil {
+			return
+		}
+		log.Printf("pull from target: request %s from %s failed, falling back to push: %v", pending.RequestID, target.ProviderID, err)
+		s.pushToTarget(&pending)
+	}()
+}
+
+// PullResponse is what a pull-mode target answers on its patientRequest
+// endpoint. It carries the same fields as POST /v1/fhir/patient/respond.
+type PullResponse struct {
+	Status      model.RequestStatus `json:"status,omitempty"`
+	FHIRVersion string              `json:"fhirVersion,omitempty"`
+	FHIRPatient json.RawMessage     `json:"fhirPatient,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// pullFromTarget POSTs the request to the target's patientRequest endpoint
+// and records the answer as the target's response. On success request is
+// updated to its final state. Patient identifiers are only sent to an
+// endpoint that passed its ownership challenge.
+func (s *PatientService) pullFromTarget(request *model.PatientRequest, target *model.Provider) error {
+	url := target.Endpoints.PatientRequestURL(target.BaseURL)
+	if !target.CallbackVerified(url) {
+		return ErrPullNotVerified
+	}
+	if !s.deliverySvc.Allow(url) {
+		return ErrCircuitOpen
+	}
+
+	var answer PullResponse
+	start := time.Now()
+	err := httpclient.PostJSONDecode(url, requestPayload(request), &answer)
+	s.deliverySvc.Record(url, time.Since(start), err)
+	if err != nil {
+		return err
+	}
+
+	if answer.Status == "" {
+		answer.Status = model.RequestStatusCompleted
+	}
+	switch {
+	case answer.Status != model.RequestStatusCompleted && answer.Status != model.RequestStatusFailed:
+		return ErrInvalidPullResponse
+	case answer.Status == model.RequestStatusCompleted && len(answer.FHIRPatient) == 0:
+		return ErrInvalidPullResponse
+	}
+
+	if _, err := s.ReceiveResponse(ReceiveResponseInput{
+		RequestID:      request.RequestID,
+		FromProviderID: target.ProviderID,
+		FHIRPatient:    answer.FHIRPatient,
+		FHIRVersion:    answer.FHIRVersion,
+		Status:         answer.Status,
+		Error:          answer.Error,
+	}); err != nil {
+		return err
+	}
+
+	updated, err := s.requestRepo.GetByID(request.RequestID)
+	if err != nil {
+		return err
+	}
+	*request = *updated
+	log.Printf("pull from target: request %s answered %s by %s", request.RequestID, request.Status, target.ProviderID)
+	return nil
+}
 
-	log.Printf("push to target: successfully sent request %s to %s", request.RequestID, target.Callback.PatientRequest)
+// pushToTarget sends request.created to the target's subscriptions. It
+// returns an error only when a delivery itself failed or was queued.
+func (s *PatientService) pushToTarget(request *model.PatientRequest) error {
+	target, err := s.providerRepo.GetByID(request.TargetProviderID)
+	if err != nil {
+		log.Printf("push to target: failed to get target provider %s: %v", request.TargetProviderID, err)
+		return nil
+	}
+	return s.notify(target, model.WebhookEventRequestCreated, request, nil)
 }
 
 type ReceiveResponseInput struct {
 	RequestID      string
 	FromProviderID string
 	FHIRPatient    json.RawMessage
-	Status         model.RequestStatus
-	Error          string
+	// FHIRVersion is the version the target declared for FHIRPatient.
+	// Empty means the version that was requested.
+	FHIRVersion string
+	Status      model.RequestStatus
+	Error       string
 }
 
 func (s *PatientService) ReceiveResponse(input ReceiveResponseInput) (*model.PatientResponse, error) {
@@ -149,71 +502,236 @@ func (s *PatientService) ReceiveResponse(input ReceiveResponseInput) (*model.Pat
 		return nil, ErrInvalidFromProvider
 	}
 
+	target, err := s.providerRepo.GetByID(request.TargetProviderID)
+	if err != nil {
+		return nil, err
+	}
+	if !target.IsActive() {
+		return nil, ErrTargetInactive
+	}
+
+	// Only a pending request takes a response. A request awaiting approval
+	// has not been released to the target yet, and a finished one must not
+	// be overwritten or reopened by a late or repeated response.
+	if request.Status != model.RequestStatusPending {
+		return nil, ErrRequestClosed
+	}
+
+	fhirPatient, version, sourceVersion, err := negotiateVersion(request, input)
+	if err != nil {
+		return nil, err
+	}
+
+	status, responseError := input.Status, input.Error
+	if status == model.RequestStatusCompleted && !consentBypassed(request) {
+		// Consent may have been revoked since the request was created, and the
+		// returned resource may carry identifiers the requestor did not know.
+		identifiers := request.ForTarget().PatientReference.Identifiers
+		for _, id := range fhir.ResourceIdentifiers(fhirPatient) {
+			identifiers = append(identifiers, model.PatientIdentifier{System: id.System, Value: id.Value})
+		}
+		permitted, err := s.consentSvc.IsPermitted(identifiers, request.RequestorProviderID, request.TargetProviderID, request.FHIRConstraints.PurposeOfUse)
+		if err != nil {
+			return nil, err
+		}
+		if !permitted {
+			fhirPatient = nil
+			status, responseError = model.RequestStatusConsentDenied, ErrConsentDenied.Error()
+		}
+	}
+
+	// The MPI learns from the full resource, before minimization and
+	// de-identification remove identifiers.
+	if status == model.RequestStatusCompleted {
+		s.mpiSvc.Learn(request, fhirPatient)
+	}
+
+	// Data minimization: only the requested elements are ever stored.
+	fhirPatient, err = fhir.FilterElements(fhirPatient, request.FHIRConstraints.Elements)
+	if err != nil {
+		return nil, ErrInvalidFHIRResource
+	}
+	// Requestors may read the resource as XML, so it must convert cleanly.
+	if len(fhirPatient) > 0 {
+		if _, err := fhir.JSONToXML(fhirPatient); err != nil {
+			return nil, ErrInvalidFHIRResource
+		}
+	}
+
+	// Research consumers must never see direct identifiers.
+	deidentified := false
+	if request.FHIRConstraints.PurposeOfUse == model.PurposeOfUseResearch && len(fhirPatient) > 0 {
+		fhirPatient, err = s.deidentifier.Deidentify(fhirPatient)
+		if err != nil {
+			return nil, ErrInvalidFHIRResource
+		}
+		deidentified = true
+	}
+
 	now := time.Now().UTC()
 
 	response := model.PatientResponse{
-		RequestID:      input.RequestID,
-		FromProviderID: input.FromProviderID,
-		FHIRPatient:    input.FHIRPatient,
-		Status:         input.Status,
-		Error:          input.Error,
-		ReceivedAt:     now.Format(time.RFC3339),
+		RequestID:         input.RequestID,
+		FromProviderID:    input.FromProviderID,
+		FHIRPatient:       fhirPatient,
+		FHIRVersion:       version,
+		SourceFHIRVersion: sourceVersion,
+		Deidentified:      deidentified,
+		Status:            status,
+		Error:             responseError,
+		ReceivedAt:        now.Format(time.RFC3339),
 	}
 
 	if err := s.responseRepo.Create(response); err != nil {
 		return nil, err
 	}
 
-	request.Status = input.Status
+	request.Status = status
 	request.UpdatedAt = now.Format(time.RFC3339)
 	if err := s.requestRepo.Update(*request); err != nil {
 		return nil, err
 	}
 
-	// Push callback to requestor if status is COMPLETED
-	if input.Status == model.RequestStatusCompleted {
-		s.pushToRequestor(request.RequestorProviderID, &response)
+	entry := model.AuditEntry{
+		Action:             model.AuditActionResponseSubmit,
+		Outcome:            model.AuditOutcomeSuccess,
+		ProviderID:         input.FromProviderID,
+		RequestIDs:         []string{request.RequestID},
+		PatientIdentifiers: request.PatientReference.Identifiers,
+		Details:            "status " + string(status),
+	}
+	if status == model.RequestStatusConsentDenied {
+		entry.Outcome = model.AuditOutcomeDenied
 	}
+	s.auditSvc.Record(entry)
+
+	go s.notifyStatusChange(*request)
+	s.pushToRequestor(request, &response)
 
 	return &response, nil
 }
 
+// CloseRequestsForProvider ends the open requests of a provider that left
+// the network. Requests it was to answer fail, so requestors learn they
+// will not be fulfilled; requests it sent are cancelled. It returns the
+// number of requests closed.
+func (s *PatientService) CloseRequestsForProvider(providerID, reason string) (int, error) {
+	requests, err := s.requestRepo.GetAll()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	closed := 0
+	for i := range requests {
+		request := &requests[i]
+		if request.Status != model.RequestStatusPending && request.Status != model.RequestStatusAwaitingApproval {
+			continue
+		}
+
+		var response *model.PatientResponse
+		switch providerID {
+		case request.TargetProviderID:
+			response = &model.PatientResponse{
+				RequestID:      request.RequestID,
+				FromProviderID: request.TargetProviderID,
+				Status:         model.RequestStatusFailed,
+				Error:          reason,
+				ReceivedAt:     now,
+			}
+			if err := s.responseRepo.Create(*response); err != nil {
+				return closed, err
+			}
+			request.Status = model.RequestStatusFailed
+		case request.RequestorProviderID:
+			request.Status = model.RequestStatusCancelled
+		default:
+			continue
+		}
+
+		if request.ApprovalID != "" {
+			if err := s.approvalSvc.Withdraw(request.ApprovalID, reason); err != nil {
+				return closed, err
+			}
+		}
+		request.UpdatedAt = now
+		if err := s.requestRepo.Update(*request); err != nil {
+			return closed, err
+		}
+		closed++
+
+		// The closed provider is no longer active and is not notified.
+		go s.notifyStatusChange(*request)
+		if response != nil {
+			go s.pushToRequestor(request, response)
+		} else {
+			go s.notifyCancelled(*request)
+		}
+	}
+
+	if closed > 0 {
+		log.Printf("provider %s: closed %d open requests: %s", providerID, closed, reason)
+	}
+	return closed, nil
+}
+
+// consentBypassed reports whether a request skips consent gating.
+func consentBypassed(request *model.PatientRequest) bool {
+	return request.BreakGlass != nil || request.ConsentOverride != nil
+}
+
+// negotiateVersion checks the version a target declared for its resource
+// against the requested one and converts the resource when they differ.
+// It returns the resource, its final version and, if converted, the source version.
+func negotiateVersion(request *model.PatientRequest, input ReceiveResponseInput) (json.RawMessage, string, string, error) {
+	requested, ok := fhir.NormalizeVersion(request.FHIRConstraints.Version)
+	if !ok {
+		requested = fhir.VersionR4
+	}
+	if input.FHIRVersion == "" {
+		return input.FHIRPatient, requested, "", nil
+	}
+
+	declared, ok := fhir.NormalizeVersion(input.FHIRVersion)
+	if !ok {
+		return nil, "", "", ErrUnsupportedFHIRVersion
+	}
+	if declared == requested || len(input.FHIRPatient) == 0 {
+		return input.FHIRPatient, requested, "", nil
+	}
+
+	converted, err := fhir.ConvertResource(input.FHIRPatient, declared, requested)
+	if err != nil {
+		log.Printf("version negotiation: request %s: %v", request.RequestID, err)
+		return nil, "", "", ErrFHIRVersionMismatch
+	}
+	return converted, requested, declared, nil
+}
+
 type CallbackPayload struct {
 	RequestID      string              `json:"requestId"`
 	FromProviderID string              `json:"fromProviderId"`
 	ToProviderID   string              `json:"toProviderId"`
 	Status         model.RequestStatus `json:"status"`
+	FHIRFormat     model.FHIRFormat    `json:"fhirFormat,omitempty"`
+	FHIRVersion    string              `json:"fhirVersion,omitempty"`
+	Deidentified   bool                `json:"deidentified,omitempty"`
 	FHIRPatient    json.RawMessage     `json:"fhirPatient,omitempty"`
 	Error          string              `json:"error,omitempty"`
+	BreakGlass     *model.BreakGlass   `json:"breakGlass,omitempty"`
+	Task           *fhir.Task          `json:"task,omitempty"`
 }
 
-func (s *PatientService) pushToRequestor(requestorProviderID string, response *model.PatientResponse) {
-	requestor, err := s.providerRepo.GetByID(requestorProviderID)
+// pushToRequestor sends the outcome of a request, request.completed or
+// request.failed, to the requestor's subscriptions. It returns an error
+// only when a delivery itself failed or was queued.
+func (s *PatientService) pushToRequestor(request *model.PatientRequest, response *model.PatientResponse) error {
+	requestor, err := s.providerRepo.GetByID(request.RequestorProviderID)
 	if err != nil {
-		log.Printf("push callback: failed to get requestor provider %s: %v", requestorProviderID, err)
-		return
-	}
-
-	if requestor.Callback.PatientResponse == "" {
-		log.Printf("push callback: requestor %s has no callback URL configured", requestorProviderID)
-		return
-	}
-
-	payload := CallbackPayload{
-		RequestID:      response.RequestID,
-		FromProviderID: response.FromProviderID,
-		ToProviderID:   requestorProviderID,
-		Status:         response.Status,
-		FHIRPatient:    response.FHIRPatient,
-		Error:          response.Error,
+		log.Printf("push callback: failed to get requestor provider %s: %v", request.RequestorProviderID, err)
+		return nil
 	}
-
-	if err := httpclient.PostJSON(requestor.Callback.PatientResponse, payload); err != nil {
-		log.Printf("push callback: failed to POST to %s: %v", requestor.Callback.PatientResponse, err)
-		return
-	}
-
-	log.Printf("push callback: successfully sent to %s for request %s", requestor.Callback.PatientResponse, response.RequestID)
+	return s.notify(requestor, responseEvent(response), request, response)
 }
 
 type GetResponseResult struct {
@@ -221,22 +739,41 @@ type GetResponseResult struct {
 	RequestorProviderID string              `json:"requestorProviderId"`
 	TargetProviderID    string              `json:"targetProviderId"`
 	Status              model.RequestStatus `json:"status"`
+	FHIRFormat          model.FHIRFormat    `json:"fhirFormat,omitempty"`
+	FHIRVersion         string              `json:"fhirVersion,omitempty"`
+	Deidentified        bool                `json:"deidentified,omitempty"`
 	FHIRPatient         json.RawMessage     `json:"fhirPatient,omitempty"`
 	Error               string              `json:"error,omitempty"`
+	BreakGlass          *model.BreakGlass   `json:"breakGlass,omitempty"`
 	CompletedAt         string              `json:"completedAt,omitempty"`
+	PurgedAt            string              `json:"purgedAt,omitempty"`
 }
 
-func (s *PatientService) GetResponse(requestID string) (*GetResponseResult, error) {
+// GetResponse returns the current state of a request to its requestor,
+// readerID. The FHIR Patient is rendered in format, or in the requestor's
+// preferred format when empty. Reads by other providers are refused and
+// audited.
+func (s *PatientService) GetResponse(requestID, readerID string, format model.FHIRFormat) (*GetResponseResult, error) {
 	request, err := s.requestRepo.GetByID(requestID)
 	if err != nil {
 		return nil, err
 	}
+	if readerID != request.RequestorProviderID {
+		s.auditSvc.Record(model.AuditEntry{
+			Action:     model.AuditActionResponseRead,
+			Outcome:    model.AuditOutcomeDenied,
+			ProviderID: readerID,
+			RequestIDs: []string{request.RequestID},
+		})
+		return nil, ErrNotRequestor
+	}
 
 	result := &GetResponseResult{
 		RequestID:           request.RequestID,
 		RequestorProviderID: request.RequestorProviderID,
 		TargetProviderID:    request.TargetProviderID,
 		Status:              request.Status,
+		BreakGlass:          request.BreakGlass,
 	}
 
 	if request.Status == model.RequestStatusPending {
@@ -248,18 +785,131 @@ func (s *PatientService) GetResponse(requestID string) (*GetResponseResult, erro
 		return result, nil
 	}
 
-	result.FHIRPatient = response.FHIRPatient
+	if format == "" {
+		if requestor, err := s.providerRepo.GetByID(request.RequestorProviderID); err == nil {
+			format = requestor.FHIRFormat
+		}
+	}
+	fhirPatient, err := renderFHIRPatient(response.FHIRPatient, format)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditSvc.Record(model.AuditEntry{
+		Action:             model.AuditActionResponseRead,
+		Outcome:            model.AuditOutcomeSuccess,
+		ProviderID:         readerID,
+		RequestIDs:         []string{request.RequestID},
+		PatientIdentifiers: request.PatientReference.Identifiers,
+	})
+
+	s.markDelivered(response)
+
+	result.FHIRFormat = formatOrDefault(format)
+	result.FHIRVersion = response.FHIRVersion
+	result.Deidentified = response.Deidentified
+	result.FHIRPatient = fhirPatient
 	result.Error = response.Error
 	result.CompletedAt = response.ReceivedAt
+	result.PurgedAt = response.PurgedAt
 
 	return result, nil
 }
 
+// markDelivered records the first delivery of a response to its requestor,
+// which starts the payload retention period.
+func (s *PatientService) markDelivered(response *model.PatientResponse) {
+	if response.DeliveredAt != "" {
+		return
+	}
+	response.DeliveredAt = time.Now().UTC().Format(time.RFC3339)
+	if err := s.responseRepo.Update(*response); err != nil {
+		log.Printf("retention: failed to record delivery of %s: %v", response.RequestID, err)
+	}
+}
+
+// GetRequest returns a single patient request by ID together with its
+// response, which is nil while the request is pending.
+func (s *PatientService) GetRequest(requestID string) (*model.PatientRequest, *model.PatientResponse, error) {
+	request, err := s.requestRepo.GetByID(requestID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	response, err := s.responseRepo.GetByRequestID(requestID)
+	if err != nil {
+		if err == repository.ErrResponseNotFound {
+			return request, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	return request, response, nil
+}
+
+// RequestFilter narrows SearchRequests. Empty fields match everything.
+type RequestFilter struct {
+	RequestID           string
+	RequestorProviderID string
+	TargetProviderID    string
+	CorrelationKey      string
+	Status              model.RequestStatus
+	// ProviderID matches requests it sent or is the target of.
+	ProviderID string
+}
+
+// RequestRecord is a request paired with its response, if any.
+type RequestRecord struct {
+	Request  model.PatientRequest
+	Response *model.PatientResponse
+}
+
+// SearchRequests returns all requests matching filter with their responses.
+func (s *PatientService) SearchRequests(filter RequestFilter) ([]RequestRecord, error) {
+	requests, err := s.requestRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	responses, err := s.responseRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	byRequestID := make(map[string]model.PatientResponse, len(responses))
+	for _, resp := range responses {
+		byRequestID[resp.RequestID] = resp
+	}
+
+	records := []RequestRecord{}
+	for _, req := range requests {
+		if (filter.RequestID != "" && req.RequestID != filter.RequestID) ||
+			(filter.RequestorProviderID != "" && req.RequestorProviderID != filter.RequestorProviderID) ||
+			(filter.TargetProviderID != "" && req.TargetProviderID != filter.TargetProviderID) ||
+			(filter.CorrelationKey != "" && req.CorrelationKey != filter.CorrelationKey) ||
+			(filter.Status != "" && req.Status != filter.Status) ||
+			(filter.ProviderID != "" && req.RequestorProviderID != filter.ProviderID && req.TargetProviderID != filter.ProviderID) {
+			continue
+		}
+
+		record := RequestRecord{Request: req}
+		if resp, ok := byRequestID[req.RequestID]; ok {
+			record.Response = &resp
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
 // GetPendingRequestsForTarget returns all pending requests for a target provider (polling endpoint)
 func (s *PatientService) GetPendingRequestsForTarget(targetProviderID string) ([]model.PatientRequest, error) {
-	if !s.providerRepo.Exists(targetProviderID) {
+	target, err := s.providerRepo.GetByID(targetProviderID)
+	if err != nil {
 		return nil, ErrTargetNotFound
 	}
+	if !target.IsActive() {
+		return nil, ErrTargetInactive
+	}
 
 	requests, err := s.requestRepo.GetByTargetProvider(targetProviderID, model.RequestStatusPending)
 	if err != nil {
@@ -269,6 +919,45 @@ func (s *PatientService) GetPendingRequestsForTarget(targetProviderID string) ([
 	if requests == nil {
 		requests = []model.PatientRequest{}
 	}
+	for i := range requests {
+		requests[i] = requests[i].ForTarget()
+	}
+
+	// Polling hands patient identifiers to the target, so it is audited
+	// whenever something was returned.
+	if len(requests) > 0 {
+		entry := model.AuditEntry{
+			Action:     model.AuditActionRequestPoll,
+			Outcome:    model.AuditOutcomeSuccess,
+			ProviderID: targetProviderID,
+		}
+		for _, r := range requests {
+			entry.RequestIDs = append(entry.RequestIDs, r.RequestID)
+			entry.PatientIdentifiers = append(entry.PatientIdentifiers, r.PatientReference.Identifiers...)
+		}
+		s.auditSvc.Record(entry)
+	}
 
 	return requests, nil
 }
+
+// renderFHIRPatient converts a stored (JSON) FHIR resource to the given wire
+// format. XML is carried as a JSON string so envelopes stay JSON.
+func renderFHIRPatient(resource json.RawMessage, format model.FHIRFormat) (json.RawMessage, error) {
+	if len(resource) == 0 || format != model.FHIRFormatXML {
+		return resource, nil
+	}
+
+	data, err := fhir.JSONToXML(resource)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(data))
+}
+
+func formatOrDefault(format model.FHIRFormat) model.FHIRFormat {
+	if format == "" {
+		return model.FHIRFormatJSON
+	}
+	return format
+}
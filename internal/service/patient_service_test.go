@@ -0,0 +1,152 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+func TestReceiveResponseClosedRequest(t *testing.T) {
+	statuses := []model.RequestStatus{
+		model.RequestStatusAwaitingApproval,
+		model.RequestStatusCompleted,
+		model.RequestStatusFailed,
+		model.RequestStatusConsentDenied,
+		model.RequestStatusCancelled,
+	}
+	for _, status := range statuses {
+		t.Run(string(status), func(t *testing.T) {
+			store, err := repository.NewJSONStore(t.TempDir(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			providerRepo := repository.NewProviderRepository(store)
+			requestRepo := repository.NewRequestRepository(store)
+			responseRepo := repository.NewResponseRepository(store)
+			for _, id := range []string{"clinic-a", "hospital-b"} {
+				if err := providerRepo.Create(model.Provider{ProviderID: id, Status: model.ProviderStatusActive}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			request := model.PatientRequest{
+				RequestID:           "REQ-1",
+				RequestorProviderID: "clinic-a",
+				TargetProviderID:    "hospital-b",
+				Status:              status,
+				FHIRConstraints:     model.FHIRConstraints{ResourceType: "Patient", Version: "R4"},
+			}
+			if err := requestRepo.Create(request); err != nil {
+				t.Fatal(err)
+			}
+			svc := NewPatientService(PatientServiceDeps{ProviderRepo: providerRepo, RequestRepo: requestRepo, ResponseRepo: responseRepo})
+
+			_, err = svc.ReceiveResponse(ReceiveResponseInput{
+				RequestID:      "REQ-1",
+				FromProviderID: "hospital-b",
+				FHIRPatient:    json.RawMessage(`{"resourceType":"Patient","id":"b-7"}`),
+				Status:         model.RequestStatusCompleted,
+			})
+			if err != ErrRequestClosed {
+				t.Fatalf("ReceiveResponse error = %v, want ErrRequestClosed", err)
+			}
+
+			got, err := requestRepo.GetByID("REQ-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != status {
+				t.Errorf("status = %s, want %s", got.Status, status)
+			}
+			if _, err := responseRepo.GetByRequestID("REQ-1"); err == nil {
+				t.Error("a response was stored for a closed request")
+			}
+		})
+	}
+}
+
+func TestGetResponseOnlyForRequestor(t *testing.T) {
+	store, err := repository.NewJSONStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requestRepo := repository.NewRequestRepository(store)
+	auditRepo := repository.NewAuditRepository(store)
+	auditSvc, err := NewAuditService(auditRepo, testAuditKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := requestRepo.Create(model.PatientRequest{
+		RequestID:           "REQ-1",
+		RequestorProviderID: "clinic-a",
+		TargetProviderID:    "hospital-b",
+		Status:              model.RequestStatusPending,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewPatientService(PatientServiceDeps{
+		ProviderRepo: repository.NewProviderRepository(store),
+		RequestRepo:  requestRepo,
+		ResponseRepo: repository.NewResponseRepository(store),
+		AuditSvc:     auditSvc,
+	})
+
+	for _, readerID := range []string{"hospital-b", "lab-c"} {
+		if _, err := svc.GetResponse("REQ-1", readerID, ""); err != ErrNotRequestor {
+			t.Errorf("GetResponse by %s error = %v, want ErrNotRequestor", readerID, err)
+		}
+	}
+	if _, err := svc.GetResponse("REQ-1", "clinic-a", ""); err != nil {
+		t.Errorf("GetResponse by the requestor error = %v", err)
+	}
+
+	denied, err := auditSvc.ListEntries(AuditFilter{Action: model.AuditActionResponseRead, ProviderID: "lab-c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(denied) != 1 || denied[0].Outcome != model.AuditOutcomeDenied {
+		t.Errorf("audit entries for lab-c = %+v, want one DENIED read", denied)
+	}
+}
+
+func TestPullFromTargetRequiresVerifiedEndpoint(t *testing.T) {
+	allowLoopback(t)
+	pulls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pulls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"FAILED","error":"patient not found"}`))
+	}))
+	defer srv.Close()
+
+	store, err := repository.NewJSONStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewPatientService(PatientServiceDeps{
+		DeliverySvc: NewDeliveryService(repository.NewDeliveryRepository(store), CircuitPolicy{FailureThreshold: 5, OpenDuration: time.Minute}),
+	})
+	target := &model.Provider{
+		ProviderID: "hospital-b",
+		BaseURL:    srv.URL,
+		Endpoints:  model.ProviderEndpoints{PatientRequest: "/pull", Pull: true},
+	}
+	request := &model.PatientRequest{RequestID: "REQ-1", RequestorProviderID: "clinic-a", TargetProviderID: "hospital-b"}
+
+	for _, status := range []model.CallbackVerificationStatus{"", model.CallbackVerificationPending, model.CallbackVerificationFailed} {
+		target.CallbackVerification = nil
+		if status != "" {
+			target.CallbackVerification = []model.CallbackVerification{{Callback: model.CallbackPull, URL: srv.URL + "/pull", Status: status}}
+		}
+		if err := svc.pullFromTarget(request, target); err != ErrPullNotVerified {
+			t.Errorf("pullFromTarget with verification %q error = %v, want ErrPullNotVerified", status, err)
+		}
+	}
+	if pulls != 0 {
+		t.Errorf("unverified endpoint was called %d times", pulls)
+	}
+}
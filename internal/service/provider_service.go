@@ -2,6 +2,9 @@ package service
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/wah4pc/gateway/internal/model"
@@ -10,59 +13,589 @@ import (
 
 var (
 	ErrProviderAlreadyExists = errors.New("provider with this ID already exists")
+	ErrProviderNotFound      = errors.New("provider not found")
+	ErrProviderDeactivated   = errors.New("provider is deactivated")
+	ErrProviderNotActive     = errors.New("only active providers can be suspended")
+	ErrSuspendReason         = errors.New("reason is required to suspend a provider")
+)
+
+// OnboardingMode decides whether newly registered providers need an
+// administrator's approval.
+type OnboardingMode string
+
+const (
+	// OnboardingApproval registers providers as PENDING_APPROVAL.
+	OnboardingApproval OnboardingMode = "approval"
+	// OnboardingOpen activates providers on registration.
+	OnboardingOpen OnboardingMode = "open"
 )
 
 type ProviderService struct {
-	repo *repository.ProviderRepository
+	repo          *repository.ProviderRepository
+	auditSvc      *AuditService
+	patientSvc    *PatientService
+	deliverySvc   *DeliveryService
+	identifierSvc *IdentifierSystemService
+	onboarding    OnboardingMode
+	// mu serializes read-modify-write updates of provider records.
+	mu sync.Mutex
+}
+
+func NewProviderService(repo *repository.ProviderRepository, auditSvc *AuditService, patientSvc *PatientService, deliverySvc *DeliveryService, identifierSvc *IdentifierSystemService, onboarding OnboardingMode) *ProviderService {
+	if onboarding != OnboardingOpen {
+		onboarding = OnboardingApproval
+	}
+	return &ProviderService{repo: repo, auditSvc: auditSvc, patientSvc: patientSvc, deliverySvc: deliverySvc, identifierSvc: identifierSvc, onboarding: onboarding}
 }
 
-func NewProviderService(repo *repository.ProviderRepository) *ProviderService {
-	return &ProviderService{repo: repo}
+// ProviderWithHealth is a provider together with the health of deliveries
+// to each of its callback URLs. Health is omitted until something was
+// delivered.
+type ProviderWithHealth struct {
+	model.Provider
+	Health []model.EndpointHealth `json:"health,omitempty"`
 }
 
 func (s *ProviderService) GetAllProviders() ([]model.Provider, error) {
 	return s.repo.GetAll()
 }
 
+// GetAllProvidersWithHealth lists every provider with its delivery health.
+func (s *ProviderService) GetAllProvidersWithHealth() ([]ProviderWithHealth, error) {
+	providers, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	health, err := s.deliverySvc.AllHealth()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ProviderWithHealth, len(providers))
+	for i, p := range providers {
+		result[i] = ProviderWithHealth{Provider: p, Health: healthOf(health, deliveryURLs(&p))}
+	}
+	return result, nil
+}
+
+// GetProviderWithHealth returns a provider with its delivery health.
+func (s *ProviderService) GetProviderWithHealth(providerID string) (*ProviderWithHealth, error) {
+	provider, err := s.GetProvider(providerID)
+	if err != nil {
+		return nil, err
+	}
+	health, err := s.deliverySvc.Health(deliveryURLs(provider))
+	if err != nil {
+		return nil, err
+	}
+	return &ProviderWithHealth{Provider: *provider, Health: health}, nil
+}
+
+// deliveryURLs are the URLs the gateway delivers to for a provider, whose
+// health it is shown: its subscriptions and, in pull mode, its pull
+// endpoint.
+func deliveryURLs(provider *model.Provider) []string {
+	var urls []string
+	for _, target := range challengeTargets(provider) {
+		urls = append(urls, target.URL)
+	}
+	return urls
+}
+
 func (s *ProviderService) GetProvider(providerID string) (*model.Provider, error) {
-	return s.repo.GetByID(providerID)
+	provider, err := s.repo.GetByID(providerID)
+	if err == repository.ErrProviderNotFound {
+		return nil, ErrProviderNotFound
+	}
+	return provider, err
+}
+
+// ProviderFilter narrows SearchProviders. Empty fields match everything.
+// Capability fields match providers that declare the capability or do not
+// restrict that aspect.
+type ProviderFilter struct {
+	Type model.ProviderType
+	// Name matches a case-insensitive part of the name.
+	Name string
+	// Location matches a case-insensitive part of the city, province or
+	// region; Region matches the region exactly, ignoring case.
+	Location         string
+	Region           string
+	ResourceType     string
+	FHIRVersion      string
+	IdentifierSystem string
+	Profile          string
+	Status           model.ProviderStatus
+	// Active, when set, keeps only providers that may (true) or may not
+	// (false) take part in exchanges.
+	Active *bool
+	// Offset skips matches; Limit caps the page, 0 meaning no limit.
+	Offset int
+	Limit  int
+}
+
+// SearchProviders returns a page of the providers matching filter, in
+// registration order, and the total number of matches.
+func (s *ProviderService) SearchProviders(filter ProviderFilter) ([]ProviderWithHealth, int, error) {
+	providers, err := s.GetAllProvidersWithHealth()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if filter.IdentifierSystem != "" {
+		if filter.IdentifierSystem, err = s.identifierSvc.Canonical(filter.IdentifierSystem); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	matches := []ProviderWithHealth{}
+	for _, p := range providers {
+		if !filter.matches(p.Provider) {
+			continue
+		}
+		ok, err := s.declaresIdentifierSystem(p.Capabilities, filter.IdentifierSystem)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			matches = append(matches, p)
+		}
+	}
+
+	total := len(matches)
+	if filter.Offset >= total {
+		return []ProviderWithHealth{}, total, nil
+	}
+	matches = matches[filter.Offset:]
+	if filter.Limit > 0 && filter.Limit < len(matches) {
+		matches = matches[:filter.Limit]
+	}
+	return matches, total, nil
+}
+
+func (f ProviderFilter) matches(p model.Provider) bool {
+	if f.Type != "" && p.Type != f.Type {
+		return false
+	}
+	if f.Name != "" && !containsFoldPart(p.Name, f.Name) {
+		return false
+	}
+	if f.Status != "" && providerStatus(p) != f.Status {
+		return false
+	}
+	if f.Active != nil && p.IsActive() != *f.Active {
+		return false
+	}
+
+	var location model.ProviderLocation
+	if p.Location != nil {
+		location = *p.Location
+	}
+	if f.Region != "" && !strings.EqualFold(location.Region, f.Region) {
+		return false
+	}
+	if f.Location != "" && !containsFoldPart(location.City, f.Location) &&
+		!containsFoldPart(location.Province, f.Location) && !containsFoldPart(location.Region, f.Location) {
+		return false
+	}
+
+	c := p.Capabilities
+	if c == nil {
+		return true
+	}
+	return declares(c.ResourceTypes, f.ResourceType) &&
+		declares(c.FHIRVersions, f.FHIRVersion) &&
+		declares(c.Profiles, f.Profile)
+}
+
+// declaresIdentifierSystem is declares for the canonical URI system.
+// Providers may declare systems by URI or alias, so each is resolved
+// against the registry as it is now.
+func (s *ProviderService) declaresIdentifierSystem(c *model.ProviderCapabilities, system string) (bool, error) {
+	if system == "" || c == nil || len(c.IdentifierSystems) == 0 {
+		return true, nil
+	}
+	for _, name := range c.IdentifierSystems {
+		declared, err := s.identifierSvc.Canonical(name)
+		if err != nil {
+			return false, err
+		}
+		if declared == system {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// declares reports whether a capability list allows value. An empty list
+// allows anything.
+func declares(list []string, value string) bool {
+	return value == "" || len(list) == 0 || containsFold(list, value)
+}
+
+func containsFoldPart(s, part string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(part))
+}
+
+// providerStatus treats providers registered before statuses existed as
+// active.
+func providerStatus(p model.Provider) model.ProviderStatus {
+	if p.Status == "" {
+		return model.ProviderStatusActive
+	}
+	return p.Status
+}
+
+// prepareWebhooks names new subscriptions and lets subscriptions given
+// without a secret keep the one in current.
+func prepareWebhooks(webhooks, current []model.WebhookSubscription) {
+	for i := range webhooks {
+		sub := &webhooks[i]
+		if sub.ID == "" {
+			sub.ID = newID("WH")
+			continue
+		}
+		if sub.Secret != "" {
+			continue
+		}
+		for _, c := range current {
+			if c.ID == sub.ID {
+				sub.Secret = c.Secret
+			}
+		}
+	}
 }
 
 type CreateProviderInput struct {
-	ProviderID string
-	Name       string
-	Type       model.ProviderType
-	BaseURL    string
-	Endpoints  model.ProviderEndpoints
-	Callback   model.ProviderCallback
+	ProviderID   string
+	Name         string
+	Type         model.ProviderType
+	BaseURL      string
+	Endpoints    model.ProviderEndpoints
+	Callback     model.ProviderCallback
+	Webhooks     []model.WebhookSubscription
+	FHIRFormat   model.FHIRFormat
+	Location     *model.ProviderLocation
+	Groups       []string
+	Capabilities *model.ProviderCapabilities
+	Approval     *model.ApprovalSettings
 }
 
-func (s *ProviderService) CreateProvider(input CreateProviderInput) (*model.Provider, error) {
+// CreateProvider registers a provider and returns it with its API key.
+func (s *ProviderService) CreateProvider(input CreateProviderInput) (*model.Provider, string, error) {
 	now := time.Now().UTC().Format(time.RFC3339)
 
+	apiKey, apiKeyHash, err := newAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+
 	if input.Type == "" {
 		input.Type = model.ProviderTypeOther
 	}
+	if input.FHIRFormat == "" {
+		input.FHIRFormat = model.FHIRFormatJSON
+	}
+	normalizeCapabilities(input.Capabilities)
+	prepareWebhooks(input.Webhooks, nil)
+
+	status, approvedAt := model.ProviderStatusPendingApproval, ""
+	if s.onboarding == OnboardingOpen {
+		status, approvedAt = model.ProviderStatusActive, now
+	}
 
 	provider := model.Provider{
-		ProviderID: input.ProviderID,
-		Name:       input.Name,
-		Type:       input.Type,
-		BaseURL:    input.BaseURL,
-		Endpoints:  input.Endpoints,
-		Callback:   input.Callback,
-		CreatedAt:  now,
-		UpdatedAt:  now,
+		ProviderID:   input.ProviderID,
+		Name:         input.Name,
+		Type:         input.Type,
+		BaseURL:      input.BaseURL,
+		Endpoints:    input.Endpoints,
+		Callback:     input.Callback,
+		Webhooks:     input.Webhooks,
+		FHIRFormat:   input.FHIRFormat,
+		Location:     input.Location,
+		Groups:       input.Groups,
+		Capabilities: input.Capabilities,
+		Approval:     input.Approval,
+		APIKeyHash:   apiKeyHash,
+		Status:       status,
+		ApprovedAt:   approvedAt,
+		CreatedAt:    now,
+		UpdatedAt:    now,
 	}
+	syncVerification(&provider)
 
 	if err := s.repo.Create(provider); err != nil {
 		if err == repository.ErrProviderAlreadyExists {
-			return nil, ErrProviderAlreadyExists
+			return nil, "", ErrProviderAlreadyExists
 		}
+		return nil, "", err
+	}
+
+	s.auditSvc.Record(model.AuditEntry{
+		Action:     model.AuditActionProviderRegister,
+		Outcome:    model.AuditOutcomeSuccess,
+		ProviderID: provider.ProviderID,
+		Details:    fmt.Sprintf("baseUrl %s, status %s", provider.BaseURL, provider.Status),
+	})
+
+	go s.verifyCallbacks(provider.ProviderID, false)
+
+	return &provider, apiKey, nil
+}
+
+// UpdateProviderInput replaces a provider's registration details. The ID,
+// status and creation time cannot be changed.
+type UpdateProviderInput struct {
+	Name         string
+	Type         model.ProviderType
+	BaseURL      string
+	Endpoints    model.ProviderEndpoints
+	Callback     model.ProviderCallback
+	Webhooks     []model.WebhookSubscription
+	FHIRFormat   model.FHIRFormat
+	Location     *model.ProviderLocation
+	Groups       []string
+	Capabilities *model.ProviderCapabilities
+	Approval     *model.ApprovalSettings
+}
+
+func (s *ProviderService) UpdateProvider(providerID string, input UpdateProviderInput) (*model.Provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	provider, err := s.GetProvider(providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Type == "" {
+		input.Type = model.ProviderTypeOther
+	}
+	if input.FHIRFormat == "" {
+		input.FHIRFormat = model.FHIRFormatJSON
+	}
+	normalizeCapabilities(input.Capabilities)
+	prepareWebhooks(input.Webhooks, provider.Webhooks)
+
+	provider.Name = input.Name
+	provider.Type = input.Type
+	provider.BaseURL = input.BaseURL
+	provider.Endpoints = input.Endpoints
+	provider.Callback = input.Callback
+	provider.Webhooks = input.Webhooks
+	provider.FHIRFormat = input.FHIRFormat
+	provider.Location = input.Location
+	provider.Groups = input.Groups
+	provider.Capabilities = input.Capabilities
+	provider.Approval = input.Approval
+	provider.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	// A changed callback URL is not used until it passes a new challenge.
+	challenge := syncVerification(provider)
+
+	if err := s.repo.Update(*provider); err != nil {
+		return nil, err
+	}
+	if challenge {
+		go s.verifyCallbacks(provider.ProviderID, false)
+	}
+
+	s.auditSvc.Record(model.AuditEntry{
+		Action:     model.AuditActionProviderUpdate,
+		Outcome:    model.AuditOutcomeSuccess,
+		ProviderID: provider.ProviderID,
+		Details:    "baseUrl " + provider.BaseURL,
+	})
+
+	return provider, nil
+}
+
+// DeactivateProvider soft-deletes a provider. It can no longer send or
+// receive requests, and its open requests are closed. The number of closed
+// requests is returned.
+func (s *ProviderService) DeactivateProvider(providerID, reason string) (*model.Provider, int, error) {
+	provider, err := s.deactivate(providerID, reason)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Closing is repeated for an already deactivated provider in case an
+	// earlier attempt stopped halfway.
+	closed, err := s.patientSvc.CloseRequestsForProvider(providerID, fmt.Sprintf("provider %s was deactivated", providerID))
+	if err != nil {
+		return nil, closed, err
+	}
+	return provider, closed, nil
+}
+
+func (s *ProviderService) deactivate(providerID, reason string) (*model.Provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	provider, err := s.GetProvider(providerID)
+	if err != nil || provider.Status == model.ProviderStatusDeactivated {
+		return provider, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	provider.Status = model.ProviderStatusDeactivated
+	provider.DeactivatedAt = now
+	provider.DeactivateReason = reason
+	provider.UpdatedAt = now
+	if err := s.repo.Update(*provider); err != nil {
+		return nil, err
+	}
+
+	details := "deactivated"
+	if reason != "" {
+		details += ": " + reason
+	}
+	s.auditSvc.Record(model.AuditEntry{
+		Action:     model.AuditActionProviderUpdate,
+		Outcome:    model.AuditOutcomeSuccess,
+		ProviderID: provider.ProviderID,
+		Details:    details,
+	})
+
+	return provider, nil
+}
+
+// ReactivateProvider undoes a deactivation. The provider returns to the
+// status it had before: suspended if it was suspended, active if it was
+// approved, and pending approval otherwise. Requests closed on
+// deactivation stay closed.
+func (s *ProviderService) ReactivateProvider(providerID string) (*model.Provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	provider, err := s.GetProvider(providerID)
+	if err != nil {
 		return nil, err
 	}
+	if provider.Status != model.ProviderStatusDeactivated {
+		return provider, nil
+	}
+
+	switch {
+	case provider.SuspendedAt != "":
+		provider.Status = model.ProviderStatusSuspended
+	case provider.ApprovedAt != "" || s.onboarding == OnboardingOpen:
+		provider.Status = model.ProviderStatusActive
+	default:
+		provider.Status = model.ProviderStatusPendingApproval
+	}
+	provider.DeactivatedAt = ""
+	provider.DeactivateReason = ""
+	provider.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := s.repo.Update(*provider); err != nil {
+		return nil, err
+	}
+
+	s.auditSvc.Record(model.AuditEntry{
+		Action:     model.AuditActionProviderUpdate,
+		Outcome:    model.AuditOutcomeSuccess,
+		ProviderID: provider.ProviderID,
+		Details:    "reactivated as " + string(provider.Status),
+	})
+
+	return provider, nil
+}
+
+// ApproveProvider lets a pending or suspended provider take part in
+// exchanges. Approving an active provider changes nothing.
+func (s *ProviderService) ApproveProvider(providerID, reason string) (*model.Provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	provider, err := s.GetProvider(providerID)
+	if err != nil {
+		return nil, err
+	}
+	switch provider.Status {
+	case model.ProviderStatusDeactivated:
+		return nil, ErrProviderDeactivated
+	case model.ProviderStatusPendingApproval, model.ProviderStatusSuspended:
+	default:
+		return provider, nil
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	provider.Status = model.ProviderStatusActive
+	provider.ApprovedAt = now
+	provider.ApproveReason = reason
+	provider.SuspendedAt = ""
+	provider.SuspendReason = ""
+	provider.UpdatedAt = now
+	if err := s.repo.Update(*provider); err != nil {
+		return nil, err
+	}
+
+	details := "approved"
+	if reason != "" {
+		details += ": " + reason
+	}
+	s.auditSvc.Record(model.AuditEntry{
+		Action:     model.AuditActionProviderUpdate,
+		Outcome:    model.AuditOutcomeSuccess,
+		ProviderID: provider.ProviderID,
+		Details:    details,
+	})
+
+	return provider, nil
+}
+
+// SuspendProvider bars an active provider from exchanges until it is
+// approved again. Its open requests are closed as on deactivation, and
+// their number is returned.
+func (s *ProviderService) SuspendProvider(providerID, reason string) (*model.Provider, int, error) {
+	if reason == "" {
+		return nil, 0, ErrSuspendReason
+	}
+
+	provider, err := s.suspend(providerID, reason)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	closed, err := s.patientSvc.CloseRequestsForProvider(providerID, fmt.Sprintf("provider %s was suspended: %s", providerID, reason))
+	if err != nil {
+		return nil, closed, err
+	}
+	return provider, closed, nil
+}
+
+func (s *ProviderService) suspend(providerID, reason string) (*model.Provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	provider, err := s.GetProvider(providerID)
+	if err != nil {
+		return nil, err
+	}
+	if provider.Status == model.ProviderStatusSuspended {
+		return provider, nil
+	}
+	if !provider.IsActive() {
+		return nil, ErrProviderNotActive
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	provider.Status = model.ProviderStatusSuspended
+	provider.SuspendedAt = now
+	provider.SuspendReason = reason
+	provider.UpdatedAt = now
+	if err := s.repo.Update(*provider); err != nil {
+		return nil, err
+	}
+
+	s.auditSvc.Record(model.AuditEntry{
+		Action:     model.AuditActionProviderUpdate,
+		Outcome:    model.AuditOutcomeSuccess,
+		ProviderID: provider.ProviderID,
+		Details:    "suspended: " + reason,
+	})
 
-	return &provider, nil
+	return provider, nil
 }
 
 func (s *ProviderService) ProviderExists(providerID string) bool {
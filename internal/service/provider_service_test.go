@@ -0,0 +1,56 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+func TestSearchProvidersByIdentifierSystem(t *testing.T) {
+	store, err := repository.NewJSONStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identifierSvc, err := NewIdentifierSystemService(repository.NewIdentifierSystemRepository(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerRepo := repository.NewProviderRepository(store)
+	for _, p := range []model.Provider{
+		{ProviderID: "by-uri", Capabilities: &model.ProviderCapabilities{IdentifierSystems: []string{SystemPhilHealthID}}},
+		{ProviderID: "by-alias", Capabilities: &model.ProviderCapabilities{IdentifierSystems: []string{"PhilHealth"}}},
+		{ProviderID: "other-system", Capabilities: &model.ProviderCapabilities{IdentifierSystems: []string{"PCN"}}},
+		{ProviderID: "unrestricted"},
+	} {
+		if err := providerRepo.Create(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deliverySvc := NewDeliveryService(repository.NewDeliveryRepository(store), CircuitPolicy{FailureThreshold: 5, OpenDuration: time.Minute})
+	svc := NewProviderService(providerRepo, nil, nil, deliverySvc, identifierSvc, OnboardingOpen)
+
+	want := []string{"by-uri", "by-alias", "unrestricted"}
+	for _, system := range []string{SystemPhilHealthID, "PHILHEALTH_PIN", "pin"} {
+		t.Run(system, func(t *testing.T) {
+			providers, total, err := svc.SearchProviders(ProviderFilter{IdentifierSystem: system})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, p := range providers {
+				got = append(got, p.ProviderID)
+			}
+			if total != len(want) || len(got) != len(want) {
+				t.Fatalf("SearchProviders() = %v, want %v", got, want)
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("SearchProviders() = %v, want %v", got, want)
+					break
+				}
+			}
+		})
+	}
+}
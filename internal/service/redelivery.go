@@ -0,0 +1,148 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/pkg/httpclient"
+)
+
+// deliver POSTs payload to a subscription through its URL's circuit
+// breaker, naming the event and signing it with the subscription's secret.
+// While the circuit is open the delivery is queued and ErrDeliveryQueued
+// returned; a failure that leaves the circuit open queues it as well, with
+// one more attempt counted, unless that gives it up.
+func (s *PatientService) deliver(item model.QueuedDelivery, sub model.WebhookSubscription, payload interface{}) error {
+	item.URL = sub.URL
+	if !s.deliverySvc.Allow(sub.URL) {
+		if err := s.deliverySvc.Enqueue(item); err != nil {
+			return err
+		}
+		return ErrDeliveryQueued
+	}
+
+	start := time.Now()
+	err := httpclient.PostJSONWith(sub.URL, payload, httpclient.Options{
+		Headers: map[string]string{httpclient.EventHeader: string(item.Event)},
+		Secret:  sub.Secret,
+	}, nil)
+	state := s.deliverySvc.Record(sub.URL, time.Since(start), err)
+	if err != nil {
+		item.Attempts++
+		if state == model.CircuitClosed {
+			return err
+		}
+		if qerr := s.deliverySvc.Enqueue(item); qerr != nil {
+			if qerr != ErrDeliveryFailed {
+				log.Printf("delivery: failed to queue %s for %s: %v", item.Callback, item.RequestID, qerr)
+			}
+			return err
+		}
+		return ErrDeliveryQueued
+	}
+
+	go s.drainQueue(sub.URL)
+	return nil
+}
+
+// redeliver rebuilds and pushes a queued delivery to its subscription.
+// Deliveries whose request was answered, cancelled or purged in the
+// meantime, or whose subscription was removed, are dropped.
+func (s *PatientService) redeliver(item model.QueuedDelivery) error {
+	request, err := s.requestRepo.GetByID(item.RequestID)
+	if err != nil {
+		log.Printf("delivery: dropping queued %s for %s: %v", item.Callback, item.RequestID, err)
+		return nil
+	}
+	provider, err := s.providerRepo.GetByID(item.ProviderID)
+	if err != nil || !provider.IsActive() {
+		return nil
+	}
+	sub, ok := provider.Subscription(item.Callback)
+	if !ok || !provider.CallbackVerified(sub.URL) {
+		log.Printf("delivery: dropping queued %s for %s: subscription removed or unverified", item.Callback, item.RequestID)
+		return nil
+	}
+
+	event := item.Event
+	var response *model.PatientResponse
+	switch event {
+	case model.WebhookEventRequestCreated:
+		if request.Status != model.RequestStatusPending {
+			return nil
+		}
+	case model.WebhookEventRequestCompleted, model.WebhookEventRequestFailed:
+		response, err = s.responseRepo.GetByRequestID(item.RequestID)
+		if err != nil {
+			log.Printf("delivery: dropping queued %s for %s: %v", item.Callback, item.RequestID, err)
+			return nil
+		}
+		event = responseEvent(response)
+	}
+	if !sub.Receives(event) {
+		return nil
+	}
+	item.Event = event
+	return s.deliverItem(provider, sub, item, request, response)
+}
+
+// drainQueue delivers the deliveries queued for url oldest first until the
+// queue is empty or a delivery fails. A delivery that fails while the
+// circuit stays closed is requeued in its place with one more attempt
+// counted; one the circuit holds back was requeued by deliver.
+func (s *PatientService) drainQueue(url string) {
+	for {
+		item, err := s.deliverySvc.Dequeue(url)
+		if err != nil {
+			log.Printf("delivery: failed to read queue of %s: %v", url, err)
+			return
+		}
+		if item == nil {
+			return
+		}
+		if err := s.redeliver(*item); err != nil {
+			if err != ErrDeliveryQueued {
+				s.requeue(*item)
+			}
+			return
+		}
+	}
+}
+
+// requeue puts back a delivery whose attempt failed, unless it has run out
+// of attempts.
+func (s *PatientService) requeue(item model.QueuedDelivery) {
+	item.Attempts++
+	if err := s.deliverySvc.Enqueue(item); err != nil && err != ErrDeliveryFailed {
+		log.Printf("delivery: failed to requeue %s for %s: %v", item.Callback, item.RequestID, err)
+	}
+}
+
+// RunDeliveryProbes sends one queued delivery to every URL whose open
+// circuit is due for a probe, or whose closed circuit holds deliveries to
+// retry, on every tick of interval. A successful delivery drains the rest
+// of the queue. It never returns.
+func (s *PatientService) RunDeliveryProbes(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		<-ticker.C
+		due, err := s.deliverySvc.ProbeDue()
+		if err != nil {
+			log.Printf("delivery: failed to list probes: %v", err)
+			continue
+		}
+		for _, url := range due {
+			item, err := s.deliverySvc.Dequeue(url)
+			if err != nil || item == nil {
+				continue
+			}
+			// Successful probes drain the queue themselves.
+			if err := s.redeliver(*item); err != nil && err != ErrDeliveryQueued {
+				s.requeue(*item)
+			}
+		}
+	}
+}
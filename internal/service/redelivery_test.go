@@ -0,0 +1,166 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+	"github.com/wah4pc/gateway/pkg/httpclient"
+)
+
+func allowLoopback(t *testing.T) {
+	t.Helper()
+	networks, err := httpclient.ParseNetworks("127.0.0.0/8,::1/128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpclient.SetAllowedNetworks(networks)
+	t.Cleanup(func() { httpclient.SetAllowedNetworks(nil) })
+}
+
+func TestDrainQueueRequeuesFailedDelivery(t *testing.T) {
+	allowLoopback(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	store, err := repository.NewJSONStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerRepo := repository.NewProviderRepository(store)
+	requestRepo := repository.NewRequestRepository(store)
+	if err := providerRepo.Create(model.Provider{
+		ProviderID: "hospital-b",
+		Status:     model.ProviderStatusActive,
+		Callback:   model.ProviderCallback{PatientRequest: srv.URL},
+		CallbackVerification: []model.CallbackVerification{
+			{Callback: model.CallbackPatientRequest, URL: srv.URL, Status: model.CallbackVerificationVerified},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := requestRepo.Create(model.PatientRequest{
+		RequestID:           "REQ-1",
+		RequestorProviderID: "clinic-a",
+		TargetProviderID:    "hospital-b",
+		Status:              model.RequestStatusPending,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	deliverySvc := NewDeliveryService(repository.NewDeliveryRepository(store), CircuitPolicy{FailureThreshold: 5, OpenDuration: time.Minute})
+	svc := NewPatientService(PatientServiceDeps{
+		ProviderRepo: providerRepo,
+		RequestRepo:  requestRepo,
+		ResponseRepo: repository.NewResponseRepository(store),
+		DeliverySvc:  deliverySvc,
+	})
+
+	queued := model.QueuedDelivery{
+		ProviderID: "hospital-b",
+		Callback:   model.CallbackPatientRequest,
+		URL:        srv.URL,
+		Event:      model.WebhookEventRequestCreated,
+		RequestID:  "REQ-1",
+		QueuedAt:   "2026-01-01T00:00:00Z",
+		Attempts:   2,
+	}
+	if err := deliverySvc.Enqueue(queued); err != nil {
+		t.Fatal(err)
+	}
+
+	svc.drainQueue(srv.URL)
+
+	item, err := deliverySvc.Dequeue(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item == nil {
+		t.Fatal("failed delivery was not requeued")
+	}
+	if item.Attempts != 3 {
+		t.Errorf("attempts = %d, want 3", item.Attempts)
+	}
+	if item.QueuedAt != queued.QueuedAt {
+		t.Errorf("queuedAt = %s, want %s", item.QueuedAt, queued.QueuedAt)
+	}
+}
+
+func TestCircuitIsKeptPerURL(t *testing.T) {
+	store, err := repository.NewJSONStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewDeliveryService(repository.NewDeliveryRepository(store), CircuitPolicy{FailureThreshold: 2, OpenDuration: time.Minute})
+
+	const down, up = "https://clinic.example.ph/request", "https://clinic.example.ph/response"
+	for i := 0; i < 2; i++ {
+		svc.Record(down, time.Millisecond, errors.New("connection refused"))
+	}
+	svc.Record(up, time.Millisecond, nil)
+
+	if svc.Allow(down) {
+		t.Errorf("Allow(%s) = true after the failure threshold", down)
+	}
+	if !svc.Allow(up) {
+		t.Errorf("Allow(%s) = false, another URL's failures opened its circuit", up)
+	}
+
+	health, err := svc.Health([]string{down, up, "https://other.example.ph/request"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(health) != 2 {
+		t.Fatalf("health has %d URLs, want 2", len(health))
+	}
+}
+
+func TestEnqueueGivesUpAfterMaxAttempts(t *testing.T) {
+	store, err := repository.NewJSONStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := NewDeliveryService(repository.NewDeliveryRepository(store), CircuitPolicy{FailureThreshold: 5, OpenDuration: time.Minute, MaxAttempts: 3})
+
+	const url = "https://clinic.example.ph/request"
+	svc.Record(url, time.Millisecond, errors.New("connection refused"))
+
+	tests := []struct {
+		requestID string
+		attempts  int
+		wantErr   error
+	}{
+		{"REQ-1", 2, nil},
+		{"REQ-2", 3, ErrDeliveryFailed},
+	}
+	for _, tt := range tests {
+		err := svc.Enqueue(model.QueuedDelivery{
+			ProviderID: "clinic-b",
+			Callback:   model.CallbackPatientRequest,
+			URL:        url,
+			Event:      model.WebhookEventRequestCreated,
+			RequestID:  tt.requestID,
+			Attempts:   tt.attempts,
+		})
+		if err != tt.wantErr {
+			t.Errorf("Enqueue with %d attempts error = %v, want %v", tt.attempts, err, tt.wantErr)
+		}
+	}
+
+	health, err := svc.Health([]string{url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(health) != 1 {
+		t.Fatalf("health has %d URLs, want 1", len(health))
+	}
+	if health[0].QueuedDeliveries != 1 || health[0].FailedDeliveries != 1 {
+		t.Errorf("queued, failed = %d, %d, want 1, 1", health[0].QueuedDeliveries, health[0].FailedDeliveries)
+	}
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/internal/repository"
+)
+
+// RetentionPolicy limits how long patient data stays in the gateway, in
+// days. Zero disables a rule.
+type RetentionPolicy struct {
+	// PayloadAfterDeliveryDays purges FHIRPatient this long after the
+	// requestor received it.
+	PayloadAfterDeliveryDays int `json:"payloadAfterDeliveryDays"`
+	// PayloadUndeliveredDays purges FHIRPatient this long after it was
+	// received if the requestor never collected it.
+	PayloadUndeliveredDays int `json:"payloadUndeliveredDays"`
+	// MetadataDays deletes finished requests, with their responses,
+	// approvals and break-glass reviews, this long after their last update.
+	// Requests whose break-glass review is still open are kept.
+	MetadataDays int `json:"metadataDays"`
+}
+
+// Enabled reports whether any rule is active.
+func (p RetentionPolicy) Enabled() bool {
+	return p.PayloadAfterDeliveryDays > 0 || p.PayloadUndeliveredDays > 0 || p.MetadataDays > 0
+}
+
+type RetentionAction string
+
+const (
+	RetentionPurgePayload RetentionAction = "PURGE_PAYLOAD"
+	RetentionDeleteRecord RetentionAction = "DELETE_RECORD"
+)
+
+// RetentionItem is one action the policy takes (or would take) on a request.
+type RetentionItem struct {
+	RequestID string              `json:"requestId"`
+	Action    RetentionAction     `json:"action"`
+	Status    model.RequestStatus `json:"status"`
+	// Basis names the timestamp the retention period runs from.
+	Basis     string `json:"basis"`
+	BasisTime string `json:"basisTime"`
+	DueAt     string `json:"dueAt"`
+}
+
+type RetentionReport struct {
+	Policy        RetentionPolicy `json:"policy"`
+	GeneratedAt   string          `json:"generatedAt"`
+	DryRun        bool            `json:"dryRun"`
+	PayloadPurges int             `json:"payloadPurges"`
+	RecordDeletes int             `json:"recordDeletes"`
+	Items         []RetentionItem `json:"items"`
+}
+
+type RetentionService struct {
+	requestRepo    *repository.RequestRepository
+	responseRepo   *repository.ResponseRepository
+	approvalRepo   *repository.ApprovalRepository
+	breakGlassRepo *repository.BreakGlassRepository
+	policy         RetentionPolicy
+}
+
+func NewRetentionService(
+	requestRepo *repository.RequestRepository,
+	responseRepo *repository.ResponseRepository,
+	approvalRepo *repository.ApprovalRepository,
+	breakGlassRepo *repository.BreakGlassRepository,
+	policy RetentionPolicy,
+) *RetentionService {
+	return &RetentionService{
+		requestRepo:    requestRepo,
+		responseRepo:   responseRepo,
+		approvalRepo:   approvalRepo,
+		breakGlassRepo: breakGlassRepo,
+		policy:         policy,
+	}
+}
+
+// Enabled reports whether the policy purges anything.
+func (s *RetentionService) Enabled() bool {
+	return s.policy.Enabled()
+}
+
+// Run purges on every tick of interval. It never returns.
+func (s *RetentionService) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := s.Purge()
+		if err != nil {
+			log.Printf("retention: purge failed: %v", err)
+		} else if report.PayloadPurges > 0 || report.RecordDeletes > 0 {
+			log.Printf("retention: purged %d payloads, deleted %d records", report.PayloadPurges, report.RecordDeletes)
+		}
+		<-ticker.C
+	}
+}
+
+// Plan reports what a purge at now would do without changing anything.
+func (s *RetentionService) Plan(now time.Time) (*RetentionReport, error) {
+	requests, err := s.requestRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	responses, err := s.responseRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	byRequestID := make(map[string]model.PatientResponse, len(responses))
+	for _, resp := range responses {
+		byRequestID[resp.RequestID] = resp
+	}
+	reviews, err := s.breakGlassRepo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	openReview := make(map[string]bool)
+	for _, review := range reviews {
+		if review.Status == model.BreakGlassReviewPending {
+			openReview[review.RequestID] = true
+		}
+	}
+
+	report := &RetentionReport{
+		Policy:      s.policy,
+		GeneratedAt: now.UTC().Format(time.RFC3339),
+		DryRun:      true,
+		Items:       []RetentionItem{},
+	}
+	for _, req := range requests {
+		resp, hasResponse := byRequestID[req.RequestID]
+
+		// An open break-glass review still needs the request it reviews.
+		if item, ok := s.recordRule(req, resp, hasResponse, now); ok && !openReview[req.RequestID] {
+			report.Items = append(report.Items, item)
+			report.RecordDeletes++
+			continue
+		}
+		if !hasResponse {
+			continue
+		}
+		if item, ok := s.payloadRule(resp, now); ok {
+			report.Items = append(report.Items, item)
+			report.PayloadPurges++
+		}
+	}
+	return report, nil
+}
+
+func (s *RetentionService) recordRule(req model.PatientRequest, resp model.PatientResponse, hasResponse bool, now time.Time) (RetentionItem, bool) {
+	if s.policy.MetadataDays == 0 || req.Status == model.RequestStatusPending || req.Status == model.RequestStatusAwaitingApproval {
+		return RetentionItem{}, false
+	}
+	basis, basisTime := "updatedAt", req.UpdatedAt
+	if hasResponse && resp.ReceivedAt > basisTime {
+		basis, basisTime = "receivedAt", resp.ReceivedAt
+	}
+	return retentionItem(req.RequestID, RetentionDeleteRecord, req.Status, basis, basisTime, s.policy.MetadataDays, now)
+}
+
+func (s *RetentionService) payloadRule(resp model.PatientResponse, now time.Time) (RetentionItem, bool) {
+	if len(resp.FHIRPatient) == 0 {
+		return RetentionItem{}, false
+	}
+	if resp.DeliveredAt != "" {
+		if s.policy.PayloadAfterDeliveryDays == 0 {
+			return RetentionItem{}, false
+		}
+		return retentionItem(resp.RequestID, RetentionPurgePayload, resp.Status, "deliveredAt", resp.DeliveredAt, s.policy.PayloadAfterDeliveryDays, now)
+	}
+	if s.policy.PayloadUndeliveredDays == 0 {
+		return RetentionItem{}, false
+	}
+	return retentionItem(resp.RequestID, RetentionPurgePayload, resp.Status, "receivedAt", resp.ReceivedAt, s.policy.PayloadUndeliveredDays, now)
+}
+
+func retentionItem(requestID string, action RetentionAction, status model.RequestStatus, basis, basisTime string, days int, now time.Time) (RetentionItem, bool) {
+	t, err := time.Parse(time.RFC3339, basisTime)
+	if err != nil {
+		return RetentionItem{}, false
+	}
+	due := t.AddDate(0, 0, days)
+	if now.Before(due) {
+		return RetentionItem{}, false
+	}
+	return RetentionItem{
+		RequestID: requestID,
+		Action:    action,
+		Status:    status,
+		Basis:     basis,
+		BasisTime: basisTime,
+		DueAt:     due.UTC().Format(time.RFC3339),
+	}, true
+}
+
+// Purge applies the policy now and reports what was done.
+func (s *RetentionService) Purge() (*RetentionReport, error) {
+	now := time.Now().UTC()
+	report, err := s.Plan(now)
+	if err != nil {
+		return nil, err
+	}
+	report.DryRun = false
+
+	var deleteIDs []string
+	for _, item := range report.Items {
+		switch item.Action {
+		case RetentionPurgePayload:
+			resp, err := s.responseRepo.GetByRequestID(item.RequestID)
+			if err != nil {
+				return nil, err
+			}
+			resp.FHIRPatient = nil
+			resp.PurgedAt = now.Format(time.RFC3339)
+			if err := s.responseRepo.Update(*resp); err != nil {
+				return nil, err
+			}
+		case RetentionDeleteRecord:
+			deleteIDs = append(deleteIDs, item.RequestID)
+		}
+	}
+
+	if len(deleteIDs) > 0 {
+		if err := s.responseRepo.Delete(deleteIDs); err != nil {
+			return nil, err
+		}
+		if err := s.approvalRepo.Delete(deleteIDs); err != nil {
+			return nil, err
+		}
+		if err := s.breakGlassRepo.Delete(deleteIDs); err != nil {
+			return nil, err
+		}
+		if err := s.requestRepo.Delete(deleteIDs); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
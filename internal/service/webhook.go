@@ -0,0 +1,175 @@
+package service
+
+import (
+	"log"
+
+	"github.com/wah4pc/gateway/internal/fhirmap"
+	"github.com/wah4pc/gateway/internal/model"
+	"github.com/wah4pc/gateway/pkg/fhir"
+)
+
+// RequestEventPayload is delivered for request.cancelled and
+// request.status_changed. It carries no patient data.
+type RequestEventPayload struct {
+	Event               model.WebhookEvent  `json:"event"`
+	RequestID           string              `json:"requestId"`
+	RequestorProviderID string              `json:"requestorProviderId"`
+	TargetProviderID    string              `json:"targetProviderId"`
+	Status              model.RequestStatus `json:"status"`
+	Error               string              `json:"error,omitempty"`
+	UpdatedAt           string              `json:"updatedAt,omitempty"`
+	Task                *fhir.Task          `json:"task,omitempty"`
+}
+
+// responseEvent is the event reporting a response to the requestor.
+func responseEvent(response *model.PatientResponse) model.WebhookEvent {
+	if response.Status == model.RequestStatusCompleted {
+		return model.WebhookEventRequestCompleted
+	}
+	return model.WebhookEventRequestFailed
+}
+
+// notify delivers event to each of provider's subscriptions that receive
+// it and whose URL is verified. Inactive providers are not notified. It
+// returns the first delivery error.
+func (s *PatientService) notify(provider *model.Provider, event model.WebhookEvent, request *model.PatientRequest, response *model.PatientResponse) error {
+	if !provider.IsActive() {
+		return nil
+	}
+
+	var firstErr error
+	subscribed := false
+	for _, sub := range provider.Subscriptions() {
+		if !sub.Receives(event) {
+			continue
+		}
+		subscribed = true
+		if !provider.CallbackVerified(sub.URL) {
+			log.Printf("webhook: %s subscription %s is not verified, skipping %s for request %s", provider.ProviderID, sub.ID, event, request.RequestID)
+			continue
+		}
+		if err := s.deliverEvent(provider, sub, event, request, response); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if !subscribed && (event == model.WebhookEventRequestCreated || response != nil) {
+		log.Printf("webhook: %s has no subscription to %s, it must poll for request %s", provider.ProviderID, event, request.RequestID)
+	}
+	return firstErr
+}
+
+// deliverEvent builds the payload of event and delivers it to one
+// subscription. Responses are rendered in the provider's FHIR format, and
+// their delivery is audited since it releases patient data.
+func (s *PatientService) deliverEvent(provider *model.Provider, sub model.WebhookSubscription, event model.WebhookEvent, request *model.PatientRequest, response *model.PatientResponse) error {
+	return s.deliverItem(provider, sub, model.QueuedDelivery{
+		ProviderID: provider.ProviderID,
+		Callback:   sub.ID,
+		URL:        sub.URL,
+		Event:      event,
+		RequestID:  request.RequestID,
+	}, request, response)
+}
+
+// deliverItem delivers item's event, keeping item's place and attempt
+// count if it has to be queued again.
+func (s *PatientService) deliverItem(provider *model.Provider, sub model.WebhookSubscription, item model.QueuedDelivery, request *model.PatientRequest, response *model.PatientResponse) error {
+	event := item.Event
+
+	var payload interface{}
+	switch event {
+	case model.WebhookEventRequestCreated:
+		payload = requestPayload(request)
+	case model.WebhookEventRequestCompleted, model.WebhookEventRequestFailed:
+		fhirPatient, err := renderFHIRPatient(response.FHIRPatient, provider.FHIRFormat)
+		if err != nil {
+			log.Printf("webhook: failed to render fhirPatient as %s for request %s: %v", provider.FHIRFormat, request.RequestID, err)
+			return nil
+		}
+		payload = CallbackPayload{
+			RequestID:      response.RequestID,
+			FromProviderID: response.FromProviderID,
+			ToProviderID:   provider.ProviderID,
+			Status:         response.Status,
+			FHIRFormat:     formatOrDefault(provider.FHIRFormat),
+			FHIRVersion:    response.FHIRVersion,
+			Deidentified:   response.Deidentified,
+			FHIRPatient:    fhirPatient,
+			Error:          response.Error,
+			BreakGlass:     request.BreakGlass,
+			Task:           fhirmap.TaskFromRequest(request, response),
+		}
+	default:
+		payload = RequestEventPayload{
+			Event:               event,
+			RequestID:           request.RequestID,
+			RequestorProviderID: request.RequestorProviderID,
+			TargetProviderID:    request.TargetProviderID,
+			Status:              request.Status,
+			Error:               s.responseError(request),
+			UpdatedAt:           request.UpdatedAt,
+			Task:                fhirmap.TaskFromRequest(request, nil),
+		}
+	}
+
+	err := s.deliver(item, sub, payload)
+	if err != nil {
+		log.Printf("webhook: %s for request %s to %s %s: %v", event, request.RequestID, provider.ProviderID, sub.URL, err)
+	} else {
+		log.Printf("webhook: sent %s for request %s to %s %s", event, request.RequestID, provider.ProviderID, sub.URL)
+	}
+
+	if response == nil {
+		return err
+	}
+	entry := model.AuditEntry{
+		Action:             model.AuditActionResponseDeliver,
+		Outcome:            model.AuditOutcomeSuccess,
+		ProviderID:         provider.ProviderID,
+		RequestIDs:         []string{request.RequestID},
+		PatientIdentifiers: request.PatientReference.Identifiers,
+		Details:            "callback " + sub.URL,
+	}
+	switch {
+	case err == nil:
+		s.auditSvc.Record(entry)
+		s.markDelivered(response)
+	// Queued responses are audited once they are delivered.
+	case err != ErrDeliveryQueued:
+		entry.Outcome = model.AuditOutcomeFailure
+		entry.Details += ": " + err.Error()
+		s.auditSvc.Record(entry)
+	}
+	return err
+}
+
+// responseError is the error of a request's response, if it has one.
+func (s *PatientService) responseError(request *model.PatientRequest) string {
+	response, err := s.responseRepo.GetByRequestID(request.RequestID)
+	if err != nil {
+		return ""
+	}
+	return response.Error
+}
+
+// notifyStatusChange sends request.status_changed to both parties of a
+// request.
+func (s *PatientService) notifyStatusChange(request model.PatientRequest) {
+	for _, providerID := range []string{request.RequestorProviderID, request.TargetProviderID} {
+		provider, err := s.providerRepo.GetByID(providerID)
+		if err != nil {
+			continue
+		}
+		s.notify(provider, model.WebhookEventStatusChanged, &request, nil)
+	}
+}
+
+// notifyCancelled sends request.cancelled to the target of a request.
+func (s *PatientService) notifyCancelled(request model.PatientRequest) {
+	target, err := s.providerRepo.GetByID(request.TargetProviderID)
+	if err != nil {
+		return
+	}
+	s.notify(target, model.WebhookEventRequestCancelled, &request, nil)
+}
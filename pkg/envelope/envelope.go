@@ -0,0 +1,198 @@
+// Package envelope implements envelope encryption for values stored at rest.
+//
+// Every value is encrypted with a fresh AES-256-GCM data key, which is in
+// turn encrypted (wrapped) with a master key from the Keyring. Sealed values
+// are self-describing strings:
+//
+//	enc:v1:<keyID>:<wrapped data key>:<ciphertext>
+//
+// with both binary parts base64 (raw URL) encoded and prefixed by their nonce.
+// The key ID names the master key, so master keys can be rotated while older
+// values remain readable.
+package envelope
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const prefix = "enc:v1:"
+
+var (
+	ErrUnknownKey   = errors.New("envelope: unknown key ID")
+	ErrMalformed    = errors.New("envelope: malformed sealed value")
+	ErrInvalidKey   = errors.New("envelope: master keys must be 32 bytes, base64 encoded")
+	ErrNoActiveKey  = errors.New("envelope: keyring has no keys")
+	ErrDecryptValue = errors.New("envelope: value cannot be decrypted")
+)
+
+// Keyring holds the master keys by ID. The active key seals new values; all
+// keys can open values sealed with them.
+type Keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+// NewKeyring builds a keyring from "id:base64key" entries. The last entry is
+// the active key, so rotation means appending a new key.
+func NewKeyring(entries []string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string][]byte)}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("envelope: key entry must be id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("%w (key %q)", ErrInvalidKey, id)
+		}
+		k.keys[id] = key
+		k.active = id
+	}
+	if k.active == "" {
+		return nil, ErrNoActiveKey
+	}
+	return k, nil
+}
+
+// LoadKeyring reads keys from a key file (one "id:base64key" per line) and
+// from a comma separated list, in that order. It returns nil when neither
+// source is configured.
+func LoadKeyring(keyFile, keys string) (*Keyring, error) {
+	var entries []string
+	if keyFile != "" {
+		f, err := os.Open(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			entries = append(entries, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if keys != "" {
+		entries = append(entries, strings.Split(keys, ",")...)
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return NewKeyring(entries)
+}
+
+// ActiveKeyID returns the ID of the key new values are sealed with.
+func (k *Keyring) ActiveKeyID() string {
+	return k.active
+}
+
+// IsSealed reports whether value was produced by Seal.
+func IsSealed(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the master key ID of a sealed value.
+func KeyID(value string) string {
+	parts := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)
+	if !IsSealed(value) || len(parts) != 2 {
+		return ""
+	}
+	return parts[0]
+}
+
+// Seal encrypts plaintext under a new data key wrapped with the active key.
+func (k *Keyring) Seal(plaintext []byte) (string, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	ciphertext, err := encrypt(dataKey, plaintext)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := encrypt(k.keys[k.active], dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	return prefix + k.active + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(ciphertext), nil
+}
+
+// Open decrypts a value produced by Seal.
+func (k *Keyring) Open(value string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	if !IsSealed(value) || len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	masterKey, ok := k.keys[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, parts[0])
+	}
+
+	enc := base64.RawURLEncoding
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	ciphertext, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	dataKey, err := decrypt(masterKey, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return decrypt(dataKey, ciphertext)
+}
+
+func encrypt(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func decrypt(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecryptValue
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
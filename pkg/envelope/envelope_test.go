@@ -0,0 +1,173 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T, id string) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return id + ":" + base64.StdEncoding.EncodeToString(key)
+}
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name       string
+		entries    []string
+		wantActive string
+		wantErr    error
+	}{
+		{"single key", []string{testKey(t, "k1")}, "k1", nil},
+		{"last key is active", []string{testKey(t, "k1"), testKey(t, "k2")}, "k2", nil},
+		{"comments and blanks skipped", []string{"# retired below", "", testKey(t, "k1")}, "k1", nil},
+		{"no keys", []string{"", "# none"}, "", ErrNoActiveKey},
+		{"short key", []string{"k1:" + base64.StdEncoding.EncodeToString([]byte("short"))}, "", ErrInvalidKey},
+		{"not base64", []string{"k1:not base64!"}, "", ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := NewKeyring(tt.entries)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("NewKeyring error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := k.ActiveKeyID(); got != tt.wantActive {
+				t.Errorf("ActiveKeyID() = %s, want %s", got, tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	k, err := NewKeyring([]string{testKey(t, "k1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte(`{"resourceType":"Patient","id":"b-7"}`)
+
+	sealed, err := k.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) {
+		t.Errorf("IsSealed(%q) = false", sealed)
+	}
+	if got := KeyID(sealed); got != "k1" {
+		t.Errorf("KeyID() = %s, want k1", got)
+	}
+	if strings.Contains(sealed, "b-7") {
+		t.Errorf("sealed value %q contains plaintext", sealed)
+	}
+
+	again, err := k.Seal(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == sealed {
+		t.Error("sealing the same plaintext twice gave the same value")
+	}
+
+	opened, err := k.Open(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Open() = %s, want %s", opened, plaintext)
+	}
+}
+
+func TestOpenAfterRotation(t *testing.T) {
+	oldKey, newKey := testKey(t, "k1"), testKey(t, "k2")
+	before, err := NewKeyring([]string{oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := before.Seal([]byte("CB-MRN-5678"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := NewKeyring([]string{oldKey, newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened, err := rotated.Open(sealed)
+	if err != nil {
+		t.Fatalf("Open() with the retired key in the keyring: %v", err)
+	}
+	if string(opened) != "CB-MRN-5678" {
+		t.Errorf("Open() = %s, want CB-MRN-5678", opened)
+	}
+	resealed, err := rotated.Seal(opened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := KeyID(resealed); got != "k2" {
+		t.Errorf("KeyID() after rotation = %s, want k2", got)
+	}
+
+	newOnly, err := NewKeyring([]string{newKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newOnly.Open(sealed); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Open() without the retired key error = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestOpenRejectsBadValues(t *testing.T) {
+	k, err := NewKeyring([]string{testKey(t, "k1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := k.Seal([]byte("CB-MRN-5678"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(sealed, ":")
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext[len(ciphertext)-1] ^= 0xff
+	parts[4] = base64.RawURLEncoding.EncodeToString(ciphertext)
+	tampered := strings.Join(parts, ":")
+
+	other, err := NewKeyring([]string{testKey(t, "k1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		value   string
+		wantErr error
+	}{
+		{"plaintext", k, "CB-MRN-5678", ErrMalformed},
+		{"missing part", k, "enc:v1:k1:abc", ErrMalformed},
+		{"bad encoding", k, "enc:v1:k1:!!!:abc", ErrMalformed},
+		{"tampered ciphertext", k, tampered, ErrDecryptValue},
+		{"same key ID, different key", other, sealed, ErrDecryptValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.keyring.Open(tt.value); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Open() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package fhir
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// DeidStep is a single transformation of the de-identification pipeline.
+type DeidStep string
+
+const (
+	DeidRemoveNames             DeidStep = "remove-names"
+	DeidRemoveTelecom           DeidStep = "remove-telecom"
+	DeidRemoveAddress           DeidStep = "remove-address"
+	DeidRemovePhoto             DeidStep = "remove-photo"
+	DeidRemoveNarrative         DeidStep = "remove-narrative"
+	DeidGeneralizeBirthDate     DeidStep = "generalize-birthdate"
+	DeidPseudonymizeIdentifiers DeidStep = "pseudonymize-identifiers"
+)
+
+// DefaultDeidSteps removes all direct identifiers handled by the pipeline.
+var DefaultDeidSteps = []DeidStep{
+	DeidRemoveNames,
+	DeidRemoveTelecom,
+	DeidRemoveAddress,
+	DeidRemovePhoto,
+	DeidRemoveNarrative,
+	DeidGeneralizeBirthDate,
+	DeidPseudonymizeIdentifiers,
+}
+
+// PseudonymSystem is the identifier system of generated pseudonyms.
+const PseudonymSystem = "urn:wah4pc:pseudonym"
+
+// Deidentifier runs a configured sequence of steps over Patient resources.
+type Deidentifier struct {
+	steps []DeidStep
+	key   []byte
+}
+
+// NewDeidentifier builds a pipeline. key is the HMAC secret for pseudonyms;
+// the same key always yields the same pseudonym for an identifier.
+func NewDeidentifier(steps []DeidStep, key []byte) (*Deidentifier, error) {
+	for _, step := range steps {
+		switch step {
+		case DeidRemoveNames, DeidRemoveTelecom, DeidRemoveAddress, DeidRemovePhoto,
+			DeidRemoveNarrative, DeidGeneralizeBirthDate, DeidPseudonymizeIdentifiers:
+		default:
+			return nil, fmt.Errorf("unknown de-identification step %q", step)
+		}
+		if step == DeidPseudonymizeIdentifiers && len(key) == 0 {
+			return nil, fmt.Errorf("step %q requires a pseudonym key", step)
+		}
+	}
+	return &Deidentifier{steps: steps, key: key}, nil
+}
+
+// ParseDeidSteps parses a comma separated list of step names.
+func ParseDeidSteps(value string) []DeidStep {
+	var steps []DeidStep
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			steps = append(steps, DeidStep(s))
+		}
+	}
+	return steps
+}
+
+// Deidentify applies the pipeline to a resource and labels it PSEUDED.
+func (d *Deidentifier) Deidentify(resource []byte) ([]byte, error) {
+	if len(resource) == 0 {
+		return resource, nil
+	}
+
+	v, err := parseOrdered(resource)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FHIR JSON: %w", err)
+	}
+	obj, ok := v.(object)
+	if !ok {
+		return nil, ErrNotAResource
+	}
+
+	obj = d.retain(obj)
+	for _, step := range d.steps {
+		switch step {
+		case DeidGeneralizeBirthDate:
+			obj.replace("birthDate", yearOnly)
+			obj.replace("deceasedDateTime", yearOnly)
+		case DeidPseudonymizeIdentifiers:
+			obj = d.pseudonymizeIdentifiers(obj)
+		}
+	}
+
+	obj = addMetaCoding(obj, "security", object{
+		{Key: "system", Value: "http://terminology.hl7.org/CodeSystem/v3-ObservationValue"},
+		{Key: "code", Value: "PSEUDED"},
+		{Key: "display", Value: "pseudonymized"},
+	})
+	return marshal(obj)
+}
+
+// deidRetained are the Patient elements a de-identified resource keeps.
+// Anything not listed, such as contained resources, extensions, links and
+// references to practitioners or organizations, is dropped, and so are all
+// primitive extensions (_birthDate and the like).
+var deidRetained = []string{
+	"resourceType", "id", "meta", "identifier", "active", "gender",
+	"birthDate", "deceasedBoolean", "deceasedDateTime", "maritalStatus",
+	"communication", "contact",
+}
+
+// deidMetaRetained are the meta elements kept; meta.source and tags may
+// name the source system.
+var deidMetaRetained = []string{"versionId", "lastUpdated", "profile", "security"}
+
+// deidContactRetained are the contact elements kept.
+var deidContactRetained = []string{"relationship", "gender", "period"}
+
+// deidStepElements are the elements removed by each removal step. They are
+// kept, on the patient and its contacts, while the step is not configured.
+var deidStepElements = map[DeidStep]string{
+	DeidRemoveNames:     "name",
+	DeidRemoveTelecom:   "telecom",
+	DeidRemoveAddress:   "address",
+	DeidRemovePhoto:     "photo",
+	DeidRemoveNarrative: "text",
+}
+
+// retain drops every element that is neither allowlisted nor governed by a
+// removal step that is switched off.
+func (d *Deidentifier) retain(obj object) object {
+	patient := append([]string(nil), deidRetained...)
+	contact := append([]string(nil), deidContactRetained...)
+	for step, element := range deidStepElements {
+		if !d.has(step) {
+			patient = append(patient, element)
+			contact = append(contact, element)
+		}
+	}
+
+	obj = obj.only(patient)
+	if v, ok := obj.get("meta"); ok {
+		if meta, ok := v.(object); ok {
+			obj.set("meta", meta.only(deidMetaRetained))
+		}
+	}
+	obj.eachContact(func(c object) object { return c.only(contact) })
+	return obj
+}
+
+func (d *Deidentifier) has(step DeidStep) bool {
+	for _, s := range d.steps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// Pseudonym returns the keyed pseudonym for an identifier.
+func (d *Deidentifier) Pseudonym(system, value string) string {
+	mac := hmac.New(sha256.New, d.key)
+	mac.Write([]byte(system + "|" + value))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+func (d *Deidentifier) pseudonymizeIdentifiers(obj object) object {
+	if id := obj.getString("id"); id != "" {
+		obj.replace("id", func(string) string { return d.Pseudonym("id", id) })
+	}
+
+	v, ok := obj.get("identifier")
+	if !ok {
+		return obj
+	}
+	identifiers, _ := v.([]interface{})
+	pseudonyms := make([]interface{}, 0, len(identifiers))
+	for _, item := range identifiers {
+		ident, ok := item.(object)
+		if !ok {
+			continue
+		}
+		pseudonyms = append(pseudonyms, object{
+			{Key: "system", Value: PseudonymSystem},
+			{Key: "value", Value: d.Pseudonym(ident.getString("system"), ident.getString("value"))},
+		})
+	}
+	obj.set("identifier", pseudonyms)
+	return obj
+}
+
+func yearOnly(date string) string {
+	if len(date) >= 4 {
+		return date[:4]
+	}
+	return date
+}
+
+// only returns the members of obj named in keys. Primitive extensions are
+// not kept.
+func (o object) only(keys []string) object {
+	result := o[:0:0]
+	for _, m := range o {
+		for _, key := range keys {
+			if m.Key == key {
+				result = append(result, m)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (o object) set(key string, value interface{}) {
+	for i := range o {
+		if o[i].Key == key {
+			o[i].Value = value
+			return
+		}
+	}
+}
+
+func (o object) replace(key string, fn func(string) string) {
+	for i := range o {
+		if s, ok := o[i].Value.(string); ok && o[i].Key == key {
+			o[i].Value = fn(s)
+		}
+	}
+}
+
+func (o object) eachContact(fn func(object) object) {
+	v, ok := o.get("contact")
+	if !ok {
+		return
+	}
+	contacts, _ := v.([]interface{})
+	for i, c := range contacts {
+		if contact, ok := c.(object); ok {
+			contacts[i] = fn(contact)
+		}
+	}
+}
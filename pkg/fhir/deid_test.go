@@ -0,0 +1,118 @@
+package fhir
+
+import (
+	"strings"
+	"testing"
+)
+
+const pseudedLabel = `{"system":"http://terminology.hl7.org/CodeSystem/v3-ObservationValue","code":"PSEUDED","display":"pseudonymized"}`
+
+var testDeidKey = []byte("test-pseudonym-key")
+
+func TestDeidentify(t *testing.T) {
+	d, err := NewDeidentifier(DefaultDeidSteps, testDeidKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	philhealth := d.Pseudonym("http://philhealth.gov.ph", "12-345678901-2")
+	mrn := d.Pseudonym("http://hospital-b.ph/mrn", "CB-MRN-5678")
+	id := d.Pseudonym("id", "b-7")
+
+	tests := []struct {
+		name     string
+		steps    []DeidStep
+		resource string
+		want     string
+	}{
+		{"identifiers pseudonymized", DefaultDeidSteps,
+			`{"resourceType":"Patient","id":"b-7","identifier":[
+				{"system":"http://philhealth.gov.ph","value":"12-345678901-2"},
+				{"system":"http://hospital-b.ph/mrn","value":"CB-MRN-5678","type":{"text":"MRN"}}]}`,
+			`{"resourceType":"Patient","id":"` + id + `","meta":{"security":[` + pseudedLabel + `]},"identifier":[
+				{"system":"` + PseudonymSystem + `","value":"` + philhealth + `"},
+				{"system":"` + PseudonymSystem + `","value":"` + mrn + `"}]}`},
+		{"direct identifiers removed", DefaultDeidSteps,
+			`{"resourceType":"Patient","gender":"female","name":[{"family":"Dela Cruz"}],"telecom":[{"value":"0917"}],
+				"address":[{"city":"Cebu"}],"photo":[{"url":"http://x/p.png"}],"text":{"status":"generated"}}`,
+			`{"resourceType":"Patient","meta":{"security":[` + pseudedLabel + `]},"gender":"female"}`},
+		{"elements not on the allowlist dropped", DefaultDeidSteps,
+			`{"resourceType":"Patient","meta":{"versionId":"2","source":"http://hospital-b.ph","tag":[{"code":"vip"}]},
+				"extension":[{"url":"http://example.ph/indigenous-group","valueString":"Igorot"}],
+				"contained":[{"resourceType":"Organization","id":"o"}],"managingOrganization":{"reference":"#o"},
+				"generalPractitioner":[{"reference":"Practitioner/p-1"}],"link":[{"other":{"reference":"Patient/x"}}],
+				"active":true,"_active":{"id":"a"}}`,
+			`{"resourceType":"Patient","meta":{"versionId":"2","security":[` + pseudedLabel + `]},"active":true}`},
+		{"contacts keep only allowlisted elements", DefaultDeidSteps,
+			`{"resourceType":"Patient","contact":[{"relationship":[{"text":"mother"}],"name":{"family":"Santos"},
+				"telecom":[{"value":"0918"}],"organization":{"reference":"Organization/o"},"gender":"female"}]}`,
+			`{"resourceType":"Patient","meta":{"security":[` + pseudedLabel + `]},"contact":[{"relationship":[{"text":"mother"}],"gender":"female"}]}`},
+		{"dates generalized to the year", DefaultDeidSteps,
+			`{"resourceType":"Patient","birthDate":"1985-03-15","deceasedDateTime":"2024-01-02T03:04:05Z"}`,
+			`{"resourceType":"Patient","meta":{"security":[` + pseudedLabel + `]},"birthDate":"1985","deceasedDateTime":"2024"}`},
+		{"elements of steps switched off kept", []DeidStep{DeidRemoveNames},
+			`{"resourceType":"Patient","id":"b-7","birthDate":"1985-03-15","name":[{"family":"Dela Cruz"}],"address":[{"city":"Cebu"}],
+				"identifier":[{"system":"http://philhealth.gov.ph","value":"12-345678901-2"}]}`,
+			`{"resourceType":"Patient","id":"b-7","meta":{"security":[` + pseudedLabel + `]},"birthDate":"1985-03-15","address":[{"city":"Cebu"}],
+				"identifier":[{"system":"http://philhealth.gov.ph","value":"12-345678901-2"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := NewDeidentifier(tt.steps, testDeidKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := d.Deidentify([]byte(tt.resource))
+			if err != nil {
+				t.Fatalf("Deidentify() error = %v", err)
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Errorf("Deidentify() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeidentifyPseudonymsAreStable(t *testing.T) {
+	resource := []byte(`{"resourceType":"Patient","id":"b-7","identifier":[{"system":"http://philhealth.gov.ph","value":"12-345678901-2"}]}`)
+	deidentify := func(key string) string {
+		t.Helper()
+		d, err := NewDeidentifier([]DeidStep{DeidPseudonymizeIdentifiers}, []byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := d.Deidentify(resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(got)
+	}
+
+	first, again, other := deidentify("key-a"), deidentify("key-a"), deidentify("key-b")
+	if first != again {
+		t.Errorf("same key gave different pseudonyms:\n%s\n%s", first, again)
+	}
+	if first == other {
+		t.Errorf("different keys gave the same pseudonyms: %s", first)
+	}
+	if strings.Contains(first, "12-345678901-2") || strings.Contains(first, `"b-7"`) {
+		t.Errorf("Deidentify() = %s, leaks the original identifiers", first)
+	}
+}
+
+func TestNewDeidentifierErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []DeidStep
+		key   []byte
+	}{
+		{"unknown step", []DeidStep{"remove-everything"}, testDeidKey},
+		{"pseudonyms without a key", []DeidStep{DeidPseudonymizeIdentifiers}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewDeidentifier(tt.steps, tt.key); err == nil {
+				t.Error("NewDeidentifier() error = nil, want an error")
+			}
+		})
+	}
+}
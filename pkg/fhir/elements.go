@@ -0,0 +1,98 @@
+package fhir
+
+import (
+	"fmt"
+	"strings"
+)
+
+// alwaysIncluded are kept regardless of the requested elements, following
+// the FHIR _elements rules for mandatory and modifier elements.
+var alwaysIncluded = map[string]bool{
+	"resourceType":      true,
+	"id":                true,
+	"meta":              true,
+	"implicitRules":     true,
+	"modifierExtension": true,
+}
+
+// FilterElements keeps only the listed top-level elements of a resource, like
+// the FHIR _elements parameter. Choice elements match on their base name, so
+// "deceased" keeps deceasedBoolean or deceasedDateTime. The result is tagged
+// SUBSETTED. An empty list returns the resource unchanged.
+func FilterElements(resource []byte, elements []string) ([]byte, error) {
+	if len(elements) == 0 || len(resource) == 0 {
+		return resource, nil
+	}
+
+	v, err := parseOrdered(resource)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FHIR JSON: %w", err)
+	}
+	obj, ok := v.(object)
+	if !ok {
+		return nil, ErrNotAResource
+	}
+
+	var filtered object
+	for _, m := range obj {
+		name := strings.TrimPrefix(m.Key, "_")
+		if alwaysIncluded[name] || elementRequested(name, elements) {
+			filtered = append(filtered, m)
+		}
+	}
+
+	return marshal(tagSubsetted(filtered))
+}
+
+func elementRequested(name string, elements []string) bool {
+	for _, e := range elements {
+		if name == e {
+			return true
+		}
+		// Choice type: "deceased" matches "deceasedBoolean".
+		if strings.HasPrefix(name, e) && len(name) > len(e) && name[len(e)] >= 'A' && name[len(e)] <= 'Z' {
+			return true
+		}
+	}
+	return false
+}
+
+// tagSubsetted adds the SUBSETTED tag required on filtered resources.
+func tagSubsetted(obj object) object {
+	return addMetaCoding(obj, "tag", object{
+		{Key: "system", Value: "http://terminology.hl7.org/CodeSystem/v3-ObservationValue"},
+		{Key: "code", Value: "SUBSETTED"},
+		{Key: "display", Value: "subsetted"},
+	})
+}
+
+// addMetaCoding appends a coding to meta.tag or meta.security, creating
+// meta if needed.
+func addMetaCoding(obj object, field string, coding object) object {
+	for i, m := range obj {
+		if m.Key != "meta" {
+			continue
+		}
+		meta, ok := m.Value.(object)
+		if !ok {
+			return obj
+		}
+		for j, mm := range meta {
+			if mm.Key == field {
+				codings, _ := mm.Value.([]interface{})
+				meta[j].Value = append(codings, coding)
+				return obj
+			}
+		}
+		obj[i].Value = append(meta, member{Key: field, Value: []interface{}{coding}})
+		return obj
+	}
+
+	// meta follows resourceType and id.
+	insertAt := 0
+	for insertAt < len(obj) && (obj[insertAt].Key == "resourceType" || obj[insertAt].Key == "id") {
+		insertAt++
+	}
+	meta := member{Key: "meta", Value: object{{Key: field, Value: []interface{}{coding}}}}
+	return append(obj[:insertAt], append(object{meta}, obj[insertAt:]...)...)
+}
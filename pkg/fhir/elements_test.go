@@ -0,0 +1,80 @@
+package fhir
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const subsettedTag = `{"system":"http://terminology.hl7.org/CodeSystem/v3-ObservationValue","code":"SUBSETTED","display":"subsetted"}`
+
+func TestFilterElements(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+		elements []string
+		want     string
+	}{
+		{"requested elements kept",
+			`{"resourceType":"Patient","id":"b-7","gender":"male","birthDate":"1985-03-15","address":[{"city":"Cebu"}]}`,
+			[]string{"gender", "birthDate"},
+			`{"resourceType":"Patient","id":"b-7","meta":{"tag":[` + subsettedTag + `]},"gender":"male","birthDate":"1985-03-15"}`},
+		{"mandatory and modifier elements kept",
+			`{"resourceType":"Patient","id":"b-7","meta":{"versionId":"3"},"implicitRules":"http://example.ph/rules",
+				"modifierExtension":[{"url":"http://example.ph/m","valueBoolean":true}],"name":[{"family":"Dela Cruz"}]}`,
+			[]string{"gender"},
+			`{"resourceType":"Patient","id":"b-7","meta":{"versionId":"3","tag":[` + subsettedTag + `]},"implicitRules":"http://example.ph/rules",
+				"modifierExtension":[{"url":"http://example.ph/m","valueBoolean":true}]}`},
+		{"tag added to existing tags",
+			`{"resourceType":"Patient","meta":{"tag":[{"code":"test"}]},"gender":"male"}`,
+			[]string{"gender"},
+			`{"resourceType":"Patient","meta":{"tag":[{"code":"test"},` + subsettedTag + `]},"gender":"male"}`},
+		{"choice element matched on its base name",
+			`{"resourceType":"Patient","deceasedBoolean":false,"deceasedNote":"x","gender":"male"}`,
+			[]string{"deceased"},
+			`{"resourceType":"Patient","meta":{"tag":[` + subsettedTag + `]},"deceasedBoolean":false,"deceasedNote":"x"}`},
+		{"longer name that is not a choice type not matched",
+			`{"resourceType":"Patient","active":true,"activeness":"x"}`,
+			[]string{"active"},
+			`{"resourceType":"Patient","meta":{"tag":[` + subsettedTag + `]},"active":true}`},
+		{"primitive extension kept with its element",
+			`{"resourceType":"Patient","birthDate":"1985-03-15","_birthDate":{"id":"bd"},"gender":"male"}`,
+			[]string{"birthDate"},
+			`{"resourceType":"Patient","meta":{"tag":[` + subsettedTag + `]},"birthDate":"1985-03-15","_birthDate":{"id":"bd"}}`},
+		{"no elements leaves the resource alone",
+			`{"resourceType":"Patient","gender":"male"}`,
+			nil,
+			`{"resourceType":"Patient","gender":"male"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FilterElements([]byte(tt.resource), tt.elements)
+			if err != nil {
+				t.Fatalf("FilterElements() error = %v", err)
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Errorf("FilterElements() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterElementsKeepsOrder(t *testing.T) {
+	got, err := FilterElements([]byte(`{"resourceType":"Patient","id":"b-7","gender":"male","active":true}`), []string{"active", "gender"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"resourceType":"Patient","id":"b-7","meta":{"tag":[` + subsettedTag + `]},"gender":"male","active":true}`
+	if string(got) != want {
+		t.Errorf("FilterElements() = %s, want %s", got, want)
+	}
+}
+
+func TestFilterElementsRejectsNonResources(t *testing.T) {
+	if _, err := FilterElements([]byte(`["Patient"]`), []string{"id"}); !errors.Is(err, ErrNotAResource) {
+		t.Errorf("FilterElements() error = %v, want ErrNotAResource", err)
+	}
+	if _, err := FilterElements(json.RawMessage(`{"resourceType":`), []string{"id"}); err == nil {
+		t.Error("FilterElements() of invalid JSON error = nil, want an error")
+	}
+}
@@ -0,0 +1,77 @@
+package fhir
+
+import "encoding/json"
+
+// ResourceIdentifiers returns the identifiers of a resource such as Patient.
+// Malformed input yields no identifiers.
+func ResourceIdentifiers(resource []byte) []Identifier {
+	var r struct {
+		Identifier []Identifier `json:"identifier"`
+	}
+	if err := json.Unmarshal(resource, &r); err != nil {
+		return nil
+	}
+	return r.Identifier
+}
+
+// ResourceID returns the logical id of a resource, or "" if it has none.
+func ResourceID(resource []byte) string {
+	var r struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(resource, &r); err != nil {
+		return ""
+	}
+	return r.ID
+}
+
+// ExtMothersFamily carries the mother's family name, which Filipino names
+// use as the middle name.
+const ExtMothersFamily = "http://hl7.org/fhir/StructureDefinition/humanname-mothers-family"
+
+// PatientDetails are the elements of a Patient used for matching.
+type PatientDetails struct {
+	Name      *HumanName
+	BirthDate string
+	Gender    string
+}
+
+// MothersFamily returns the mother's family name from the name or its
+// family element.
+func (n *HumanName) MothersFamily() string {
+	extensions := n.Extension
+	if n.FamilyElement != nil {
+		extensions = append(extensions, n.FamilyElement.Extension...)
+	}
+	for _, ext := range extensions {
+		if ext.URL == ExtMothersFamily {
+			return ext.ValueString
+		}
+	}
+	return ""
+}
+
+// ParsePatientDetails extracts the preferred name (official, then usual,
+// then the first), birthDate and gender of a Patient. Malformed input
+// yields empty details.
+func ParsePatientDetails(resource []byte) PatientDetails {
+	var p struct {
+		Name      []HumanName `json:"name"`
+		BirthDate string      `json:"birthDate"`
+		Gender    string      `json:"gender"`
+	}
+	if err := json.Unmarshal(resource, &p); err != nil {
+		return PatientDetails{}
+	}
+
+	details := PatientDetails{BirthDate: p.BirthDate, Gender: p.Gender}
+	for _, use := range []string{"official", "usual", ""} {
+		for i := range p.Name {
+			if use == "" || p.Name[i].Use == use {
+				details.Name = &p.Name[i]
+				return details
+			}
+		}
+	}
+	return details
+}
@@ -0,0 +1,345 @@
+package fhir
+
+import "encoding/json"
+
+// Version is the FHIR release the gateway speaks natively.
+const Version = VersionR4
+
+// MediaTypeJSON is the FHIR JSON media type.
+const MediaTypeJSON = "application/fhir+json"
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type Identifier struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type Reference struct {
+	Reference  string      `json:"reference,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Identifier *Identifier `json:"identifier,omitempty"`
+	Display    string      `json:"display,omitempty"`
+}
+
+type HumanName struct {
+	Use       string      `json:"use,omitempty"`
+	Text      string      `json:"text,omitempty"`
+	Family    string      `json:"family,omitempty"`
+	Given     []string    `json:"given,omitempty"`
+	Suffix    []string    `json:"suffix,omitempty"`
+	Extension []Extension `json:"extension,omitempty"`
+	// FamilyElement holds extensions on the family primitive.
+	FamilyElement *Element `json:"_family,omitempty"`
+}
+
+// Element carries the extensions of a primitive value.
+type Element struct {
+	Extension []Extension `json:"extension,omitempty"`
+}
+
+type Annotation struct {
+	Text string `json:"text"`
+}
+
+type Meta struct {
+	LastUpdated string   `json:"lastUpdated,omitempty"`
+	Profile     []string `json:"profile,omitempty"`
+	Security    []Coding `json:"security,omitempty"`
+}
+
+// OperationOutcome reports errors and warnings from FHIR interactions.
+type OperationOutcome struct {
+	ResourceType string                  `json:"resourceType"`
+	Issue        []OperationOutcomeIssue `json:"issue"`
+}
+
+type OperationOutcomeIssue struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics,omitempty"`
+}
+
+func NewOperationOutcome(severity, code, diagnostics string) *OperationOutcome {
+	return &OperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue: []OperationOutcomeIssue{{
+			Severity:    severity,
+			Code:        code,
+			Diagnostics: diagnostics,
+		}},
+	}
+}
+
+// Parameters is the input and output resource of FHIR operations.
+type Parameters struct {
+	ResourceType string      `json:"resourceType"`
+	Parameter    []Parameter `json:"parameter,omitempty"`
+}
+
+type Parameter struct {
+	Name            string      `json:"name"`
+	ValueString     string      `json:"valueString,omitempty"`
+	ValueCode       string      `json:"valueCode,omitempty"`
+	ValueIdentifier *Identifier `json:"valueIdentifier,omitempty"`
+	ValueReference  *Reference  `json:"valueReference,omitempty"`
+}
+
+// Get returns all parameters with the given name.
+func (p *Parameters) Get(name string) []Parameter {
+	var result []Parameter
+	for _, param := range p.Parameter {
+		if param.Name == name {
+			result = append(result, param)
+		}
+	}
+	return result
+}
+
+// GetString returns the first string-like value of the named parameter.
+func (p *Parameters) GetString(name string) string {
+	for _, param := range p.Get(name) {
+		switch {
+		case param.ValueString != "":
+			return param.ValueString
+		case param.ValueCode != "":
+			return param.ValueCode
+		case param.ValueIdentifier != nil:
+			return param.ValueIdentifier.Value
+		case param.ValueReference != nil && param.ValueReference.Identifier != nil:
+			return param.ValueReference.Identifier.Value
+		}
+	}
+	return ""
+}
+
+// Task tracks a unit of work, here a patient data exchange.
+type Task struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id,omitempty"`
+	Meta         *Meta             `json:"meta,omitempty"`
+	Contained    []json.RawMessage `json:"contained,omitempty"`
+	Identifier   []Identifier      `json:"identifier,omitempty"`
+	Status       string            `json:"status"`
+	StatusReason *CodeableConcept  `json:"statusReason,omitempty"`
+	Intent       string            `json:"intent"`
+	Priority     string            `json:"priority,omitempty"`
+	Code         *CodeableConcept  `json:"code,omitempty"`
+	AuthoredOn   string            `json:"authoredOn,omitempty"`
+	LastModified string            `json:"lastModified,omitempty"`
+	Requester    *Reference        `json:"requester,omitempty"`
+	Owner        *Reference        `json:"owner,omitempty"`
+	ReasonCode   *CodeableConcept  `json:"reasonCode,omitempty"`
+	Note         []Annotation      `json:"note,omitempty"`
+	Input        []TaskParameter   `json:"input,omitempty"`
+	Output       []TaskParameter   `json:"output,omitempty"`
+}
+
+type TaskParameter struct {
+	Type            CodeableConcept `json:"type"`
+	ValueString     string          `json:"valueString,omitempty"`
+	ValueCode       string          `json:"valueCode,omitempty"`
+	ValueIdentifier *Identifier     `json:"valueIdentifier,omitempty"`
+	ValueReference  *Reference      `json:"valueReference,omitempty"`
+}
+
+// Bundle is a collection of resources, used here for search results.
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Total        int           `json:"total"`
+	Link         []BundleLink  `json:"link,omitempty"`
+	Entry        []BundleEntry `json:"entry,omitempty"`
+}
+
+type BundleLink struct {
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+type BundleEntry struct {
+	FullURL  string             `json:"fullUrl,omitempty"`
+	Resource interface{}        `json:"resource"`
+	Search   *BundleEntrySearch `json:"search,omitempty"`
+}
+
+type BundleEntrySearch struct {
+	Mode string `json:"mode"`
+}
+
+// NewSearchBundle wraps resources in a searchset Bundle.
+func NewSearchBundle(resources []interface{}) *Bundle {
+	bundle := &Bundle{ResourceType: "Bundle", Type: "searchset", Total: len(resources)}
+	for _, r := range resources {
+		bundle.Entry = append(bundle.Entry, BundleEntry{
+			Resource: r,
+			Search:   &BundleEntrySearch{Mode: "match"},
+		})
+	}
+	return bundle
+}
+
+// Include adds resources referenced by the matches to a searchset Bundle.
+func (b *Bundle) Include(resources []interface{}) {
+	for _, r := range resources {
+		b.Entry = append(b.Entry, BundleEntry{
+			Resource: r,
+			Search:   &BundleEntrySearch{Mode: "include"},
+		})
+	}
+}
+
+// CapabilityStatement describes the FHIR interactions a server supports.
+type CapabilityStatement struct {
+	ResourceType string                    `json:"resourceType"`
+	Status       string                    `json:"status"`
+	Date         string                    `json:"date"`
+	Kind         string                    `json:"kind"`
+	Software     *CapabilitySoftware       `json:"software,omitempty"`
+	FHIRVersion  string                    `json:"fhirVersion"`
+	Format       []string                  `json:"format"`
+	Rest         []CapabilityStatementRest `json:"rest"`
+}
+
+type CapabilitySoftware struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type CapabilityStatementRest struct {
+	Mode     string               `json:"mode"`
+	Resource []CapabilityResource `json:"resource,omitempty"`
+}
+
+type CapabilityResource struct {
+	Type        string                `json:"type"`
+	Interaction []CapabilityCode      `json:"interaction,omitempty"`
+	SearchParam []CapabilitySearch    `json:"searchParam,omitempty"`
+	Operation   []CapabilityOperation `json:"operation,omitempty"`
+}
+
+type CapabilityCode struct {
+	Code string `json:"code"`
+}
+
+type CapabilitySearch struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type CapabilityOperation struct {
+	Name          string `json:"name"`
+	Definition    string `json:"definition"`
+	Documentation string `json:"documentation,omitempty"`
+}
+
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// Consent records a patient's decision to permit or deny data sharing.
+type Consent struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id,omitempty"`
+	Status       string            `json:"status"`
+	Scope        *CodeableConcept  `json:"scope,omitempty"`
+	Category     []CodeableConcept `json:"category,omitempty"`
+	Patient      *Reference        `json:"patient,omitempty"`
+	DateTime     string            `json:"dateTime,omitempty"`
+	Organization []Reference       `json:"organization,omitempty"`
+	Provision    *ConsentProvision `json:"provision,omitempty"`
+}
+
+type ConsentProvision struct {
+	Type    string         `json:"type,omitempty"`
+	Period  *Period        `json:"period,omitempty"`
+	Actor   []ConsentActor `json:"actor,omitempty"`
+	Purpose []Coding       `json:"purpose,omitempty"`
+}
+
+type ConsentActor struct {
+	Role      CodeableConcept `json:"role"`
+	Reference Reference       `json:"reference"`
+}
+
+type Extension struct {
+	URL         string `json:"url"`
+	ValueString string `json:"valueString,omitempty"`
+}
+
+// AuditEvent records a security relevant event such as a disclosure of PHI.
+type AuditEvent struct {
+	ResourceType string             `json:"resourceType"`
+	ID           string             `json:"id,omitempty"`
+	Extension    []Extension        `json:"extension,omitempty"`
+	Type         Coding             `json:"type"`
+	Subtype      []Coding           `json:"subtype,omitempty"`
+	Action       string             `json:"action,omitempty"`
+	Recorded     string             `json:"recorded"`
+	Outcome      string             `json:"outcome,omitempty"`
+	OutcomeDesc  string             `json:"outcomeDesc,omitempty"`
+	Agent        []AuditEventAgent  `json:"agent"`
+	Source       AuditEventSource   `json:"source"`
+	Entity       []AuditEventEntity `json:"entity,omitempty"`
+}
+
+type AuditEventAgent struct {
+	Type      *CodeableConcept `json:"type,omitempty"`
+	Who       *Reference       `json:"who,omitempty"`
+	Requestor bool             `json:"requestor"`
+}
+
+type AuditEventSource struct {
+	Observer Reference `json:"observer"`
+	Type     []Coding  `json:"type,omitempty"`
+}
+
+type AuditEventEntity struct {
+	What        *Reference `json:"what,omitempty"`
+	Type        *Coding    `json:"type,omitempty"`
+	Role        *Coding    `json:"role,omitempty"`
+	Description string     `json:"description,omitempty"`
+}
+
+// Organization is a provider in the directory.
+type Organization struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id,omitempty"`
+	Meta         *Meta             `json:"meta,omitempty"`
+	Identifier   []Identifier      `json:"identifier,omitempty"`
+	Active       bool              `json:"active"`
+	Type         []CodeableConcept `json:"type,omitempty"`
+	Name         string            `json:"name"`
+	Address      []Address         `json:"address,omitempty"`
+	Endpoint     []Reference       `json:"endpoint,omitempty"`
+}
+
+type Address struct {
+	City     string `json:"city,omitempty"`
+	District string `json:"district,omitempty"`
+	State    string `json:"state,omitempty"`
+}
+
+// Endpoint is a technical address at which a provider is reached.
+type Endpoint struct {
+	ResourceType         string            `json:"resourceType"`
+	ID                   string            `json:"id,omitempty"`
+	Meta                 *Meta             `json:"meta,omitempty"`
+	Status               string            `json:"status"`
+	ConnectionType       Coding            `json:"connectionType"`
+	Name                 string            `json:"name,omitempty"`
+	ManagingOrganization *Reference        `json:"managingOrganization,omitempty"`
+	PayloadType          []CodeableConcept `json:"payloadType"`
+	PayloadMimeType      []string          `json:"payloadMimeType,omitempty"`
+	Address              string            `json:"address"`
+}
@@ -0,0 +1,190 @@
+package fhir
+
+// element describes a single child element of a FHIR type: its datatype
+// and whether it repeats (serialized as a JSON array).
+type element struct {
+	Type string
+	Many bool
+}
+
+// typeSchema is a minimal structure definition covering the Patient resource
+// and the datatypes it uses. It is only consulted where JSON and XML disagree
+// on shape: array vs. single value, primitive JSON kind and attribute placement.
+// Elements that are not listed fall back to shape inference from the document.
+var typeSchema = map[string]map[string]element{
+	"Patient": {
+		"id":                   {"id", false},
+		"meta":                 {"Meta", false},
+		"implicitRules":        {"uri", false},
+		"language":             {"code", false},
+		"text":                 {"Narrative", false},
+		"contained":            {"Resource", true},
+		"extension":            {"Extension", true},
+		"modifierExtension":    {"Extension", true},
+		"identifier":           {"Identifier", true},
+		"active":               {"boolean", false},
+		"name":                 {"HumanName", true},
+		"telecom":              {"ContactPoint", true},
+		"gender":               {"code", false},
+		"birthDate":            {"date", false},
+		"deceasedBoolean":      {"boolean", false},
+		"deceasedDateTime":     {"dateTime", false},
+		"address":              {"Address", true},
+		"maritalStatus":        {"CodeableConcept", false},
+		"multipleBirthBoolean": {"boolean", false},
+		"multipleBirthInteger": {"integer", false},
+		"photo":                {"Attachment", true},
+		"contact":              {"PatientContact", true},
+		"communication":        {"PatientCommunication", true},
+		"generalPractitioner":  {"Reference", true},
+		"managingOrganization": {"Reference", false},
+		"link":                 {"PatientLink", true},
+	},
+	"PatientContact": {
+		"relationship": {"CodeableConcept", true},
+		"name":         {"HumanName", false},
+		"telecom":      {"ContactPoint", true},
+		"address":      {"Address", false},
+		"gender":       {"code", false},
+		"organization": {"Reference", false},
+		"period":       {"Period", false},
+	},
+	"PatientCommunication": {
+		"language":  {"CodeableConcept", false},
+		"preferred": {"boolean", false},
+	},
+	"PatientLink": {
+		"other": {"Reference", false},
+		"type":  {"code", false},
+	},
+	"Identifier": {
+		"use":      {"code", false},
+		"type":     {"CodeableConcept", false},
+		"system":   {"uri", false},
+		"value":    {"string", false},
+		"period":   {"Period", false},
+		"assigner": {"Reference", false},
+	},
+	"HumanName": {
+		"use":    {"code", false},
+		"text":   {"string", false},
+		"family": {"string", false},
+		"given":  {"string", true},
+		"prefix": {"string", true},
+		"suffix": {"string", true},
+		"period": {"Period", false},
+	},
+	"ContactPoint": {
+		"system": {"code", false},
+		"value":  {"string", false},
+		"use":    {"code", false},
+		"rank":   {"positiveInt", false},
+		"period": {"Period", false},
+	},
+	"Address": {
+		"use":        {"code", false},
+		"type":       {"code", false},
+		"text":       {"string", false},
+		"line":       {"string", true},
+		"city":       {"string", false},
+		"district":   {"string", false},
+		"state":      {"string", false},
+		"postalCode": {"string", false},
+		"country":    {"string", false},
+		"period":     {"Period", false},
+	},
+	"CodeableConcept": {
+		"coding": {"Coding", true},
+		"text":   {"string", false},
+	},
+	"Coding": {
+		"system":       {"uri", false},
+		"version":      {"string", false},
+		"code":         {"code", false},
+		"display":      {"string", false},
+		"userSelected": {"boolean", false},
+	},
+	"Reference": {
+		"reference":  {"string", false},
+		"type":       {"uri", false},
+		"identifier": {"Identifier", false},
+		"display":    {"string", false},
+	},
+	"Period": {
+		"start": {"dateTime", false},
+		"end":   {"dateTime", false},
+	},
+	"Attachment": {
+		"contentType": {"code", false},
+		"language":    {"code", false},
+		"data":        {"base64Binary", false},
+		"url":         {"url", false},
+		"size":        {"unsignedInt", false},
+		"hash":        {"base64Binary", false},
+		"title":       {"string", false},
+		"creation":    {"dateTime", false},
+	},
+	"Meta": {
+		"versionId":   {"id", false},
+		"lastUpdated": {"instant", false},
+		"source":      {"uri", false},
+		"profile":     {"canonical", true},
+		"security":    {"Coding", true},
+		"tag":         {"Coding", true},
+	},
+	"Narrative": {
+		"status": {"code", false},
+		"div":    {"xhtml", false},
+	},
+	"Extension": {
+		"valueBoolean":         {"boolean", false},
+		"valueInteger":         {"integer", false},
+		"valueDecimal":         {"decimal", false},
+		"valuePositiveInt":     {"positiveInt", false},
+		"valueUnsignedInt":     {"unsignedInt", false},
+		"valueString":          {"string", false},
+		"valueCode":            {"code", false},
+		"valueUri":             {"uri", false},
+		"valueDate":            {"date", false},
+		"valueDateTime":        {"dateTime", false},
+		"valueCoding":          {"Coding", false},
+		"valueCodeableConcept": {"CodeableConcept", false},
+		"valueIdentifier":      {"Identifier", false},
+		"valueReference":       {"Reference", false},
+		"valueAddress":         {"Address", false},
+		"valueHumanName":       {"HumanName", false},
+		"valuePeriod":          {"Period", false},
+	},
+}
+
+// commonElements apply to every complex datatype and backbone element.
+var commonElements = map[string]element{
+	"extension":         {"Extension", true},
+	"modifierExtension": {"Extension", true},
+}
+
+// lookup returns the schema entry for a child element of the given type.
+// The boolean result is false when the element is not described.
+func lookup(typeName, name string) (element, bool) {
+	if fields, ok := typeSchema[typeName]; ok {
+		if e, ok := fields[name]; ok {
+			return e, true
+		}
+	}
+	if e, ok := commonElements[name]; ok {
+		return e, true
+	}
+	return element{}, false
+}
+
+// jsonKind reports how a primitive FHIR type is represented in JSON.
+func jsonKind(primitive string) string {
+	switch primitive {
+	case "boolean":
+		return "boolean"
+	case "integer", "positiveInt", "unsignedInt", "decimal":
+		return "number"
+	default:
+		return "string"
+	}
+}
@@ -0,0 +1,155 @@
+package fhir
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Supported FHIR releases.
+const (
+	VersionR4  = "4.0.1"
+	VersionR4B = "4.3.0"
+	VersionR5  = "5.0.0"
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported FHIR version")
+	ErrConversion         = errors.New("FHIR version conversion not supported")
+)
+
+// Cross-version extensions carry R5-only Patient.contact elements in R4.
+const (
+	extContactAdditionalName    = "http://hl7.org/fhir/5.0/StructureDefinition/extension-Patient.contact.additionalName"
+	extContactAdditionalAddress = "http://hl7.org/fhir/5.0/StructureDefinition/extension-Patient.contact.additionalAddress"
+)
+
+// NormalizeVersion maps release names ("R4"), major.minor ("4.0") and full
+// versions ("4.0.1") onto the full version string.
+func NormalizeVersion(version string) (string, bool) {
+	switch strings.ToUpper(strings.TrimSpace(version)) {
+	case "R4", "4.0", "4.0.1":
+		return VersionR4, true
+	case "R4B", "4.3", "4.3.0":
+		return VersionR4B, true
+	case "R5", "5.0", "5.0.0":
+		return VersionR5, true
+	default:
+		return "", false
+	}
+}
+
+// CanConvert reports whether ConvertResource converts a resource of the
+// given type between two releases.
+func CanConvert(resourceType, from, to string) bool {
+	from, okFrom := NormalizeVersion(from)
+	to, okTo := NormalizeVersion(to)
+	return okFrom && okTo && (from == to || resourceType == "Patient")
+}
+
+// ConvertResource converts a resource between FHIR releases. Only Patient is
+// supported across major releases; R4 and R4B are identical for Patient.
+func ConvertResource(resource json.RawMessage, from, to string) (json.RawMessage, error) {
+	from, okFrom := NormalizeVersion(from)
+	to, okTo := NormalizeVersion(to)
+	if !okFrom || !okTo {
+		return nil, ErrUnsupportedVersion
+	}
+	if from == to {
+		return resource, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(resource))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("invalid FHIR JSON: %w", err)
+	}
+	if obj["resourceType"] != "Patient" {
+		return nil, fmt.Errorf("%w: %v from %s to %s", ErrConversion, obj["resourceType"], from, to)
+	}
+
+	fromR5, toR5 := from == VersionR5, to == VersionR5
+	switch {
+	case fromR5 == toR5:
+		return resource, nil
+	case toR5:
+		patientR4ToR5(obj)
+	default:
+		patientR5ToR4(obj)
+	}
+	return json.Marshal(obj)
+}
+
+func patientR4ToR5(patient map[string]interface{}) {
+	for _, photo := range objects(patient["photo"]) {
+		// Attachment.size became integer64, which FHIR JSON encodes as a string.
+		if size, ok := photo["size"].(json.Number); ok {
+			photo["size"] = size.String()
+		}
+	}
+
+	for _, contact := range objects(patient["contact"]) {
+		var kept []interface{}
+		for _, ext := range objects(contact["extension"]) {
+			switch ext["url"] {
+			case extContactAdditionalName:
+				contact["additionalName"] = append(asSlice(contact["additionalName"]), ext["valueHumanName"])
+			case extContactAdditionalAddress:
+				contact["additionalAddress"] = append(asSlice(contact["additionalAddress"]), ext["valueAddress"])
+			default:
+				kept = append(kept, ext)
+			}
+		}
+		setOrDelete(contact, "extension", kept)
+	}
+}
+
+func patientR5ToR4(patient map[string]interface{}) {
+	for _, photo := range objects(patient["photo"]) {
+		if size, ok := photo["size"].(string); ok {
+			photo["size"] = json.Number(size)
+		}
+		for _, key := range []string{"height", "width", "frames", "duration", "pages"} {
+			delete(photo, key)
+		}
+	}
+
+	for _, contact := range objects(patient["contact"]) {
+		extensions := asSlice(contact["extension"])
+		for _, name := range asSlice(contact["additionalName"]) {
+			extensions = append(extensions, map[string]interface{}{"url": extContactAdditionalName, "valueHumanName": name})
+		}
+		for _, addr := range asSlice(contact["additionalAddress"]) {
+			extensions = append(extensions, map[string]interface{}{"url": extContactAdditionalAddress, "valueAddress": addr})
+		}
+		delete(contact, "additionalName")
+		delete(contact, "additionalAddress")
+		setOrDelete(contact, "extension", extensions)
+	}
+}
+
+func asSlice(v interface{}) []interface{} {
+	s, _ := v.([]interface{})
+	return s
+}
+
+func objects(v interface{}) []map[string]interface{} {
+	var result []map[string]interface{}
+	for _, item := range asSlice(v) {
+		if obj, ok := item.(map[string]interface{}); ok {
+			result = append(result, obj)
+		}
+	}
+	return result
+}
+
+func setOrDelete(obj map[string]interface{}, key string, values []interface{}) {
+	if len(values) == 0 {
+		delete(obj, key)
+		return
+	}
+	obj[key] = values
+}
@@ -0,0 +1,111 @@
+package fhir
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// jsonEqual reports whether two JSON documents hold the same values.
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var x, y interface{}
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func TestConvertResource(t *testing.T) {
+	const (
+		r4Contact = `{"resourceType":"Patient","contact":[{"name":{"family":"Santos"},"extension":[
+			{"url":"http://example.ph/relationship-note","valueString":"aunt"},
+			{"url":"` + extContactAdditionalName + `","valueHumanName":{"family":"Reyes"}},
+			{"url":"` + extContactAdditionalAddress + `","valueAddress":{"city":"Cebu"}}]}]}`
+		r5Contact = `{"resourceType":"Patient","contact":[{"name":{"family":"Santos"},
+			"extension":[{"url":"http://example.ph/relationship-note","valueString":"aunt"}],
+			"additionalName":[{"family":"Reyes"}],
+			"additionalAddress":[{"city":"Cebu"}]}]}`
+	)
+
+	tests := []struct {
+		name     string
+		from, to string
+		resource string
+		want     string
+	}{
+		{"R4 photo size to R5 integer64", "R4", "R5",
+			`{"resourceType":"Patient","photo":[{"contentType":"image/png","size":20480}]}`,
+			`{"resourceType":"Patient","photo":[{"contentType":"image/png","size":"20480"}]}`},
+		{"R5 photo size to R4 unsignedInt", "R5", "R4",
+			`{"resourceType":"Patient","photo":[{"contentType":"image/png","size":"20480"}]}`,
+			`{"resourceType":"Patient","photo":[{"contentType":"image/png","size":20480}]}`},
+		{"R5-only photo elements dropped in R4", "R5", "R4",
+			`{"resourceType":"Patient","photo":[{"contentType":"image/png","height":480,"width":640,"frames":1,"duration":0,"pages":1}]}`,
+			`{"resourceType":"Patient","photo":[{"contentType":"image/png"}]}`},
+		{"R4 contact extensions to R5 elements", "R4", "R5", r4Contact, r5Contact},
+		{"R5 contact elements to R4 extensions", "R5", "R4", r5Contact, r4Contact},
+		{"R4 and R4B are the same for Patient", "R4", "R4B",
+			`{"resourceType":"Patient","photo":[{"size":20480}]}`,
+			`{"resourceType":"Patient","photo":[{"size":20480}]}`},
+		{"R4B converts like R4", "4.3.0", "5.0",
+			`{"resourceType":"Patient","photo":[{"size":20480}]}`,
+			`{"resourceType":"Patient","photo":[{"size":"20480"}]}`},
+		{"same release leaves any resource alone", "R5", "5.0.0",
+			`{"resourceType":"Observation","status":"final"}`,
+			`{"resourceType":"Observation","status":"final"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConvertResource(json.RawMessage(tt.resource), tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("ConvertResource() error = %v", err)
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Errorf("ConvertResource() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertResourceRoundTrip(t *testing.T) {
+	resource := `{"resourceType":"Patient","id":"b-7","photo":[{"size":1024}],"contact":[{"extension":[
+		{"url":"` + extContactAdditionalName + `","valueHumanName":{"family":"Reyes"}}]}]}`
+
+	r5, err := ConvertResource(json.RawMessage(resource), VersionR4, VersionR5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r4, err := ConvertResource(r5, VersionR5, VersionR4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !jsonEqual(t, r4, []byte(resource)) {
+		t.Errorf("R4 -> R5 -> R4 = %s, want %s", r4, resource)
+	}
+}
+
+func TestConvertResourceErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		resource string
+		wantErr  error
+	}{
+		{"unknown source release", "R3", "R4", `{"resourceType":"Patient"}`, ErrUnsupportedVersion},
+		{"unknown target release", "R4", "6.0.0", `{"resourceType":"Patient"}`, ErrUnsupportedVersion},
+		{"resource other than Patient", "R4", "R5", `{"resourceType":"Observation"}`, ErrConversion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ConvertResource(json.RawMessage(tt.resource), tt.from, tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ConvertResource() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
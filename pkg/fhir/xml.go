@@ -0,0 +1,480 @@
+package fhir
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Namespace is the XML namespace of all FHIR elements.
+const Namespace = "http://hl7.org/fhir"
+
+const xhtmlNamespace = "http://www.w3.org/1999/xhtml"
+
+var ErrNotAResource = errors.New("document is not a FHIR resource")
+
+// JSONToXML converts a FHIR resource from its JSON representation to XML.
+func JSONToXML(data json.RawMessage) ([]byte, error) {
+	v, err := parseOrdered(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FHIR JSON: %w", err)
+	}
+	obj, ok := v.(object)
+	if !ok || obj.getString("resourceType") == "" {
+		return nil, ErrNotAResource
+	}
+
+	var buf bytes.Buffer
+	if err := writeResource(&buf, obj, true); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeResource(buf *bytes.Buffer, obj object, root bool) error {
+	resourceType := obj.getString("resourceType")
+	if resourceType == "" {
+		return ErrNotAResource
+	}
+	if !isName(resourceType) {
+		return fmt.Errorf("invalid resourceType %q", resourceType)
+	}
+
+	buf.WriteString("<" + resourceType)
+	if root {
+		buf.WriteString(` xmlns="` + Namespace + `"`)
+	}
+	buf.WriteString(">")
+	if err := writeChildren(buf, resourceType, obj, true); err != nil {
+		return err
+	}
+	buf.WriteString("</" + resourceType + ">")
+	return nil
+}
+
+// writeChildren writes the members of obj as child elements. For datatypes
+// the id (and url for extensions) are attributes and are skipped here.
+func writeChildren(buf *bytes.Buffer, typeName string, obj object, isResource bool) error {
+	extensions := map[string]interface{}{}
+	for _, m := range obj {
+		if strings.HasPrefix(m.Key, "_") {
+			extensions[m.Key[1:]] = m.Value
+		}
+	}
+
+	written := map[string]bool{}
+	for _, m := range obj {
+		key := m.Key
+		if strings.HasPrefix(key, "_") {
+			// A primitive extension without a value still produces an element.
+			key = key[1:]
+			if _, hasValue := obj.get(key); hasValue {
+				continue
+			}
+		}
+		if written[key] || key == "resourceType" {
+			continue
+		}
+		if !isResource && isAttribute(typeName, key) {
+			continue
+		}
+		written[key] = true
+
+		value, _ := obj.get(key)
+		ext := extensions[key]
+		elem, _ := lookup(typeName, key)
+
+		values, isArray := value.([]interface{})
+		if !isArray {
+			values = []interface{}{value}
+		}
+		exts, _ := ext.([]interface{})
+		for i, v := range values {
+			var e interface{}
+			if isArray {
+				if i < len(exts) {
+					e = exts[i]
+				}
+			} else {
+				e = ext
+			}
+			if err := writeElement(buf, key, elem.Type, v, e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isAttribute(typeName, key string) bool {
+	return key == "id" || (key == "url" && typeName == "Extension")
+}
+
+func writeElement(buf *bytes.Buffer, name, typeName string, value, ext interface{}) error {
+	if !isName(name) {
+		return fmt.Errorf("invalid element name %q", name)
+	}
+
+	switch v := value.(type) {
+	case object:
+		if v.getString("resourceType") != "" {
+			buf.WriteString("<" + name + ">")
+			if err := writeResource(buf, v, false); err != nil {
+				return err
+			}
+			buf.WriteString("</" + name + ">")
+			return nil
+		}
+
+		if typeName == "" && (name == "extension" || name == "modifierExtension") {
+			typeName = "Extension"
+		}
+		buf.WriteString("<" + name)
+		if id := v.getString("id"); id != "" {
+			writeAttr(buf, "id", id)
+		}
+		if url := v.getString("url"); url != "" && typeName == "Extension" {
+			writeAttr(buf, "url", url)
+		}
+		buf.WriteString(">")
+		if err := writeChildren(buf, typeName, v, false); err != nil {
+			return err
+		}
+		buf.WriteString("</" + name + ">")
+		return nil
+
+	case []interface{}:
+		return fmt.Errorf("nested array in element %q", name)
+
+	default:
+		if s, ok := v.(string); ok && (typeName == "xhtml" || name == "div") {
+			if err := checkXHTML(s); err != nil {
+				return fmt.Errorf("element %q: %w", name, err)
+			}
+			buf.WriteString(s)
+			return nil
+		}
+
+		buf.WriteString("<" + name)
+		if v != nil {
+			writeAttr(buf, "value", primitiveString(v))
+		}
+		extObj, _ := ext.(object)
+		if id := extObj.getString("id"); id != "" {
+			writeAttr(buf, "id", id)
+		}
+		if len(extObj) == 0 || (len(extObj) == 1 && extObj[0].Key == "id") {
+			buf.WriteString("/>")
+			return nil
+		}
+		buf.WriteString(">")
+		if err := writeChildren(buf, "Element", extObj, false); err != nil {
+			return err
+		}
+		buf.WriteString("</" + name + ">")
+		return nil
+	}
+}
+
+// isName reports whether name is a FHIR element or resource name: an ASCII
+// letter followed by letters and digits. Such names are valid XML names.
+func isName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// checkXHTML checks that a narrative is a single well-formed div in the
+// XHTML namespace, since it is copied into the document verbatim.
+func checkXHTML(s string) error {
+	dec := xml.NewDecoder(strings.NewReader(s))
+	depth, roots := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("narrative is not well-formed XHTML: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+				if roots > 1 || t.Name.Space != xhtmlNamespace || t.Name.Local != "div" {
+					return errors.New("narrative must be a single XHTML div")
+				}
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && len(bytes.TrimSpace(t)) > 0 {
+				return errors.New("narrative must be a single XHTML div")
+			}
+		case xml.ProcInst, xml.Directive:
+			return errors.New("narrative must not contain processing instructions or declarations")
+		}
+	}
+	if roots != 1 {
+		return errors.New("narrative must be a single XHTML div")
+	}
+	return nil
+}
+
+func primitiveString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+func writeAttr(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(" " + name + `="`)
+	xml.EscapeText(buf, []byte(value))
+	buf.WriteString(`"`)
+}
+
+// node is a parsed XML element.
+type node struct {
+	Name     string
+	Attrs    map[string]string
+	Children []*node
+	Raw      string // set for xhtml content, which is carried verbatim
+}
+
+// XMLToJSON converts a FHIR resource from its XML representation to JSON.
+func XMLToJSON(data []byte) (json.RawMessage, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FHIR XML: %w", err)
+	}
+
+	obj, err := convertResource(root)
+	if err != nil {
+		return nil, err
+	}
+	return marshal(obj)
+}
+
+func parseXML(data []byte) (*node, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*node
+	var root *node
+
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{Name: t.Name.Local, Attrs: map[string]string{}}
+			for _, a := range t.Attr {
+				if a.Name.Space == "" && a.Name.Local != "xmlns" {
+					n.Attrs[a.Name.Local] = a.Value
+				}
+			}
+
+			if len(stack) == 0 {
+				if t.Name.Space != Namespace {
+					return nil, ErrNotAResource
+				}
+				root = n
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, n)
+			}
+
+			if t.Name.Space == xhtmlNamespace {
+				if err := dec.Skip(); err != nil {
+					return nil, err
+				}
+				n.Raw = string(data[offset:dec.InputOffset()])
+				continue
+			}
+			stack = append(stack, n)
+
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if root == nil {
+		return nil, ErrNotAResource
+	}
+	return root, nil
+}
+
+func convertResource(n *node) (object, error) {
+	obj := object{{Key: "resourceType", Value: n.Name}}
+	children, err := convertChildren(n.Name, n)
+	if err != nil {
+		return nil, err
+	}
+	return append(obj, children...), nil
+}
+
+func convertChildren(typeName string, n *node) (object, error) {
+	var order []string
+	groups := map[string][]*node{}
+	for _, c := range n.Children {
+		if _, seen := groups[c.Name]; !seen {
+			order = append(order, c.Name)
+		}
+		groups[c.Name] = append(groups[c.Name], c)
+	}
+
+	var obj object
+	for _, name := range order {
+		group := groups[name]
+		elem, known := lookup(typeName, name)
+		many := elem.Many || len(group) > 1
+		if !known && (name == "extension" || name == "modifierExtension") {
+			elem.Type = "Extension"
+		}
+
+		values := make([]interface{}, 0, len(group))
+		exts := make([]interface{}, 0, len(group))
+		hasExt := false
+		for _, c := range group {
+			value, ext, err := convertElement(elem.Type, c)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			exts = append(exts, ext)
+			if ext != nil {
+				hasExt = true
+			}
+		}
+
+		if many {
+			obj = append(obj, member{Key: name, Value: values})
+			if hasExt {
+				obj = append(obj, member{Key: "_" + name, Value: exts})
+			}
+			continue
+		}
+		if values[0] != nil {
+			obj = append(obj, member{Key: name, Value: values[0]})
+		}
+		if hasExt {
+			obj = append(obj, member{Key: "_" + name, Value: exts[0]})
+		}
+	}
+	return obj, nil
+}
+
+// convertElement returns the JSON value of an element and, for primitives
+// carrying an id or extensions, the matching "_name" object.
+func convertElement(typeName string, n *node) (interface{}, interface{}, error) {
+	if n.Raw != "" {
+		return n.Raw, nil, nil
+	}
+
+	value, isPrimitive := n.Attrs["value"]
+	if isPrimitive || (typeName != "" && !isComplex(typeName)) {
+		var result interface{}
+		if isPrimitive {
+			v, err := primitiveValue(typeName, value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("element %q: %w", n.Name, err)
+			}
+			result = v
+		}
+
+		var ext object
+		if id, ok := n.Attrs["id"]; ok {
+			ext = append(ext, member{Key: "id", Value: id})
+		}
+		if len(n.Children) > 0 {
+			children, err := convertChildren("Element", n)
+			if err != nil {
+				return nil, nil, err
+			}
+			ext = append(ext, children...)
+		}
+		if ext == nil {
+			return result, nil, nil
+		}
+		return result, ext, nil
+	}
+
+	if typeName == "Resource" || (typeName == "" && len(n.Children) == 1 && isResourceName(n.Children[0].Name)) {
+		if len(n.Children) != 1 {
+			return nil, nil, fmt.Errorf("element %q must contain exactly one resource", n.Name)
+		}
+		obj, err := convertResource(n.Children[0])
+		return obj, nil, err
+	}
+
+	obj := object{}
+	if id, ok := n.Attrs["id"]; ok {
+		obj = append(obj, member{Key: "id", Value: id})
+	}
+	if url, ok := n.Attrs["url"]; ok {
+		obj = append(obj, member{Key: "url", Value: url})
+	}
+	children, err := convertChildren(typeName, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(obj, children...), nil, nil
+}
+
+func isComplex(typeName string) bool {
+	if typeName == "Resource" || typeName == "Element" {
+		return true
+	}
+	_, ok := typeSchema[typeName]
+	return ok
+}
+
+func isResourceName(name string) bool {
+	return name != "" && name[0] >= 'A' && name[0] <= 'Z'
+}
+
+func primitiveValue(typeName, value string) (interface{}, error) {
+	switch jsonKind(typeName) {
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean %q", value)
+		}
+		return b, nil
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("invalid number %q", value)
+		}
+		return json.Number(value), nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,130 @@
+package fhir
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestXMLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+	}{
+		{"minimal", `{"resourceType":"Patient","id":"b-7"}`},
+		{"single repeating element", `{"resourceType":"Patient","name":[{"family":"Dela Cruz","given":["Juan"]}]}`},
+		{"primitive kinds", `{"resourceType":"Patient","active":true,"gender":"male","birthDate":"1985-03-15","multipleBirthInteger":2}`},
+		{"identifiers", `{"resourceType":"Patient","identifier":[
+			{"system":"http://philhealth.gov.ph","value":"12-345678901-2"},
+			{"system":"http://hospital-b.ph/mrn","value":"CB-MRN-5678","type":{"coding":[{"system":"http://terminology.hl7.org/CodeSystem/v2-0203","code":"MR"}]}}]}`},
+		{"extensions", `{"resourceType":"Patient","extension":[
+			{"url":"http://example.ph/indigenous-group","valueString":"Igorot"},
+			{"id":"e1","url":"http://example.ph/nested","extension":[{"url":"part","valueBoolean":false}]}]}`},
+		{"primitive extension", `{"resourceType":"Patient","birthDate":"1985-03-15",
+			"_birthDate":{"id":"bd","extension":[{"url":"http://hl7.org/fhir/StructureDefinition/patient-birthTime","valueDateTime":"1985-03-15T08:30:00+08:00"}]}}`},
+		{"primitive extension without value", `{"resourceType":"Patient",
+			"_gender":{"extension":[{"url":"http://hl7.org/fhir/StructureDefinition/data-absent-reason","valueCode":"unknown"}]}}`},
+		{"extension in a repeating primitive", `{"resourceType":"Patient","name":[{"given":["Juan","Santos"],
+			"_given":[null,{"extension":[{"url":"http://example.ph/name-part","valueCode":"middle"}]}]}]}`},
+		{"contained resource", `{"resourceType":"Patient","contained":[{"resourceType":"Organization","id":"org1","name":"Hospital B"}],
+			"managingOrganization":{"reference":"#org1"}}`},
+		{"narrative", `{"resourceType":"Patient","text":{"status":"generated",
+			"div":"<div xmlns=\"http://www.w3.org/1999/xhtml\"><p>Juan Dela Cruz</p></div>"}}`},
+		{"escaped characters", `{"resourceType":"Patient","address":[{"text":"Lot 5 & 6, \"Block\" <A>"}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xmlData, err := JSONToXML(json.RawMessage(tt.resource))
+			if err != nil {
+				t.Fatalf("JSONToXML: %v", err)
+			}
+			if !strings.HasPrefix(string(xmlData), `<Patient xmlns="`+Namespace+`">`) {
+				t.Errorf("XML does not start with the namespaced root: %s", xmlData)
+			}
+
+			got, err := XMLToJSON(xmlData)
+			if err != nil {
+				t.Fatalf("XMLToJSON(%s): %v", xmlData, err)
+			}
+
+			var want, have interface{}
+			if err := json.Unmarshal([]byte(tt.resource), &want); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(got, &have); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(have, want) {
+				t.Errorf("round trip changed the resource\n got: %s\nwant: %s\n xml: %s", got, tt.resource, xmlData)
+			}
+		})
+	}
+}
+
+func TestXMLToJSONErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		xml     string
+		wantErr error
+	}{
+		{"no namespace", `<Patient><id value="b-7"/></Patient>`, ErrNotAResource},
+		{"other namespace", `<Patient xmlns="urn:example"><id value="b-7"/></Patient>`, ErrNotAResource},
+		{"empty document", ``, ErrNotAResource},
+		{"invalid boolean", `<Patient xmlns="http://hl7.org/fhir"><active value="yes"/></Patient>`, nil},
+		{"not well formed", `<Patient xmlns="http://hl7.org/fhir"><id value="b-7"></Patient>`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := XMLToJSON([]byte(tt.xml))
+			if err == nil {
+				t.Fatal("XMLToJSON() error = nil, want an error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("XMLToJSON() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJSONToXMLRejectsInvalidContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource string
+	}{
+		{"resourceType with markup", `{"resourceType":"Patient><script/><x"}`},
+		{"resourceType with a space", `{"resourceType":"Patient id=\"x\""}`},
+		{"contained resourceType", `{"resourceType":"Patient","contained":[{"resourceType":"Org/anization"}]}`},
+		{"key with markup", `{"resourceType":"Patient","gender><evil/><x":"male"}`},
+		{"key starting with a digit", `{"resourceType":"Patient","1gender":"male"}`},
+		{"nested key", `{"resourceType":"Patient","name":[{"fam ily":"Dela Cruz"}]}`},
+		{"primitive extension key", `{"resourceType":"Patient","_gen-der":{"id":"g"}}`},
+		{"unclosed narrative", `{"resourceType":"Patient","text":{"status":"generated",
+			"div":"<div xmlns=\"http://www.w3.org/1999/xhtml\"><p>Juan</div>"}}`},
+		{"narrative closing the resource", `{"resourceType":"Patient","text":{"status":"generated",
+			"div":"<div xmlns=\"http://www.w3.org/1999/xhtml\"></div></text></Patient><Patient>"}}`},
+		{"narrative without namespace", `{"resourceType":"Patient","text":{"status":"generated","div":"<div>Juan</div>"}}`},
+		{"narrative that is not a div", `{"resourceType":"Patient","text":{"status":"generated",
+			"div":"<p xmlns=\"http://www.w3.org/1999/xhtml\">Juan</p>"}}`},
+		{"narrative with trailing text", `{"resourceType":"Patient","text":{"status":"generated",
+			"div":"<div xmlns=\"http://www.w3.org/1999/xhtml\">Juan</div>&lt;x"}}`},
+		{"narrative with a declaration", `{"resourceType":"Patient","text":{"status":"generated",
+			"div":"<!DOCTYPE x><div xmlns=\"http://www.w3.org/1999/xhtml\">Juan</div>"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if data, err := JSONToXML(json.RawMessage(tt.resource)); err == nil {
+				t.Errorf("JSONToXML() = %s, want an error", data)
+			}
+		})
+	}
+}
+
+func TestJSONToXMLRejectsNonResources(t *testing.T) {
+	for _, data := range []string{`{"id":"b-7"}`, `[{"resourceType":"Patient"}]`, `"Patient"`} {
+		if _, err := JSONToXML(json.RawMessage(data)); !errors.Is(err, ErrNotAResource) {
+			t.Errorf("JSONToXML(%s) error = %v, want ErrNotAResource", data, err)
+		}
+	}
+}
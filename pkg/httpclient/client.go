@@ -2,31 +2,120 @@ package httpclient
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"time"
 )
 
+// maxResponseBytes bounds how much of a response body PostJSONDecode reads.
+const maxResponseBytes = 1 << 20
+
+// defaultClient only connects to public addresses (see dialControl),
+// ignores proxy settings, which would hide the destination from the
+// filter, and does not follow redirects.
 var defaultClient = &http.Client{
 	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: dialControl,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Headers set on webhook deliveries.
+const (
+	// EventHeader names the event a delivery reports.
+	EventHeader = "X-WAH4PC-Event"
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the
+	// body, keyed with the subscription's secret.
+	SignatureHeader = "X-WAH4PC-Signature"
+)
+
+// Options adds headers to a POST and, with Secret set, signs the body in
+// SignatureHeader.
+type Options struct {
+	Headers map[string]string
+	Secret  string
 }
 
 func PostJSON(url string, body interface{}) error {
+	return PostJSONWith(url, body, Options{}, nil)
+}
+
+// PostJSONDecode posts body as JSON and decodes the JSON response into out.
+func PostJSONDecode(url string, body, out interface{}) error {
+	return PostJSONWith(url, body, Options{}, out)
+}
+
+// PostJSONWith posts body as JSON with opts applied and, unless out is nil,
+// decodes the JSON response into out.
+func PostJSONWith(url string, body interface{}, opts Options, out interface{}) error {
+	if err := CheckURL(url); err != nil {
+		return fmt.Errorf("refusing to POST to %s: %w", url, err)
+	}
+
 	data, err := json.Marshal(body)
 	if err != nil {
 		return fmt.Errorf("failed to marshal body: %w", err)
 	}
 
-	resp, err := defaultClient.Post(url, "application/json", bytes.NewReader(data))
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to POST to %s: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range opts.Headers {
+		req.Header.Set(k, v)
+	}
+	if opts.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(opts.Secret, data))
+	}
+
+	resp, err := defaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to POST to %s: %w", url, err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
-		return fmt.Errorf("POST to %s returned status %d", url, resp.StatusCode)
+	if err := checkStatus(url, resp); err != nil {
+		return err
 	}
 
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(out); err != nil {
+		return fmt.Errorf("invalid JSON response from %s: %w", url, err)
+	}
+	return nil
+}
+
+// Sign returns the SignatureHeader value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func checkStatus(url string, resp *http.Response) error {
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		return fmt.Errorf("POST to %s returned status %d: %w", url, resp.StatusCode, ErrRedirectRefused)
+	case resp.StatusCode >= 400:
+		return fmt.Errorf("POST to %s returned status %d", url, resp.StatusCode)
+	}
 	return nil
 }
@@ -0,0 +1,152 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var (
+	ErrInvalidURL      = errors.New("URL must be an absolute http or https URL without credentials")
+	ErrDeniedAddress   = errors.New("destination address is not allowed")
+	ErrRedirectRefused = errors.New("redirects are not followed")
+)
+
+// deniedNetworks are special-purpose ranges not covered by the net.IP
+// predicates used in deniedIP.
+var deniedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",       // "this" network
+	"100.64.0.0/10",   // carrier-grade NAT
+	"192.0.0.0/24",    // IETF protocol assignments
+	"192.0.2.0/24",    // documentation
+	"198.18.0.0/15",   // benchmarking
+	"198.51.100.0/24", // documentation
+	"203.0.113.0/24",  // documentation
+	"240.0.0.0/4",     // reserved, including broadcast
+	"64:ff9b::/96",    // NAT64, which can reach private IPv4
+	"2001:db8::/32",   // documentation
+)
+
+var (
+	allowedMu       sync.RWMutex
+	allowedNetworks []*net.IPNet
+)
+
+// SetAllowedNetworks exempts networks from the address filter, e.g. a
+// private range where trusted provider systems live.
+func SetAllowedNetworks(networks []*net.IPNet) {
+	allowedMu.Lock()
+	defer allowedMu.Unlock()
+	allowedNetworks = networks
+}
+
+// ParseNetworks parses a comma separated list of CIDRs or single IPs.
+func ParseNetworks(list string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid network %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// CheckURL validates a URL the gateway will call. Hosts given as IP
+// addresses must pass the address filter; host names are checked when
+// they are resolved at dial time.
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ip := net.ParseIP(host); ip != nil {
+		return checkIP(ip)
+	}
+	// localhost is loopback whatever the resolver says, so it is only
+	// allowed where loopback is.
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return checkIP(net.IPv4(127, 0, 0, 1))
+	}
+	return nil
+}
+
+func checkIP(ip net.IP) error {
+	allowedMu.RLock()
+	defer allowedMu.RUnlock()
+	for _, network := range allowedNetworks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+
+	if deniedIP(ip) {
+		return fmt.Errorf("%w: %s", ErrDeniedAddress, ip)
+	}
+	return nil
+}
+
+// deniedIP reports whether ip is loopback, private, link-local or
+// otherwise not a public unicast address.
+func deniedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, network := range deniedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialControl runs after name resolution, so it sees the address actually
+// dialed and cannot be bypassed by DNS rebinding.
+func dialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%w: %s", ErrDeniedAddress, host)
+	}
+	return checkIP(ip)
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
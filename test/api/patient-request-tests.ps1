@@ -2,7 +2,8 @@
 # Tests for /v1/fhir/patient/* endpoints
 
 param(
-    [string]$BaseUrl = "http://localhost:3050"
+    [string]$BaseUrl = "http://localhost:3050",
+    [string]$AdminToken = $env:ADMIN_TOKEN
 )
 
 $scriptPath = Split-Path -Parent $MyInvocation.MyCommand.Path
@@ -90,7 +91,7 @@ $patientRequest = @{
     }
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $patientRequest
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $patientRequest -AsProvider $requestorId
 Assert-StatusCode -TestName "Create request returns 201" -Response $response -Expected 201
 
 $createdRequestId = $null
@@ -119,7 +120,7 @@ $requestWithCorrelation = @{
     }
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $requestWithCorrelation
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $requestWithCorrelation -AsProvider $requestorId
 Assert-StatusCode -TestName "Create request with correlation key returns 201" -Response $response -Expected 201
 
 # ============================================================
@@ -139,7 +140,7 @@ $requestWithConstraints = @{
     }
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $requestWithConstraints
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $requestWithConstraints -AsProvider $requestorId
 Assert-StatusCode -TestName "Create request with FHIR constraints returns 201" -Response $response -Expected 201
 
 # ============================================================
@@ -147,30 +148,37 @@ Assert-StatusCode -TestName "Create request with FHIR constraints returns 201" -
 # ============================================================
 Write-TestSection "POST /v1/fhir/patient/request - Validation Errors"
 
-# Missing requestorProviderId
-$invalidRequest1 = @{
+# Missing API key
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $patientRequest
+Assert-StatusCode -TestName "Request without API key returns 401" -Response $response -Expected 401
+
+# Missing requestorProviderId: the caller is the requestor
+$callerRequest = @{
     targetProviderId = $targetId
     patientReference = @{ id = "patient-123" }
 }
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $invalidRequest1
-Assert-StatusCode -TestName "Missing requestorProviderId returns 400" -Response $response -Expected 400
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $callerRequest -AsProvider $requestorId
+Assert-StatusCode -TestName "Missing requestorProviderId returns 201" -Response $response -Expected 201
+if ($response.Success -and $response.Data) {
+    Assert-PropertyEquals -TestName "Response" -Object $response.Data -Property "requestorProviderId" -Expected $requestorId
+}
 
 # Missing targetProviderId
 $invalidRequest2 = @{
     requestorProviderId = $requestorId
     patientReference = @{ id = "patient-123" }
 }
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $invalidRequest2
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $invalidRequest2 -AsProvider $requestorId
 Assert-StatusCode -TestName "Missing targetProviderId returns 400" -Response $response -Expected 400
 
-# Non-existent requestor provider
+# Another provider as requestor
 $invalidRequest3 = @{
-    requestorProviderId = "non-existent-provider"
-    targetProviderId = $targetId
+    requestorProviderId = $targetId
+    targetProviderId = $requestorId
     patientReference = @{ id = "patient-123" }
 }
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $invalidRequest3
-Assert-StatusCode -TestName "Non-existent requestor returns 400" -Response $response -Expected 400
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $invalidRequest3 -AsProvider $requestorId
+Assert-StatusCode -TestName "Another provider as requestor returns 403" -Response $response -Expected 403
 
 # Non-existent target provider
 $invalidRequest4 = @{
@@ -178,7 +186,7 @@ $invalidRequest4 = @{
     targetProviderId = "non-existent-provider"
     patientReference = @{ id = "patient-123" }
 }
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $invalidRequest4
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $invalidRequest4 -AsProvider $requestorId
 Assert-StatusCode -TestName "Non-existent target returns 400" -Response $response -Expected 400
 
 # ============================================================
@@ -186,7 +194,7 @@ Assert-StatusCode -TestName "Non-existent target returns 400" -Response $respons
 # ============================================================
 Write-TestSection "GET /v1/fhir/patient/request - Pending Requests"
 
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=$targetId"
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=$targetId" -AsProvider $targetId
 Assert-StatusCode -TestName "Get pending requests returns 200" -Response $response -Expected 200
 
 if ($response.Success -and $response.Data) {
@@ -207,13 +215,17 @@ if ($response.Success -and $response.Data) {
 # ============================================================
 Write-TestSection "GET /v1/fhir/patient/request - Validation Errors"
 
-# Missing targetProviderId
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request"
-Assert-StatusCode -TestName "Missing targetProviderId returns 400" -Response $response -Expected 400
+# Missing API key
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=$targetId"
+Assert-StatusCode -TestName "Polling without API key returns 401" -Response $response -Expected 401
 
-# Non-existent target provider
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=non-existent"
-Assert-StatusCode -TestName "Non-existent target returns 404" -Response $response -Expected 404
+# Missing targetProviderId: the caller is the target
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request" -AsProvider $targetId
+Assert-StatusCode -TestName "Missing targetProviderId returns 200" -Response $response -Expected 200
+
+# Another provider's requests
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=$targetId" -AsProvider $requestorId
+Assert-StatusCode -TestName "Polling another target returns 403" -Response $response -Expected 403
 
 # ============================================================
 # TEST: Get Response for Pending Request
@@ -221,7 +233,7 @@ Assert-StatusCode -TestName "Non-existent target returns 404" -Response $respons
 Write-TestSection "GET /v1/fhir/patient/response - Pending Request"
 
 if ($createdRequestId) {
-    $response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$createdRequestId"
+    $response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$createdRequestId" -AsProvider $requestorId
     Assert-StatusCode -TestName "Get response for pending request returns 200" -Response $response -Expected 200
     
     if ($response.Success -and $response.Data) {
@@ -236,13 +248,19 @@ if ($createdRequestId) {
 Write-TestSection "GET /v1/fhir/patient/response - Validation Errors"
 
 # Missing requestId
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response"
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response" -AsProvider $requestorId
 Assert-StatusCode -TestName "Missing requestId returns 400" -Response $response -Expected 400
 
 # Non-existent request
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=REQ-NONEXISTENT"
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=REQ-NONEXISTENT" -AsProvider $requestorId
 Assert-StatusCode -TestName "Non-existent request returns 404" -Response $response -Expected 404
 
+# Only the requestor may read the response
+if ($createdRequestId) {
+    $response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$createdRequestId" -AsProvider $targetId
+    Assert-StatusCode -TestName "Response read by the target returns 403" -Response $response -Expected 403
+}
+
 # ============================================================
 # SUMMARY
 # ============================================================
@@ -2,7 +2,8 @@
 # Tests for /v1/fhir/patient/respond endpoint
 
 param(
-    [string]$BaseUrl = "http://localhost:3050"
+    [string]$BaseUrl = "http://localhost:3050",
+    [string]$AdminToken = $env:ADMIN_TOKEN
 )
 
 $scriptPath = Split-Path -Parent $MyInvocation.MyCommand.Path
@@ -82,7 +83,7 @@ $patientRequest = @{
     }
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $patientRequest
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $patientRequest -AsProvider $requestorId
 $createdRequestId = $null
 if ($response.StatusCode -eq 201 -and $response.Data) {
     $createdRequestId = $response.Data.requestId
@@ -147,7 +148,7 @@ $patientResponse = @{
     }
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $patientResponse
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $patientResponse -AsProvider $targetId
 Assert-StatusCode -TestName "Submit completed response returns 200" -Response $response -Expected 200
 
 if ($response.Success -and $response.Data) {
@@ -161,7 +162,7 @@ if ($response.Success -and $response.Data) {
 # ============================================================
 Write-TestSection "GET /v1/fhir/patient/response - After Response Submission"
 
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$createdRequestId"
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$createdRequestId" -AsProvider $requestorId
 Assert-StatusCode -TestName "Get response after submission returns 200" -Response $response -Expected 200
 
 if ($response.Success -and $response.Data) {
@@ -186,7 +187,7 @@ $failedRequest = @{
     patientReference = @{ id = "patient-fail-test" }
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $failedRequest
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $failedRequest -AsProvider $requestorId
 $failedRequestId = $null
 if ($response.StatusCode -eq 201 -and $response.Data) {
     $failedRequestId = $response.Data.requestId
@@ -201,7 +202,7 @@ if ($failedRequestId) {
         error = "Patient not found in system"
     }
     
-    $response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $failedResponse
+    $response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $failedResponse -AsProvider $targetId
     Assert-StatusCode -TestName "Submit failed response returns 200" -Response $response -Expected 200
     
     if ($response.Success -and $response.Data) {
@@ -209,7 +210,7 @@ if ($failedRequestId) {
     }
     
     # Verify the failed response
-    $response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$failedRequestId"
+    $response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$failedRequestId" -AsProvider $requestorId
     if ($response.Success -and $response.Data) {
         Assert-PropertyEquals -TestName "Get failed response" -Object $response.Data -Property "status" -Expected "FAILED"
         
@@ -229,16 +230,17 @@ $invalidResponse1 = @{
     fromProviderId = $targetId
     status = "COMPLETED"
 }
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $invalidResponse1
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $invalidResponse1 -AsProvider $targetId
 Assert-StatusCode -TestName "Missing requestId returns 400" -Response $response -Expected 400
 
-# Missing fromProviderId
+# Missing API key
 $invalidResponse2 = @{
     requestId = "REQ-12345"
+    fromProviderId = $targetId
     status = "COMPLETED"
 }
 $response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $invalidResponse2
-Assert-StatusCode -TestName "Missing fromProviderId returns 400" -Response $response -Expected 400
+Assert-StatusCode -TestName "Response without API key returns 401" -Response $response -Expected 401
 
 # Non-existent request
 $invalidResponse3 = @{
@@ -246,7 +248,7 @@ $invalidResponse3 = @{
     fromProviderId = $targetId
     status = "COMPLETED"
 }
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $invalidResponse3
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $invalidResponse3 -AsProvider $targetId
 Assert-StatusCode -TestName "Non-existent request returns 404" -Response $response -Expected 404
 
 # ============================================================
@@ -261,7 +263,7 @@ $mismatchRequest = @{
     patientReference = @{ id = "patient-mismatch-test" }
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $mismatchRequest
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $mismatchRequest -AsProvider $requestorId
 $mismatchRequestId = $null
 if ($response.StatusCode -eq 201 -and $response.Data) {
     $mismatchRequestId = $response.Data.requestId
@@ -276,8 +278,11 @@ if ($mismatchRequestId) {
         fhirPatient = @{ resourceType = "Patient"; id = "test" }
     }
     
-    $response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $wrongProviderResponse
-    Assert-StatusCode -TestName "Wrong fromProviderId returns 400" -Response $response -Expected 400
+    $response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $wrongProviderResponse -AsProvider $targetId
+    Assert-StatusCode -TestName "fromProviderId of another provider returns 403" -Response $response -Expected 403
+
+    $response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $wrongProviderResponse -AsProvider $requestorId
+    Assert-StatusCode -TestName "Response from a provider that is not the target returns 400" -Response $response -Expected 400
 }
 
 # ============================================================
@@ -292,7 +297,7 @@ $defaultStatusRequest = @{
     patientReference = @{ id = "patient-default-status" }
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $defaultStatusRequest
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $defaultStatusRequest -AsProvider $requestorId
 $defaultStatusRequestId = $null
 if ($response.StatusCode -eq 201 -and $response.Data) {
     $defaultStatusRequestId = $response.Data.requestId
@@ -306,7 +311,7 @@ if ($defaultStatusRequestId) {
         fhirPatient = @{ resourceType = "Patient"; id = "default-patient" }
     }
     
-    $response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $noStatusResponse
+    $response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $noStatusResponse -AsProvider $targetId
     Assert-StatusCode -TestName "Response without status returns 200" -Response $response -Expected 200
     
     if ($response.Success -and $response.Data) {
@@ -2,7 +2,8 @@
 # Tests for /v1/provider endpoints
 
 param(
-    [string]$BaseUrl = "http://localhost:3050"
+    [string]$BaseUrl = "http://localhost:3050",
+    [string]$AdminToken = $env:ADMIN_TOKEN
 )
 
 $scriptPath = Split-Path -Parent $MyInvocation.MyCommand.Path
@@ -60,6 +61,9 @@ if ($response.Success -and $response.Data) {
     Assert-PropertyEquals -TestName "Created provider" -Object $response.Data -Property "type" -Expected "HOSPITAL"
     Assert-PropertyExists -TestName "Created provider" -Object $response.Data -Property "createdAt"
     Assert-PropertyExists -TestName "Created provider" -Object $response.Data -Property "updatedAt"
+    Assert-PropertyExists -TestName "Created provider" -Object $response.Data -Property "apiKey"
+    # PENDING_APPROVAL means the server was not started with PROVIDER_ONBOARDING=open
+    Assert-PropertyEquals -TestName "Created provider" -Object $response.Data -Property "status" -Expected "ACTIVE"
 }
 
 # Store for later tests
@@ -161,6 +165,61 @@ if ($response.Success -and $response.Data) {
     Write-Info "Total providers: $($response.Data.Count)"
 }
 
+# ============================================================
+# TEST: Owner or Admin Endpoints
+# ============================================================
+Write-TestSection "PATCH /v1/provider/{id} - Provider's Own API Key"
+
+$otherProviderId = $provider.providerId
+
+$response = Invoke-ApiRequest -Method "PATCH" -Endpoint "/v1/provider/$testProviderId" -Body @{ name = "Renamed Hospital" }
+Assert-StatusCode -TestName "Patch without API key returns 401" -Response $response -Expected 401
+
+$response = Invoke-ApiRequest -Method "PATCH" -Endpoint "/v1/provider/$testProviderId" -Body @{ name = "Renamed Hospital" } -ApiKey $script:ProviderApiKeys[$otherProviderId]
+Assert-StatusCode -TestName "Patch with another provider's API key returns 403" -Response $response -Expected 403
+
+$response = Invoke-ApiRequest -Method "PATCH" -Endpoint "/v1/provider/$testProviderId" -Body @{ name = "Renamed Hospital" } -ApiKey $script:ProviderApiKeys[$testProviderId]
+Assert-StatusCode -TestName "Patch with own API key returns 200" -Response $response -Expected 200
+
+if ($response.Success -and $response.Data) {
+    Assert-PropertyEquals -TestName "Renamed provider" -Object $response.Data -Property "name" -Expected "Renamed Hospital"
+}
+
+$response = Invoke-ApiRequest -Method "PATCH" -Endpoint "/v1/provider/$testProviderId" -Body @{ groups = @("network-a") } -ApiKey $script:ProviderApiKeys[$testProviderId]
+Assert-StatusCode -TestName "Patch of groups with own API key returns 401" -Response $response -Expected 401
+
+$response = Invoke-ApiRequest -Method "DELETE" -Endpoint "/v1/provider/$testProviderId"
+Assert-StatusCode -TestName "Delete without API key returns 401" -Response $response -Expected 401
+
+# ============================================================
+# TEST: Admin Endpoints
+# ============================================================
+Write-TestSection "POST /v1/provider/{id}/suspend and /approve - Admin Token"
+
+$response = Test-ApiPost -Endpoint "/v1/provider/$testProviderId/suspend" -Body @{ reason = "Automated test" }
+Assert-StatusCode -TestName "Suspend without admin token returns 401" -Response $response -Expected 401
+
+$response = Invoke-ApiRequest -Method "POST" -Endpoint "/v1/provider/$testProviderId/suspend" -Body @{ reason = "Automated test" } -ApiKey $script:ProviderApiKeys[$testProviderId]
+Assert-StatusCode -TestName "Suspend with a provider API key returns 401" -Response $response -Expected 401
+
+if ($script:AdminToken) {
+    $response = Test-ApiPost -Endpoint "/v1/provider/$testProviderId/suspend" -Body @{ reason = "Automated test" } -Admin
+    Assert-StatusCode -TestName "Suspend with admin token returns 200" -Response $response -Expected 200
+
+    if ($response.Success -and $response.Data) {
+        Assert-PropertyEquals -TestName "Suspended provider" -Object $response.Data.provider -Property "status" -Expected "SUSPENDED"
+    }
+
+    $response = Test-ApiPost -Endpoint "/v1/provider/$testProviderId/approve" -Body @{ reason = "Automated test" } -Admin
+    Assert-StatusCode -TestName "Approve with admin token returns 200" -Response $response -Expected 200
+
+    if ($response.Success -and $response.Data) {
+        Assert-PropertyEquals -TestName "Approved provider" -Object $response.Data -Property "status" -Expected "ACTIVE"
+    }
+} else {
+    Write-Info "ADMIN_TOKEN not set, skipping admin token tests"
+}
+
 # ============================================================
 # TEST: Invalid JSON Body
 # ============================================================
@@ -2,7 +2,8 @@
 # Complete workflow tests for the WAH4PC API Gateway
 
 param(
-    [string]$BaseUrl = "http://localhost:3050"
+    [string]$BaseUrl = "http://localhost:3050",
+    [string]$AdminToken = $env:ADMIN_TOKEN
 )
 
 $scriptPath = Split-Path -Parent $MyInvocation.MyCommand.Path
@@ -89,7 +90,7 @@ $patientRequest = @{
     }
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $patientRequest
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $patientRequest -AsProvider $hospitalAId
 Assert-StatusCode -TestName "Hospital A creates request" -Response $response -Expected 201
 
 $requestId = $null
@@ -102,7 +103,7 @@ if ($response.Success -and $response.Data) {
 # Step 2: Clinic B polls for pending requests
 Write-Info "Step 2: Clinic B polls for pending requests..."
 
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=$clinicBId"
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=$clinicBId" -AsProvider $clinicBId
 Assert-StatusCode -TestName "Clinic B polls pending requests" -Response $response -Expected 200
 
 if ($response.Success -and $response.Data) {
@@ -123,7 +124,7 @@ if ($response.Success -and $response.Data) {
 # Step 3: Hospital A checks request status (should be PENDING)
 Write-Info "Step 3: Hospital A checks request status..."
 
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$requestId"
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$requestId" -AsProvider $hospitalAId
 Assert-StatusCode -TestName "Hospital A checks status" -Response $response -Expected 200
 
 if ($response.Success -and $response.Data) {
@@ -226,7 +227,7 @@ $patientResponse = @{
     fhirPatient = $fhirPatientData
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $patientResponse
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $patientResponse -AsProvider $clinicBId
 Assert-StatusCode -TestName "Clinic B submits response" -Response $response -Expected 200
 
 if ($response.Success -and $response.Data) {
@@ -237,7 +238,7 @@ if ($response.Success -and $response.Data) {
 # Step 5: Hospital A retrieves the completed response
 Write-Info "Step 5: Hospital A retrieves the patient data..."
 
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$requestId"
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$requestId" -AsProvider $hospitalAId
 Assert-StatusCode -TestName "Hospital A gets response" -Response $response -Expected 200
 
 if ($response.Success -and $response.Data) {
@@ -254,7 +255,7 @@ if ($response.Success -and $response.Data) {
 # Step 6: Verify request is no longer in pending queue
 Write-Info "Step 6: Verify request removed from pending queue..."
 
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=$clinicBId"
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=$clinicBId" -AsProvider $clinicBId
 if ($response.Success -and $response.Data) {
     $stillPending = $response.Data.pendingRequests | Where-Object { $_.requestId -eq $requestId }
     if (-not $stillPending) {
@@ -307,7 +308,7 @@ $labRequest = @{
     }
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $labRequest
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $labRequest -AsProvider $labCId
 Assert-StatusCode -TestName "Lab C creates request" -Response $response -Expected 201
 
 $failedRequestId = $null
@@ -324,11 +325,11 @@ $failedResponse = @{
     error = "Patient not found. No matching records for identifier SPEC-2024-999"
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $failedResponse
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $failedResponse -AsProvider $hospitalAId
 Assert-StatusCode -TestName "Hospital A sends FAILED response" -Response $response -Expected 200
 
 # Verify Lab C can see the error
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$failedRequestId"
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$failedRequestId" -AsProvider $labCId
 Assert-StatusCode -TestName "Lab C gets failed response" -Response $response -Expected 200
 
 if ($response.Success -and $response.Data) {
@@ -362,7 +363,7 @@ for ($i = 1; $i -le 5; $i++) {
         }
     }
     
-    $response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $multiRequest
+    $response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $multiRequest -AsProvider $hospitalAId
     if ($response.StatusCode -eq 201 -and $response.Data) {
         $requestIds += $response.Data.requestId
     }
@@ -372,7 +373,7 @@ Write-Info "Created $($requestIds.Count) requests"
 Assert-ArrayLength -TestName "Batch requests created" -Array $requestIds -MinLength 5 -MaxLength 5
 
 # Verify all requests appear in pending queue
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=$clinicBId"
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=$clinicBId" -AsProvider $clinicBId
 if ($response.Success -and $response.Data) {
     $pendingForBatch = $response.Data.pendingRequests | Where-Object { $_.requestId -in $requestIds }
     Assert-ArrayLength -TestName "All batch requests pending" -Array $pendingForBatch -MinLength 5
@@ -390,7 +391,7 @@ foreach ($reqId in $requestIds) {
         }
     }
     
-    $response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $batchResponse
+    $response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $batchResponse -AsProvider $clinicBId
 }
 
 Write-Pass "All $($requestIds.Count) batch requests responded"
@@ -398,7 +399,7 @@ Write-Pass "All $($requestIds.Count) batch requests responded"
 # Verify all are completed
 $allCompleted = $true
 foreach ($reqId in $requestIds) {
-    $response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$reqId"
+    $response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$reqId" -AsProvider $hospitalAId
     if (-not ($response.Success -and $response.Data.status -eq "COMPLETED")) {
         $allCompleted = $false
         break
@@ -431,7 +432,7 @@ $reverseRequest = @{
     }
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $reverseRequest
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $reverseRequest -AsProvider $clinicBId
 Assert-StatusCode -TestName "Clinic B requests from Hospital A" -Response $response -Expected 201
 
 $reverseRequestId = $null
@@ -440,7 +441,7 @@ if ($response.Success -and $response.Data) {
 }
 
 # Hospital A checks its pending requests
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=$hospitalAId"
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/request?targetProviderId=$hospitalAId" -AsProvider $hospitalAId
 Assert-StatusCode -TestName "Hospital A sees pending requests" -Response $response -Expected 200
 
 if ($response.Success -and $response.Data) {
@@ -462,15 +463,82 @@ $reverseResponse = @{
     }
 }
 
-$response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $reverseResponse
+$response = Test-ApiPost -Endpoint "/v1/fhir/patient/respond" -Body $reverseResponse -AsProvider $hospitalAId
 Assert-StatusCode -TestName "Hospital A responds to Clinic B" -Response $response -Expected 200
 
 # Clinic B retrieves the response
-$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$reverseRequestId"
+$response = Test-ApiGet -Endpoint "/v1/fhir/patient/response?requestId=$reverseRequestId" -AsProvider $clinicBId
 if ($response.Success -and $response.Data.status -eq "COMPLETED") {
     Write-Pass "Bidirectional exchange completed successfully"
 }
 
+# ============================================================
+# SCENARIO 5: Master Patient Index and Matching
+# Hospital A finds Clinic B's records of Jane Doe from Scenario 1
+# ============================================================
+Write-TestSection "SCENARIO 5: Master Patient Index and Matching"
+
+Write-Info "Resolving Hospital A's MRN for Clinic B..."
+
+$resolveEndpoint = "/v1/mpi/resolve?system=http://hospital-a.local/mrn&value=MRN-2024-001&targetProviderId=$clinicBId"
+
+$response = Test-ApiGet -Endpoint $resolveEndpoint
+Assert-StatusCode -TestName "MPI resolve without API key" -Response $response -Expected 401
+
+$response = Test-ApiGet -Endpoint $resolveEndpoint -AsProvider $hospitalAId
+Assert-StatusCode -TestName "Hospital A resolves MRN" -Response $response -Expected 200
+
+if ($response.Success -and $response.Data) {
+    Assert-PropertyEquals -TestName "Resolved patient" -Object $response.Data -Property "patientId" -Expected "patient-jane-doe-fhir"
+    $clinicMrn = $response.Data.addedIdentifiers | Where-Object { $_.value -eq "CB-MRN-5678" }
+    if ($clinicMrn) {
+        Write-Pass "Clinic B's MRN resolved"
+    } else {
+        Write-Fail "MPI resolve" "Clinic B's MRN CB-MRN-5678 not in addedIdentifiers"
+    }
+}
+
+Write-Info "Matching Jane Doe's demographics at Clinic B..."
+
+$matchQuery = @{
+    demographics = @{
+        givenName = "Jane"
+        familyName = "Doe"
+        birthDate = "1990-06-15"
+        gender = "female"
+    }
+    targetProviderId = $clinicBId
+}
+
+$response = Test-ApiPost -Endpoint "/v1/match" -Body $matchQuery
+Assert-StatusCode -TestName "Match without API key" -Response $response -Expected 401
+
+$response = Test-ApiPost -Endpoint "/v1/match" -Body $matchQuery -AsProvider $hospitalAId
+Assert-StatusCode -TestName "Hospital A matches demographics" -Response $response -Expected 200
+
+$matchToken = $null
+if ($response.Success -and $response.Data) {
+    Assert-ArrayLength -TestName "Matches" -Array $response.Data.matches -MinLength 1
+    $matchToken = $response.Data.matches[0].matchToken
+    Assert-NotNull -TestName "Match token" -Value $matchToken
+}
+
+if ($matchToken) {
+    $tokenRequest = @{
+        requestorProviderId = $hospitalAId
+        targetProviderId = $clinicBId
+        patientReference = @{
+            matchToken = $matchToken
+        }
+        metadata = @{
+            reason = "Follow-up after demographic match"
+        }
+    }
+
+    $response = Test-ApiPost -Endpoint "/v1/fhir/patient/request" -Body $tokenRequest -AsProvider $hospitalAId
+    Assert-StatusCode -TestName "Hospital A requests by match token" -Response $response -Expected 201
+}
+
 # ============================================================
 # SUMMARY
 # ============================================================
@@ -1,8 +1,23 @@
 # WAH4PC API Gateway - Test Runner
 # Runs all test suites and generates a summary report
+#
+# Start the server for testing with open onboarding, opt-out consent,
+# loopback callbacks allowed, a pseudonym key, an audit key and an admin
+# token, e.g.
+#
+#   $env:PROVIDER_ONBOARDING = "open"
+#   $env:CONSENT_MODE = "opt-out"
+#   $env:CALLBACK_ALLOWED_NETWORKS = "127.0.0.0/8,::1/128"
+#   $env:DEID_PSEUDONYM_KEY = "test-pseudonym-key"
+#   $env:AUDIT_HMAC_KEY = "test-audit-key"
+#   $env:ADMIN_TOKEN = "test-admin-token"
+#   go run ./cmd/server
+#
+# and pass the same admin token with -AdminToken or $env:ADMIN_TOKEN.
 
 param(
     [string]$BaseUrl = "http://localhost:3050",
+    [string]$AdminToken = $env:ADMIN_TOKEN,
     [switch]$ProviderOnly,
     [switch]$PatientRequestOnly,
     [switch]$PatientResponseOnly,
@@ -96,6 +111,7 @@ Write-Banner "WAH4PC API GATEWAY TEST SUITE"
 
 Write-Host "Configuration:" -ForegroundColor Yellow
 Write-Host "  Base URL: $BaseUrl"
+Write-Host "  Admin Token: $(if ($AdminToken) { 'set' } else { 'not set, admin tests are skipped' })"
 Write-Host "  Test Suites: $($testSuites | Where-Object { $_.Enabled } | Measure-Object | Select-Object -ExpandProperty Count)"
 Write-Host ""
 
@@ -107,9 +123,15 @@ try {
 } catch {
     Write-Host "[ERROR] Server is not responding at $BaseUrl" -ForegroundColor Red
     Write-Host ""
-    Write-Host "Please start the server before running tests:" -ForegroundColor Yellow
+    Write-Host "Please start the server with the test settings before running tests:" -ForegroundColor Yellow
     Write-Host "  cd $((Get-Location).Path)"
-    Write-Host "  go run cmd/server/main.go"
+    Write-Host "  `$env:PROVIDER_ONBOARDING = `"open`""
+    Write-Host "  `$env:CONSENT_MODE = `"opt-out`""
+    Write-Host "  `$env:CALLBACK_ALLOWED_NETWORKS = `"127.0.0.0/8,::1/128`""
+    Write-Host "  `$env:DEID_PSEUDONYM_KEY = `"test-pseudonym-key`""
+    Write-Host "  `$env:AUDIT_HMAC_KEY = `"test-audit-key`""
+    Write-Host "  `$env:ADMIN_TOKEN = `"test-admin-token`""
+    Write-Host "  go run ./cmd/server"
     Write-Host ""
     exit 1
 }
@@ -129,7 +151,7 @@ foreach ($suite in $enabledSuites) {
     
     try {
         # Run the test script
-        $output = & $suite.Script -BaseUrl $BaseUrl 2>&1
+        $output = & $suite.Script -BaseUrl $BaseUrl -AdminToken $AdminToken 2>&1
         $exitCode = $LASTEXITCODE
         
         # Display output
@@ -1,7 +1,22 @@
 # Test Helpers for WAH4PC API Gateway
 # Common utilities and functions for all test scripts
+#
+# The suites register providers with callbacks on unresolvable *.local
+# hosts and exchange data without recorded consent, so the gateway under
+# test must run with the settings in $script:ServerEnv (see
+# Write-ServerStartHint). Admin endpoints are called with $script:AdminToken,
+# which must match the server's ADMIN_TOKEN.
 
-$script:BaseUrl = "http://localhost:3050"
+# Suites take -BaseUrl and -AdminToken; keep them when this file is
+# dot-sourced after.
+if (-not $script:BaseUrl) {
+    $script:BaseUrl = "http://localhost:3050"
+}
+if (-not $script:AdminToken) {
+    $script:AdminToken = $env:ADMIN_TOKEN
+}
+# API keys returned by provider registration, by providerId
+$script:ProviderApiKeys = @{}
 $script:TestResults = @()
 $script:PassCount = 0
 $script:FailCount = 0
@@ -68,18 +83,50 @@ function Reset-TestCounters {
     $script:FailCount = 0
 }
 
+# Server Configuration
+# Environment the gateway must be started with for the suites to pass:
+# new providers active without approval, consent not required, loopback
+# callbacks allowed, and the keys the server refuses to start without.
+$script:ServerEnv = [ordered]@{
+    PROVIDER_ONBOARDING       = "open"
+    CONSENT_MODE              = "opt-out"
+    CALLBACK_ALLOWED_NETWORKS = "127.0.0.0/8,::1/128"
+    DEID_PSEUDONYM_KEY        = "test-pseudonym-key"
+    AUDIT_HMAC_KEY            = "test-audit-key"
+    ADMIN_TOKEN               = "test-admin-token"
+}
+
+function Write-ServerStartHint {
+    Write-Host "Start the server for testing with:" -ForegroundColor Yellow
+    foreach ($name in $script:ServerEnv.Keys) {
+        Write-Host "  `$env:$name = `"$($script:ServerEnv[$name])`""
+    }
+    Write-Host "  go run ./cmd/server"
+    Write-Host "and run the tests with the same ADMIN_TOKEN (or -AdminToken)." -ForegroundColor Yellow
+}
+
 # HTTP Request Helpers
+# -ApiKey authenticates as a provider (MPI, matching); -Admin sends the
+# admin token (approval, suspension, policies). Keys returned by provider
+# registration are remembered in $script:ProviderApiKeys.
 function Invoke-ApiRequest {
     param(
         [string]$Method,
         [string]$Endpoint,
         [object]$Body = $null,
         [hashtable]$Headers = @{},
+        [string]$ApiKey = "",
+        [switch]$Admin,
         [switch]$RawResponse
     )
     
     $url = "$script:BaseUrl$Endpoint"
     $Headers["Content-Type"] = "application/json"
+    if ($Admin) {
+        $Headers["Authorization"] = "Bearer $script:AdminToken"
+    } elseif ($ApiKey) {
+        $Headers["Authorization"] = "Bearer $ApiKey"
+    }
     
     $params = @{
         Method = $Method
@@ -106,6 +153,9 @@ function Invoke-ApiRequest {
             } catch {
                 $result.Data = $null
             }
+            if ($result.Data -and $result.Data.apiKey -and $result.Data.providerId) {
+                $script:ProviderApiKeys[$result.Data.providerId] = $result.Data.apiKey
+            }
         }
         
         return $result
@@ -149,14 +199,18 @@ function Invoke-ApiRequest {
     }
 }
 
+# -AsProvider authenticates with the API key of a provider registered in
+# this run.
 function Test-ApiGet {
-    param([string]$Endpoint)
-    return Invoke-ApiRequest -Method "GET" -Endpoint $Endpoint
+    param([string]$Endpoint, [string]$AsProvider = "", [switch]$Admin)
+    $apiKey = if ($AsProvider) { $script:ProviderApiKeys[$AsProvider] } else { "" }
+    return Invoke-ApiRequest -Method "GET" -Endpoint $Endpoint -ApiKey $apiKey -Admin:$Admin
 }
 
 function Test-ApiPost {
-    param([string]$Endpoint, [object]$Body)
-    return Invoke-ApiRequest -Method "POST" -Endpoint $Endpoint -Body $Body
+    param([string]$Endpoint, [object]$Body, [string]$AsProvider = "", [switch]$Admin)
+    $apiKey = if ($AsProvider) { $script:ProviderApiKeys[$AsProvider] } else { "" }
+    return Invoke-ApiRequest -Method "POST" -Endpoint $Endpoint -Body $Body -ApiKey $apiKey -Admin:$Admin
 }
 
 # Assertion Helpers
@@ -254,7 +308,7 @@ function Test-ServerHealth {
         return $true
     } catch {
         Write-Host "[ERROR] Server is not responding at $script:BaseUrl" -ForegroundColor Red
-        Write-Host "        Please start the server with: go run cmd/server/main.go" -ForegroundColor Yellow
+        Write-ServerStartHint
         return $false
     }
 }